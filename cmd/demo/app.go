@@ -3,12 +3,15 @@ package demo
 import (
 	"bufio"
 	"fmt"
+	"image/color"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"photoapp/internal/camera"
 	"photoapp/internal/codec"
+	"photoapp/internal/collage"
 	"photoapp/internal/events"
 	"photoapp/internal/gallery"
 	"photoapp/internal/image"
@@ -30,17 +33,17 @@ func NewApp() *App {
 	eventBus := events.NewEventBus()
 
 	// Register observers
+	// Create storage adapter (Adapter pattern)
+	store := storage.NewMapAdapter()
+
 	loggerObs := events.NewLoggerObserver("SystemLogger")
-	thumbObs := events.NewThumbnailGeneratorObserver("ThumbnailGen")
+	thumbObs := events.NewThumbnailGeneratorObserver("ThumbnailGen", store, nil)
 	statsObs := events.NewStatisticsObserver("StatsTracker")
 
 	eventBus.Register(loggerObs)
 	eventBus.Register(thumbObs)
 	eventBus.Register(statsObs)
 
-	// Create storage adapter (Adapter pattern)
-	store := storage.NewMapAdapter()
-
 	facade := camera.NewFacade(eventBus, store)
 	gal := gallery.NewGallery()
 
@@ -77,6 +80,8 @@ func (a *App) mainMenu() {
 		fmt.Println("│ 5. Demo Decorator Pattern                       │")
 		fmt.Println("│ 6. View Statistics                              │")
 		fmt.Println("│ 7. View Thumbnails                              │")
+		fmt.Println("│ 8. Animated GIF                                 │")
+		fmt.Println("│ 9. Contact Sheet / Collage                      │")
 		fmt.Println("│ 0. Exit                                         │")
 		fmt.Println("└─────────────────────────────────────────────────┘")
 		fmt.Print("Select option: ")
@@ -99,6 +104,10 @@ func (a *App) mainMenu() {
 			a.viewStatistics()
 		case "7":
 			a.viewThumbnails()
+		case "8":
+			a.animatedGIF()
+		case "9":
+			a.composeGallery()
 		case "0":
 			fmt.Println("👋 Goodbye!")
 			return
@@ -124,32 +133,47 @@ func (a *App) capturePhoto() {
 		photoType = "portrait"
 	}
 
-	// Select filters
-	fmt.Println("\nSelect filters (comma-separated, or press Enter for none):")
-	fmt.Println("Available: grayscale, sepia, blur")
-	fmt.Print("Filters: ")
-	filtersInput := a.readInput()
+	// Describe the filter pipeline
+	fmt.Println("\nEnter a filter pipeline, or press Enter for none:")
+	fmt.Printf("Available: %s\n", strings.Join(image.DefaultRegistry().Names(), ", "))
+	fmt.Println("Example: grayscale | blur(radius=4) | sepia(0.3)")
+	fmt.Print("Pipeline: ")
+	pipelineInput := a.readInput()
+
+	pipeline, err := image.ParsePipeline(pipelineInput)
+	if err != nil {
+		fmt.Printf("❌ Invalid pipeline: %v\n", err)
+		return
+	}
 
 	var filters []string
-	if filtersInput != "" {
-		filters = strings.Split(strings.ReplaceAll(filtersInput, " ", ""), ",")
+	if pipeline.Len() > 0 {
+		filters = []string{pipeline.String()}
 	}
 
 	// Select format
+	formats := codec.DefaultRegistry().Formats()
 	fmt.Println("\nSelect format:")
-	fmt.Println("1. JPEG")
-	fmt.Println("2. PNG")
+	for i, name := range formats {
+		fmt.Printf("%d. %s\n", i+1, name)
+	}
 	fmt.Print("Choice: ")
-	formatChoice := a.readInput()
+	formatChoice, _ := strconv.Atoi(a.readInput())
+
+	format := codec.FormatJPEG
+	if formatChoice >= 1 && formatChoice <= len(formats) {
+		format = formats[formatChoice-1]
+	}
 
-	format := "jpeg"
-	if formatChoice == "2" {
-		format = "png"
+	opts, err := a.readEncodeOptions(format)
+	if err != nil {
+		fmt.Printf("❌ Invalid option: %v\n", err)
+		return
 	}
 
 	fmt.Printf("\n📸 Creating %s photo, filters=%v, format=%s...\n", photoType, filters, format)
 
-	encoded, err := a.facade.CaptureAndProcess(photoType, filters, format)
+	encoded, err := a.facade.CaptureAndProcess(photoType, filters, format, opts)
 	if err != nil {
 		fmt.Printf("❌ Failed: %v\n", err)
 		return
@@ -159,13 +183,7 @@ func (a *App) capturePhoto() {
 	img, _ := a.facade.QuickCapture(photoType)
 
 	// Apply filters if any
-	if len(filters) > 0 {
-		processedImg := image.Image(img)
-		for _, filter := range filters {
-			processedImg = image.NewFilterDecorator(processedImg, filter)
-		}
-		img = processedImg
-	}
+	img = pipeline.Apply(img)
 
 	a.gallery.AddImage(img)
 
@@ -174,6 +192,57 @@ func (a *App) capturePhoto() {
 	fmt.Printf("   Total photos in gallery: %d\n", len(a.gallery.Images()))
 }
 
+// readEncodeOptions prompts for the settings that apply to format.
+// Pressing Enter at every prompt keeps the defaults.
+func (a *App) readEncodeOptions(format string) (*codec.EncodeOptions, error) {
+	opts := &codec.EncodeOptions{}
+	var err error
+
+	switch format {
+	case codec.FormatJPEG:
+		fmt.Print("Quality (1-100, Enter for default): ")
+		if input := a.readInput(); input != "" {
+			if opts.Quality, err = strconv.Atoi(input); err != nil {
+				return nil, fmt.Errorf("quality %q is not a number", input)
+			}
+		}
+		fmt.Print("Chroma subsampling (4:4:4, 4:2:2, 4:2:0; Enter for 4:2:0): ")
+		if opts.ChromaSubsampling, err = codec.ParseChromaSubsampling(a.readInput()); err != nil {
+			return nil, err
+		}
+		fmt.Print("Progressive? (y/N): ")
+		opts.Progressive = strings.EqualFold(a.readInput(), "y")
+	case codec.FormatPNG:
+		fmt.Print("Compression (none, fast, default, best; Enter for default): ")
+		if opts.CompressionLevel, err = codec.ParseCompressionLevel(a.readInput()); err != nil {
+			return nil, err
+		}
+	case codec.FormatTIFF:
+		fmt.Print("Compression (lzw, deflate, none; Enter for lzw): ")
+		if opts.TIFFCompression, err = codec.ParseTIFFCompression(a.readInput()); err != nil {
+			return nil, err
+		}
+		fmt.Print("16 bits per channel? (y/N): ")
+		opts.SixteenBit = strings.EqualFold(a.readInput(), "y")
+	case codec.FormatGIF:
+		fmt.Print("Colors (2-256, Enter for 256): ")
+		if input := a.readInput(); input != "" {
+			if opts.NumColors, err = strconv.Atoi(input); err != nil {
+				return nil, fmt.Errorf("colors %q is not a number", input)
+			}
+		}
+		fmt.Print("Palette (mediancut, octree; Enter for mediancut): ")
+		if opts.Quantizer, err = image.ParseQuantizer(a.readInput()); err != nil {
+			return nil, err
+		}
+		fmt.Print("Dither (floyd-steinberg, atkinson, bayer, none; Enter for floyd-steinberg): ")
+		if opts.Dither, err = image.ParseDither(a.readInput()); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
 func (a *App) viewGallery() {
 	fmt.Println("🖼️  Gallery")
 	fmt.Println("─────────────────")
@@ -191,7 +260,14 @@ func (a *App) viewGallery() {
 		fmt.Printf("    Filters: %v\n", meta.Filters)
 		fmt.Printf("    Rating: %d\n", meta.Rating)
 		fmt.Printf("    Format: %s\n", meta.Format)
+		fmt.Printf("    Dimensions: %dx%d\n", meta.Width, meta.Height)
 		fmt.Printf("    Captured: %s\n", meta.CapturedAt.Format("2006-01-02 15:04:05"))
+		if x := meta.EXIF; x != nil && x.Camera() != "" {
+			fmt.Printf("    Camera: %s\n", x.Camera())
+		}
+		if meta.ICC != nil {
+			fmt.Printf("    Color profile: %s\n", meta.ICC)
+		}
 		fmt.Printf("    Size: %d bytes\n\n", len(img.Data()))
 	}
 }
@@ -261,18 +337,23 @@ func (a *App) demoFactories() {
 	portrait := photoFactory.CreatePhoto("portrait")
 	fmt.Printf("  ✓ Created: %s\n", portrait.ID())
 
-	// Codec (simple encoder/decoder)
-	fmt.Println("\n📌 Codec - Image Encoders/Decoders")
-
-	jpegEncoder := codec.NewJPEGEncoder()
-	fmt.Printf("\n  JPEG Encoder: %s\n", jpegEncoder.Format())
-	jpegDecoder := codec.NewJPEGDecoder()
-	fmt.Printf("  JPEG Decoder: %s\n", jpegDecoder.Format())
+	// Codec registry
+	fmt.Println("\n📌 Codec Registry - Image Encoders/Decoders")
+	registry := codec.DefaultRegistry()
+	for _, name := range registry.Formats() {
+		spec, _ := registry.Lookup(name)
+		fmt.Printf("  ✓ %s (extensions: %s, encode: %t, decode: %t)\n",
+			spec.Name, strings.Join(spec.Extensions, ", "), spec.Encoder != nil, spec.Decoder != nil)
+	}
 
-	pngEncoder := codec.NewPNGEncoder()
-	fmt.Printf("\n  PNG Encoder: %s\n", pngEncoder.Format())
-	pngDecoder := codec.NewPNGDecoder()
-	fmt.Printf("  PNG Decoder: %s\n", pngDecoder.Format())
+	encoder, err := registry.Encoder(codec.FormatPNG)
+	if err == nil {
+		data, _ := encoder.Encode(portrait, nil)
+		if decoded, err := registry.DecodeAny(data, nil); err == nil {
+			fmt.Printf("\n  Sniffed %d bytes as %s, %dx%d\n",
+				len(data), decoded.Metadata().Format, decoded.Metadata().Width, decoded.Metadata().Height)
+		}
+	}
 
 	// Adapter Pattern
 	fmt.Println("\n📌 Adapter Pattern - Map Storage Adapter")
@@ -296,14 +377,15 @@ func (a *App) demoDecorator() {
 	// Stack decorators
 	fmt.Println("\n🔧 Applying decorator chain: Grayscale → Sepia → Blur")
 	processedImg := image.Image(baseImg)
-	processedImg = image.NewFilterDecorator(processedImg, "Grayscale")
-	processedImg = image.NewFilterDecorator(processedImg, "Sepia")
-	processedImg = image.NewFilterDecorator(processedImg, "Blur")
+	processedImg = image.NewFilterDecorator(processedImg, image.NewGrayscaleFilter())
+	processedImg = image.NewFilterDecorator(processedImg, image.NewSepiaFilter(1.0))
+	processedImg = image.NewFilterDecorator(processedImg, image.NewGaussianBlurFilter(2.0))
 
 	fmt.Printf("\n✅ Processing complete!\n")
 	fmt.Printf("   Original filters: %v\n", baseImg.Metadata().Filters)
 	fmt.Printf("   After decorators: %v\n", processedImg.Metadata().Filters)
-	fmt.Printf("   Data size: %d bytes (unchanged)\n", len(processedImg.Data()))
+	fmt.Printf("   Original center pixel: %v\n", centerPixel(baseImg))
+	fmt.Printf("   Rendered center pixel: %v\n", centerPixel(processedImg))
 }
 
 func (a *App) viewStatistics() {
@@ -326,15 +408,114 @@ func (a *App) viewThumbnails() {
 
 	count := 0
 	for _, img := range images {
-		if thumb, ok := a.thumbObs.GetThumbnail(img.ID()); ok {
-			fmt.Printf("  • %s: %d bytes\n", img.ID(), len(thumb))
-			count++
+		var sizes []string
+		for _, size := range a.thumbObs.Sizes() {
+			if thumb, ok := a.thumbObs.GetThumbnail(img.ID(), size); ok {
+				sizes = append(sizes, fmt.Sprintf("%dpx %d bytes", size, len(thumb)))
+				count++
+			}
+		}
+		if len(sizes) > 0 {
+			fmt.Printf("  • %s: %s\n", img.ID(), strings.Join(sizes, ", "))
 		}
 	}
 
 	fmt.Printf("\nTotal thumbnails: %d\n", count)
 }
 
+func centerPixel(img image.Image) color.NRGBA {
+	b := img.Bounds()
+	return color.NRGBAModel.Convert(img.At((b.Min.X+b.Max.X)/2, (b.Min.Y+b.Max.Y)/2)).(color.NRGBA)
+}
+
+func (a *App) animatedGIF() {
+	fmt.Println("🎞️  Animated GIF")
+	fmt.Println("─────────────────")
+	fmt.Println("1. Capture burst")
+	fmt.Println("2. Assemble from gallery")
+	fmt.Print("Choice: ")
+
+	var frames []image.Image
+	switch a.readInput() {
+	case "1":
+		fmt.Print("Number of frames: ")
+		count := a.readInt()
+		burst, err := a.facade.CaptureBurst(camera.PhotoTypeLandscape, count, nil)
+		if err != nil {
+			fmt.Printf("❌ Failed: %v\n", err)
+			return
+		}
+		for _, img := range burst {
+			a.gallery.AddImage(img)
+		}
+		frames = burst
+	case "2":
+		images := a.gallery.Images()
+		if len(images) == 0 {
+			fmt.Println("📭 Gallery is empty. Capture some photos first!")
+			return
+		}
+		fmt.Printf("Frame numbers (1-%d, comma-separated): ", len(images))
+		for _, field := range strings.Split(a.readInput(), ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 1 || n > len(images) {
+				fmt.Printf("❌ Invalid frame number %q\n", field)
+				return
+			}
+			frames = append(frames, images[n-1])
+		}
+	default:
+		fmt.Println("❌ Invalid choice")
+		return
+	}
+
+	fmt.Print("Frame delay in ms: ")
+	delay := time.Duration(a.readInt()) * time.Millisecond
+
+	id := fmt.Sprintf("animation-%d", time.Now().UnixNano())
+	encoded, err := a.facade.SaveAnimation(id, frames, delay, nil)
+	if err != nil {
+		fmt.Printf("❌ Failed: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Saved %s: %d frames, %d bytes\n", id, len(frames), len(encoded))
+}
+
+func (a *App) composeGallery() {
+	fmt.Println("🗂️  Contact Sheet / Collage")
+	fmt.Println("─────────────────")
+	if len(a.gallery.Images()) == 0 {
+		fmt.Println("📭 Gallery is empty. Capture some photos first!")
+		return
+	}
+	fmt.Println("1. Contact sheet (grid with captions)")
+	fmt.Println("2. Collage (justified rows)")
+	fmt.Print("Choice: ")
+
+	style := collage.DefaultStyle()
+	var layout collage.Layout
+	switch a.readInput() {
+	case "1":
+		fmt.Print("Columns: ")
+		layout = collage.NewGrid(a.readInt(), 256, 256)
+	case "2":
+		style.Captions = false
+		style.Spacing, style.Border = 8, 0
+		layout = collage.NewJustified(1600, 320)
+	default:
+		fmt.Println("❌ Invalid choice")
+		return
+	}
+
+	id := fmt.Sprintf("sheet-%d", time.Now().UnixNano())
+	encoded, err := a.facade.SaveCollage(id, a.gallery, collage.NewComposer(layout, style), codec.FormatJPEG, nil)
+	if err != nil {
+		fmt.Printf("❌ Failed: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ Saved %s: %d photos, %d bytes\n", id, len(a.gallery.Images()), len(encoded))
+}
+
 func (a *App) readInput() string {
 	a.scanner.Scan()
 	return strings.TrimSpace(a.scanner.Text())
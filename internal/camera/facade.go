@@ -2,13 +2,19 @@
 package camera
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"time"
 
 	"photoapp/internal/codec"
+	"photoapp/internal/collage"
 	"photoapp/internal/events"
+	"photoapp/internal/gallery"
 	"photoapp/internal/image"
 	"photoapp/internal/storage"
+	"photoapp/internal/xmp"
 )
 
 const (
@@ -19,6 +25,8 @@ const (
 // Facade simplifies complex photo processing workflows.
 type Facade struct {
 	factory  *Factory
+	filters  *image.Registry
+	codecs   *codec.Registry
 	eventBus events.Subject
 	storage  storage.Storage
 }
@@ -30,26 +38,210 @@ func NewFacade(eventBus events.Subject, store storage.Storage) *Facade {
 	}
 	return &Facade{
 		factory:  NewFactory(),
+		filters:  image.DefaultRegistry(),
+		codecs:   codec.DefaultRegistry(),
 		eventBus: eventBus,
 		storage:  store,
 	}
 }
 
 // CaptureAndProcess creates, filters, encodes, and stores a photo.
-func (f *Facade) CaptureAndProcess(photoType string, filters []string, format string) ([]byte, error) {
+// Each filter entry may be a single filter name or a full pipeline expression.
+// A nil opts encodes with the format's defaults.
+func (f *Facade) CaptureAndProcess(photoType string, filters []string, format string, opts *codec.EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := f.process(photoType, filters, format, opts, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CaptureAndStore is like CaptureAndProcess but streams the encoded photo
+// straight into storage without keeping a copy. It returns the storage ID.
+func (f *Facade) CaptureAndStore(photoType string, filters []string, format string, opts *codec.EncodeOptions) (string, error) {
+	return f.process(photoType, filters, format, opts, nil)
+}
+
+// OpenPhoto streams a stored photo back out of storage and decodes it,
+// detecting the format from its content. Pixels are turned upright
+// according to the photo's EXIF orientation. When the photo has an XMP
+// sidecar, its properties take precedence over any embedded in the file.
+func (f *Facade) OpenPhoto(id string) (image.Image, error) {
+	r, err := f.storage.Open(id)
+	if err != nil {
+		return nil, fmt.Errorf("open photo: %w", err)
+	}
+	defer r.Close()
+
+	decoded, err := f.codecs.DecodeAnyFrom(r, &codec.DecodeOptions{AutoOrient: true})
+	if err != nil {
+		return nil, fmt.Errorf("decode photo: %w", err)
+	}
+	meta := decoded.Metadata()
+	sidecar, err := f.ReadSidecar(id)
+	switch {
+	case err == nil:
+		meta.ApplyXMP(sidecar)
+	case !errors.Is(err, storage.ErrNotFound):
+		return nil, err
+	}
+	return image.NewBasicImage(id, decoded.Pixels(), meta), nil
+}
+
+// SidecarID returns the storage ID of the XMP sidecar for photo id.
+func SidecarID(id string) string {
+	return id + xmp.SidecarExt
+}
+
+// WriteSidecar stores meta's rating, description, tags and filter chain
+// as an XMP sidecar next to photo id.
+func (f *Facade) WriteSidecar(id string, meta image.ImageMetadata) error {
+	x := meta.XMPMetadata()
+	if x == nil {
+		x = &xmp.Metadata{}
+	}
+	if err := f.storage.Save(SidecarID(id), x.Marshal()); err != nil {
+		return fmt.Errorf("save sidecar: %w", err)
+	}
+	return nil
+}
+
+// ReadSidecar loads the XMP sidecar of photo id. The error wraps
+// storage.ErrNotFound when the photo has none.
+func (f *Facade) ReadSidecar(id string) (*xmp.Metadata, error) {
+	data, err := f.storage.Load(SidecarID(id))
+	if err != nil {
+		return nil, fmt.Errorf("load sidecar: %w", err)
+	}
+	x, err := xmp.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar: %w", err)
+	}
+	return x, nil
+}
+
+// process runs the capture pipeline, streaming the encoder output into
+// storage and, when tee is non-nil, into tee as well.
+func (f *Facade) process(photoType string, filters []string, format string, opts *codec.EncodeOptions, tee io.Writer) (string, error) {
 	photo := f.createPhoto(photoType)
-	processed := f.applyFilters(photo, filters)
-	encoded, err := f.encodePhoto(processed, format)
+	processed, err := f.applyFilters(photo, filters)
+	if err != nil {
+		return "", fmt.Errorf("apply filters: %w", err)
+	}
+	if err := f.store(processed, format, opts, tee, events.NewEvent(events.EventImageProcessed, processed, "Processed")); err != nil {
+		return "", err
+	}
+	return processed.ID(), nil
+}
+
+// store encodes img into storage under its ID, and into tee as well when
+// it is non-nil, then announces it with done.
+func (f *Facade) store(img image.Image, format string, opts *codec.EncodeOptions, tee io.Writer, done *events.Event) error {
+	encoder, err := f.codecs.Encoder(format)
+	if err != nil {
+		return fmt.Errorf("encode photo: %w", err)
+	}
+	encode := func(w io.Writer) error { return encoder.EncodeTo(w, img, opts) }
+	return f.write(img, format, encode, tee, done)
+}
+
+// write streams the output of encode into storage under img's ID, and into
+// tee as well when it is non-nil, then announces it with done. Formats that
+// cannot embed XMP get a sidecar with img's metadata instead.
+func (f *Facade) write(img image.Image, format string, encode func(io.Writer) error, tee io.Writer, done *events.Event) error {
+	spec, err := f.codecs.Lookup(format)
+	if err != nil {
+		return fmt.Errorf("encode photo: %w", err)
+	}
+	w, err := f.storage.Create(img.ID())
 	if err != nil {
-		return nil, fmt.Errorf("encode photo: %w", err)
+		return fmt.Errorf("save photo: %w", err)
+	}
+	out := io.Writer(w)
+	if tee != nil {
+		out = io.MultiWriter(w, tee)
+	}
+	if err := encode(out); err != nil {
+		w.Abort()
+		return fmt.Errorf("encode photo: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("save photo: %w", err)
 	}
+	if meta := img.Metadata(); !spec.EmbedsXMP && meta.XMPMetadata() != nil {
+		if err := f.WriteSidecar(img.ID(), meta); err != nil {
+			return err
+		}
+	}
+
+	f.eventBus.Notify(done)
+	return nil
+}
 
-	if err := f.storage.Save(processed.ID(), encoded); err != nil {
-		return nil, fmt.Errorf("save photo: %w", err)
+// SaveCollage lays out the gallery's images with composer as a single
+// image, such as a contact sheet, then encodes and stores it under id like
+// a processed photo, announcing it as EventCollageSaved. It returns the
+// encoded bytes.
+func (f *Facade) SaveCollage(id string, g *gallery.Gallery, composer *collage.Composer, format string, opts *codec.EncodeOptions) ([]byte, error) {
+	sheet, err := composer.Compose(id, g)
+	if err != nil {
+		return nil, err
 	}
+	var buf bytes.Buffer
+	if err := f.store(sheet, format, opts, &buf, events.NewEvent(events.EventCollageSaved, sheet, "Collage saved")); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	f.eventBus.Notify(events.NewEvent(events.EventImageProcessed, processed, "Processed"))
-	return encoded, nil
+// CaptureBurst captures count photos in quick succession, as a camera burst
+// would, applying the same filters to each frame.
+func (f *Facade) CaptureBurst(photoType string, count int, filters []string) ([]image.Image, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("burst needs at least one frame, got %d", count)
+	}
+	frames := make([]image.Image, 0, count)
+	for i := 0; i < count; i++ {
+		processed, err := f.applyFilters(f.createPhoto(photoType), filters)
+		if err != nil {
+			return nil, fmt.Errorf("apply filters: %w", err)
+		}
+		frames = append(frames, processed)
+	}
+	return frames, nil
+}
+
+// SaveAnimation encodes frames as an animated GIF showing each frame for
+// delay, stores it under id like a processed photo, announcing it as
+// EventAnimationSaved, and returns the encoded bytes. The first frame's
+// metadata is the animation's.
+func (f *Facade) SaveAnimation(id string, frames []image.Image, delay time.Duration, opts *codec.EncodeOptions) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("encode animation: no frames")
+	}
+	encoder, err := f.codecs.Encoder(codec.FormatGIF)
+	if err != nil {
+		return nil, fmt.Errorf("encode animation: %w", err)
+	}
+	animator, ok := encoder.(codec.AnimationEncoder)
+	if !ok {
+		return nil, fmt.Errorf("encode animation: %s encoder cannot write animations", encoder.Format())
+	}
+
+	anim := codec.Animation{Frames: frames}
+	for range frames {
+		anim.Delays = append(anim.Delays, delay)
+	}
+	meta := frames[0].Metadata()
+	meta.Frames, meta.FrameDelays = len(frames), anim.Delays
+	img := image.NewBasicImage(id, frames[0].Pixels(), meta)
+
+	var buf bytes.Buffer
+	encode := func(w io.Writer) error { return animator.EncodeAnimation(w, anim, opts) }
+	if err := f.write(img, codec.FormatGIF, encode, &buf, events.NewEvent(events.EventAnimationSaved, img, "Animation saved")); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // QuickCapture creates a photo without processing.
@@ -63,22 +255,16 @@ func (f *Facade) createPhoto(photoType string) image.Image {
 	return photo
 }
 
-func (f *Facade) applyFilters(photo image.Image, filters []string) image.Image {
+// applyFilters treats each entry as a pipeline expression, so both plain
+// names ("sepia") and chains ("resize(800,600) | sepia(0.3)") are accepted.
+func (f *Facade) applyFilters(photo image.Image, filters []string) (image.Image, error) {
 	processed := photo
-	for _, filter := range filters {
-		processed = image.NewFilterDecorator(processed, filter)
-	}
-	return processed
-}
-
-func (f *Facade) encodePhoto(img image.Image, format string) ([]byte, error) {
-	encoder := f.selectEncoder(format)
-	return encoder.Encode(img)
-}
-
-func (f *Facade) selectEncoder(format string) codec.Encoder {
-	if strings.ToLower(format) == FormatPNG {
-		return codec.NewPNGEncoder()
+	for _, expr := range filters {
+		pipeline, err := f.filters.ParsePipeline(expr)
+		if err != nil {
+			return nil, err
+		}
+		processed = pipeline.Apply(processed)
 	}
-	return codec.NewJPEGEncoder()
+	return processed, nil
 }
@@ -0,0 +1,264 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	stdimage "image"
+	"io"
+	"testing"
+	"time"
+
+	"photoapp/internal/codec"
+	"photoapp/internal/collage"
+	"photoapp/internal/events"
+	"photoapp/internal/gallery"
+	"photoapp/internal/image"
+	"photoapp/internal/storage"
+)
+
+// recorder is an observer that keeps every event it is sent.
+type recorder struct {
+	events []*events.Event
+}
+
+func (r *recorder) OnEvent(e *events.Event) { r.events = append(r.events, e) }
+func (r *recorder) Name() string            { return "recorder" }
+
+func newTestFacade() (*Facade, *storage.MapAdapter, *recorder) {
+	bus := events.NewEventBus()
+	rec := &recorder{}
+	bus.Register(rec)
+	store := storage.NewMapAdapter()
+	return NewFacade(bus, store), store, rec
+}
+
+func TestSaveCollage(t *testing.T) {
+	f, store, rec := newTestFacade()
+	g := gallery.NewGallery()
+	for _, id := range []string{"a", "b", "c"} {
+		g.AddImage(image.NewBasicImage(id, stdimage.NewNRGBA(stdimage.Rect(0, 0, 30, 20)), image.ImageMetadata{}))
+	}
+	style := collage.Style{Spacing: 2}
+	data, err := f.SaveCollage("sheet", g, collage.NewComposer(collage.NewGrid(2, 30, 20), style), FormatPNG, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Load("sheet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != string(data) {
+		t.Error("stored collage differs from returned bytes")
+	}
+	img, err := codec.DefaultRegistry().DecodeAny(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != stdimage.Pt(2+2*32, 2+2*22) {
+		t.Errorf("collage size %v", got)
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != events.EventCollageSaved || rec.events[0].Image.ID() != "sheet" {
+		t.Errorf("events %+v", rec.events)
+	}
+
+	if _, err := f.SaveCollage("empty", gallery.NewGallery(), collage.NewComposer(collage.NewGrid(2, 30, 20), style), FormatPNG, nil); err == nil {
+		t.Error("empty gallery saved")
+	}
+	if _, err := store.Load("empty"); err == nil {
+		t.Error("failed collage stored")
+	}
+}
+
+func TestCaptureBurst(t *testing.T) {
+	f, _, rec := newTestFacade()
+	frames, err := f.CaptureBurst(PhotoTypeLandscape, 3, []string{"resize(width=32) | grayscale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("%d frames, want 3", len(frames))
+	}
+	for i, frame := range frames {
+		if size := frame.Pixels().Rect.Size(); size != stdimage.Pt(32, 18) {
+			t.Errorf("frame %d: size %v", i, size)
+		}
+		if filters := frame.Metadata().Filters; len(filters) != 2 {
+			t.Errorf("frame %d: filters %v", i, filters)
+		}
+	}
+	if len(rec.events) != 3 {
+		t.Errorf("%d capture events, want 3", len(rec.events))
+	}
+
+	if _, err := f.CaptureBurst(PhotoTypeLandscape, 0, nil); err == nil {
+		t.Error("empty burst accepted")
+	}
+	if _, err := f.CaptureBurst(PhotoTypeLandscape, 2, []string{"nosuchfilter"}); err == nil {
+		t.Error("unknown filter accepted")
+	}
+}
+
+func TestOpenPhotoSidecarOverridesEmbedded(t *testing.T) {
+	f, store, _ := newTestFacade()
+	embedded := image.ImageMetadata{Rating: 2, Description: "embedded", Tags: []string{"old"}}
+	data, err := codec.NewPNGEncoder().Encode(image.NewBasicImage("p", stdimage.NewNRGBA(stdimage.Rect(0, 0, 4, 3)), embedded), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("p", data); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := f.OpenPhoto("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta := img.Metadata(); meta.Rating != 2 || meta.Description != "embedded" {
+		t.Errorf("without sidecar: rating %d, description %q", meta.Rating, meta.Description)
+	}
+
+	// The sidecar sets rating and tags but no description, so the
+	// embedded description is kept.
+	if err := f.WriteSidecar("p", image.ImageMetadata{Rating: 5, Tags: []string{"new", "tags"}}); err != nil {
+		t.Fatal(err)
+	}
+	img, err = f.OpenPhoto("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := img.Metadata()
+	if meta.Rating != 5 || meta.Description != "embedded" || len(meta.Tags) != 2 || meta.Tags[0] != "new" {
+		t.Errorf("with sidecar: rating %d, description %q, tags %v", meta.Rating, meta.Description, meta.Tags)
+	}
+	if meta.Width != 4 || meta.Height != 3 {
+		t.Errorf("decoded %dx%d", meta.Width, meta.Height)
+	}
+
+	if err := store.Save(SidecarID("p"), []byte("<x:xmpmeta")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.OpenPhoto("p"); err == nil {
+		t.Error("damaged sidecar ignored")
+	}
+}
+
+// grayCodec is a made-up format, "GRAY" followed by the width, height and
+// one gray byte per pixel, for checking that new formats need no changes
+// here.
+type grayCodec struct{}
+
+func (grayCodec) Format() string { return "gray-test" }
+
+func (c grayCodec) Encode(img image.Image, opts *codec.EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	err := c.EncodeTo(&buf, img, opts)
+	return buf.Bytes(), err
+}
+
+func (grayCodec) EncodeTo(w io.Writer, img image.Image, _ *codec.EncodeOptions) error {
+	pix := img.Pixels()
+	out := []byte("GRAY")
+	out = binary.BigEndian.AppendUint16(out, uint16(pix.Rect.Dx()))
+	out = binary.BigEndian.AppendUint16(out, uint16(pix.Rect.Dy()))
+	for i := 0; i < len(pix.Pix); i += 4 {
+		out = append(out, pix.Pix[i+1])
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+func (c grayCodec) Decode(data []byte) (image.Image, error) {
+	return c.DecodeFrom(bytes.NewReader(data))
+}
+
+func (grayCodec) DecodeFrom(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil || len(data) < 8 {
+		return nil, errors.New("invalid gray-test data")
+	}
+	w, h := int(binary.BigEndian.Uint16(data[4:])), int(binary.BigEndian.Uint16(data[6:]))
+	if len(data) != 8+w*h {
+		return nil, errors.New("invalid gray-test data")
+	}
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i, v := range data[8:] {
+		pix.Pix[4*i], pix.Pix[4*i+1], pix.Pix[4*i+2], pix.Pix[4*i+3] = v, v, v, 0xFF
+	}
+	return image.NewBasicImage("gray", pix, image.ImageMetadata{Format: "gray-test"}), nil
+}
+
+func TestFacadeUsesRegisteredFormat(t *testing.T) {
+	reg := codec.DefaultRegistry()
+	if _, err := reg.Lookup("gray-test"); err != nil {
+		spec := codec.FormatSpec{Name: "gray-test", Extensions: []string{"gry"}, Magic: [][]byte{[]byte("GRAY")}, Encoder: grayCodec{}, Decoder: grayCodec{}}
+		if err := reg.Register(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, store, _ := newTestFacade()
+	id, err := f.CaptureAndStore(PhotoTypeLandscape, []string{"resize(width=40)"}, ".gry", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Load(id)
+	if err != nil || !bytes.HasPrefix(data, []byte("GRAY")) {
+		t.Fatalf("stored %q, %v", data[:min(len(data), 4)], err)
+	}
+	img, err := f.OpenPhoto(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta := img.Metadata(); meta.Format != "gray-test" || meta.Width != 40 {
+		t.Errorf("opened %s %dx%d", meta.Format, meta.Width, meta.Height)
+	}
+	// The format cannot embed XMP, so the filter chain went to a sidecar.
+	if sidecar, err := f.ReadSidecar(id); err != nil || len(sidecar.Filters) != 1 {
+		t.Errorf("sidecar %+v, %v", sidecar, err)
+	}
+}
+
+func TestSaveAnimation(t *testing.T) {
+	f, store, rec := newTestFacade()
+	frames, err := f.CaptureBurst(PhotoTypeLandscape, 3, []string{"resize(width=24)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.events = nil
+	data, err := f.SaveAnimation("burst", frames, 80*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Load("burst"); err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("stored animation differs from returned bytes: %v", err)
+	}
+	anim, err := codec.NewGIFDecoder().DecodeAnimation(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Frames) != 3 || anim.Delays[0] != 80*time.Millisecond {
+		t.Errorf("%d frames, delay %v", len(anim.Frames), anim.Delays[0])
+	}
+	if len(rec.events) != 1 || rec.events[0].Type != events.EventAnimationSaved || rec.events[0].Image.ID() != "burst" {
+		t.Errorf("events %+v", rec.events)
+	}
+	if meta := rec.events[0].Image.Metadata(); meta.Frames != 3 {
+		t.Errorf("announced %d frames", meta.Frames)
+	}
+	// GIF has no room for XMP, so the frames' filter chain is in a sidecar.
+	if sidecar, err := f.ReadSidecar("burst"); err != nil || len(sidecar.Filters) != 1 {
+		t.Errorf("sidecar %+v, %v", sidecar, err)
+	}
+
+	if _, err := f.SaveAnimation("bad", frames, 0, &codec.EncodeOptions{NumColors: 1}); err == nil {
+		t.Error("invalid options accepted")
+	}
+	if _, err := store.Load("bad"); err == nil {
+		t.Error("failed animation stored")
+	}
+	if _, err := f.SaveAnimation("none", nil, 0, nil); err == nil {
+		t.Error("animation without frames saved")
+	}
+}
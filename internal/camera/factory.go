@@ -3,6 +3,7 @@ package camera
 
 import (
 	"fmt"
+	stdimage "image"
 	"math/rand"
 	"time"
 
@@ -10,12 +11,12 @@ import (
 )
 
 const (
-	defaultWidth    = 1920
-	defaultHeight   = 1080
-	defaultDataSize = 1024
-	minRating       = 1
-	maxRating       = 5
-	defaultFormat   = "JPEG"
+	defaultWidth  = 1920
+	defaultHeight = 1080
+	noiseLevel    = 12
+	minRating     = 1
+	maxRating     = 5
+	defaultFormat = "JPEG"
 )
 
 const (
@@ -33,12 +34,9 @@ func NewFactory() *Factory {
 
 // CreatePhoto creates a photo of the specified type.
 func (f *Factory) CreatePhoto(photoType string) image.Image {
-	data := make([]byte, defaultDataSize)
-	rand.Read(data)
+	pix := f.renderScene(photoType, defaultWidth, defaultHeight)
 
 	metadata := image.ImageMetadata{
-		Width:       defaultWidth,
-		Height:      defaultHeight,
 		CapturedAt:  time.Now(),
 		Rating:      rand.Intn(maxRating) + minRating,
 		Filters:     []string{},
@@ -47,7 +45,36 @@ func (f *Factory) CreatePhoto(photoType string) image.Image {
 	}
 
 	id := fmt.Sprintf("photo-%d", time.Now().UnixNano())
-	return image.NewBasicImage(id, data, metadata)
+	return image.NewBasicImage(id, pix, metadata)
+}
+
+// renderScene synthesizes a simple test scene: a vertical gradient split by a
+// horizon, with sensor-like noise on top.
+func (f *Factory) renderScene(photoType string, width, height int) *stdimage.NRGBA {
+	top, bottom := [3]int{90, 150, 230}, [3]int{60, 120, 50}
+	if photoType == PhotoTypePortrait {
+		top, bottom = [3]int{200, 170, 150}, [3]int{70, 50, 45}
+	}
+
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	horizon := height * 3 / 5
+	for y := 0; y < height; y++ {
+		base, span, row := top, horizon, y
+		if y >= horizon {
+			base, span, row = bottom, height-horizon, y-horizon
+		}
+		shade := 255 - row*96/max(span, 1)
+		off := y * pix.Stride
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				v := base[c]*shade/255 + rand.Intn(2*noiseLevel+1) - noiseLevel
+				pix.Pix[off+c] = uint8(min(max(v, 0), 255))
+			}
+			pix.Pix[off+3] = 0xFF
+			off += 4
+		}
+	}
+	return pix
 }
 
 func (f *Factory) getDescription(photoType string) string {
@@ -0,0 +1,471 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"io"
+	"math/bits"
+
+	"photoapp/internal/image"
+)
+
+const FormatBMP = "BMP"
+
+// BMP compression methods.
+const (
+	bmpRGB       = 0
+	bmpRLE8      = 1
+	bmpRLE4      = 2
+	bmpBitfields = 3
+)
+
+const (
+	bmpFileHeaderLen = 14
+	bmpInfoHeaderLen = 40
+	bmpV4HeaderLen   = 108
+)
+
+// BMPEncoder encodes images to BMP format: 24-bit uncompressed for opaque
+// images, 32-bit with an alpha mask otherwise, or 8-bit RLE with a quantized
+// palette when EncodeOptions.RLE is set.
+type BMPEncoder struct{}
+
+// NewBMPEncoder creates a new BMP encoder
+func NewBMPEncoder() *BMPEncoder {
+	return &BMPEncoder{}
+}
+
+// Encode encodes the image as BMP
+func (e *BMPEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as BMP
+func (e *BMPEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	pix := img.Pixels()
+	width, height := pix.Rect.Dx(), pix.Rect.Dy()
+	if width < 1 || height < 1 {
+		return fmt.Errorf("encode BMP: cannot encode %dx%d image", width, height)
+	}
+
+	var (
+		headerLen   = bmpInfoHeaderLen
+		bpp         = 24
+		compression = bmpRGB
+		palette     color.Palette
+		raster      []byte
+	)
+	switch {
+	case opts != nil && opts.RLE:
+		bpp, compression = 8, bmpRLE8
+		palette = image.Palette(pix, 256, opts.quantizer())
+		if len(palette) == 0 {
+			palette = color.Palette{color.NRGBA{A: 0xFF}}
+		}
+		raster = encodeRLE8(image.Remap(pix, palette, opts.dither()))
+	case hasTransparency(pix):
+		headerLen, bpp, compression = bmpV4HeaderLen, 32, bmpBitfields
+	}
+	stride := (bpp*width + 31) / 32 * 4
+	if raster == nil && stride*height > 0xFFFFFFFF-bmpFileHeaderLen-headerLen {
+		return fmt.Errorf("encode BMP: image too large")
+	}
+
+	dataLen := len(raster)
+	if raster == nil {
+		dataLen = stride * height
+	}
+	offset := bmpFileHeaderLen + headerLen + 4*len(palette)
+
+	bw := bufio.NewWriter(w)
+	le := binary.LittleEndian
+	hdr := make([]byte, offset)
+	copy(hdr, "BM")
+	le.PutUint32(hdr[2:], uint32(offset+dataLen))
+	le.PutUint32(hdr[10:], uint32(offset))
+
+	info := hdr[bmpFileHeaderLen:]
+	le.PutUint32(info[0:], uint32(headerLen))
+	le.PutUint32(info[4:], uint32(width))
+	le.PutUint32(info[8:], uint32(height)) // positive height: bottom-up rows
+	le.PutUint16(info[12:], 1)
+	le.PutUint16(info[14:], uint16(bpp))
+	le.PutUint32(info[16:], uint32(compression))
+	le.PutUint32(info[20:], uint32(dataLen))
+	le.PutUint32(info[24:], 2835) // 72 DPI
+	le.PutUint32(info[28:], 2835)
+	le.PutUint32(info[32:], uint32(len(palette)))
+	if headerLen == bmpV4HeaderLen {
+		le.PutUint32(info[40:], 0x00FF0000)
+		le.PutUint32(info[44:], 0x0000FF00)
+		le.PutUint32(info[48:], 0x000000FF)
+		le.PutUint32(info[52:], 0xFF000000)
+		copy(info[56:], "BGRs") // LCS_sRGB, stored little-endian
+	}
+	for i, c := range palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		copy(hdr[bmpFileHeaderLen+headerLen+4*i:], []byte{n.B, n.G, n.R, 0})
+	}
+	bw.Write(hdr)
+
+	if raster != nil {
+		bw.Write(raster)
+	} else {
+		row := make([]byte, stride)
+		for y := height - 1; y >= 0; y-- {
+			src := pix.Pix[y*pix.Stride:]
+			for x := 0; x < width; x++ {
+				p := src[x*4 : x*4+4]
+				if bpp == 32 {
+					copy(row[x*4:], []byte{p[2], p[1], p[0], p[3]})
+				} else {
+					copy(row[x*3:], []byte{p[2], p[1], p[0]})
+				}
+			}
+			bw.Write(row)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("encode BMP: %w", err)
+	}
+	return nil
+}
+
+// encodeRLE8 run-length encodes palette indices bottom-up. Runs of two or
+// more equal pixels become encoded runs; other stretches become absolute
+// runs when at least three long.
+func encodeRLE8(p *stdimage.Paletted) []byte {
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+	var out []byte
+	for y := height - 1; y >= 0; y-- {
+		row := p.Pix[y*p.Stride : y*p.Stride+width]
+		for i := 0; i < width; {
+			run := 1
+			for i+run < width && run < 255 && row[i+run] == row[i] {
+				run++
+			}
+			if run >= 2 {
+				out = append(out, byte(run), row[i])
+				i += run
+				continue
+			}
+
+			j := i + 1
+			for j < width && j-i < 255 && !(j+1 < width && row[j] == row[j+1]) {
+				j++
+			}
+			literal := row[i:j]
+			if len(literal) < 3 {
+				for _, v := range literal {
+					out = append(out, 1, v)
+				}
+			} else {
+				out = append(out, 0, byte(len(literal)))
+				out = append(out, literal...)
+				if len(literal)%2 == 1 {
+					out = append(out, 0)
+				}
+			}
+			i = j
+		}
+		out = append(out, 0, 0) // end of line
+	}
+	return append(out, 0, 1) // end of bitmap
+}
+
+// Format returns the format name
+func (e *BMPEncoder) Format() string {
+	return FormatBMP
+}
+
+// BMPDecoder decodes BMP images: 1, 4, 8, 16, 24 and 32 bits per pixel,
+// uncompressed, bitfields, RLE4 and RLE8, top-down or bottom-up. Pixels an
+// RLE stream skips over are left transparent.
+type BMPDecoder struct{}
+
+// NewBMPDecoder creates a new BMP decoder
+func NewBMPDecoder() *BMPDecoder {
+	return &BMPDecoder{}
+}
+
+// Decode decodes a BMP image
+func (d *BMPDecoder) Decode(data []byte) (image.Image, error) {
+	return d.DecodeFrom(bytes.NewReader(data))
+}
+
+// DecodeFrom decodes a BMP image from a stream
+func (d *BMPDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	pix, err := readBMP(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BMP data: %w", err)
+	}
+	metadata := image.ImageMetadata{
+		Format: FormatBMP,
+	}
+	return image.NewBasicImage("decoded-bmp", pix, metadata), nil
+}
+
+// Format returns the format name
+func (d *BMPDecoder) Format() string {
+	return FormatBMP
+}
+
+type bmpHeader struct {
+	width, height int
+	topDown       bool
+	bpp           int
+	compression   int
+	masks         [4]uint32 // R, G, B, A
+	palette       []color.NRGBA
+}
+
+func readBMP(br *bufio.Reader) (*stdimage.NRGBA, error) {
+	le := binary.LittleEndian
+	file := make([]byte, bmpFileHeaderLen+4)
+	if _, err := io.ReadFull(br, file); err != nil {
+		return nil, err
+	}
+	if string(file[:2]) != "BM" {
+		return nil, fmt.Errorf("bad signature %q", file[:2])
+	}
+	offset := int(le.Uint32(file[10:]))
+	headerLen := int(le.Uint32(file[14:]))
+	if headerLen < 12 || headerLen > 1024 {
+		return nil, fmt.Errorf("unsupported header size %d", headerLen)
+	}
+	info := make([]byte, headerLen)
+	copy(info, file[14:])
+	if _, err := io.ReadFull(br, info[4:]); err != nil {
+		return nil, err
+	}
+	consumed := bmpFileHeaderLen + headerLen
+
+	var h bmpHeader
+	paletteEntry := 4
+	if headerLen == 12 {
+		// OS/2 BITMAPCOREHEADER
+		h.width = int(int16(le.Uint16(info[4:])))
+		h.height = int(int16(le.Uint16(info[6:])))
+		h.bpp = int(le.Uint16(info[10:]))
+		paletteEntry = 3
+	} else {
+		if headerLen < bmpInfoHeaderLen {
+			return nil, fmt.Errorf("unsupported header size %d", headerLen)
+		}
+		h.width = int(int32(le.Uint32(info[4:])))
+		h.height = int(int32(le.Uint32(info[8:])))
+		h.bpp = int(le.Uint16(info[14:]))
+		h.compression = int(le.Uint32(info[16:]))
+		if h.compression == bmpBitfields {
+			if headerLen == bmpInfoHeaderLen {
+				// Masks follow a plain BITMAPINFOHEADER.
+				masks := make([]byte, 12)
+				if _, err := io.ReadFull(br, masks); err != nil {
+					return nil, err
+				}
+				consumed += 12
+				info = append(info, masks...)
+			}
+			for i := 0; i < 4 && 40+4*i+4 <= len(info); i++ {
+				h.masks[i] = le.Uint32(info[40+4*i:])
+			}
+		}
+	}
+	if h.height < 0 {
+		h.height, h.topDown = -h.height, true
+	}
+	if h.width < 1 || h.height < 1 || h.width > maxPixels/h.height {
+		return nil, fmt.Errorf("bad dimensions %dx%d", h.width, h.height)
+	}
+
+	if h.bpp <= 8 {
+		count := 1 << h.bpp
+		if headerLen >= bmpInfoHeaderLen {
+			if used := int(le.Uint32(info[32:])); used > 0 && used < count {
+				count = used
+			}
+		}
+		raw := make([]byte, count*paletteEntry)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, fmt.Errorf("read palette: %w", err)
+		}
+		consumed += len(raw)
+		for i := 0; i < count; i++ {
+			e := raw[i*paletteEntry:]
+			h.palette = append(h.palette, color.NRGBA{R: e[2], G: e[1], B: e[0], A: 0xFF})
+		}
+	}
+
+	if offset < consumed {
+		return nil, fmt.Errorf("pixel data offset %d overlaps headers", offset)
+	}
+	if _, err := io.CopyN(io.Discard, br, int64(offset-consumed)); err != nil {
+		return nil, err
+	}
+
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, h.width, h.height))
+	var err error
+	switch h.compression {
+	case bmpRLE8, bmpRLE4:
+		err = readBMPRLE(br, &h, pix)
+	case bmpRGB, bmpBitfields:
+		err = readBMPRows(br, &h, pix)
+	default:
+		err = fmt.Errorf("unsupported compression %d", h.compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pix, nil
+}
+
+func readBMPRows(br *bufio.Reader, h *bmpHeader, pix *stdimage.NRGBA) error {
+	switch h.bpp {
+	case 1, 4, 8:
+		if len(h.palette) == 0 {
+			return fmt.Errorf("missing palette")
+		}
+	case 16:
+		if h.compression == bmpRGB {
+			h.masks = [4]uint32{0x7C00, 0x03E0, 0x001F, 0}
+		}
+	case 24:
+	case 32:
+		if h.compression == bmpRGB {
+			h.masks = [4]uint32{0x00FF0000, 0x0000FF00, 0x000000FF, 0}
+		}
+	default:
+		return fmt.Errorf("unsupported bit depth %d", h.bpp)
+	}
+
+	stride := (h.bpp*h.width + 31) / 32 * 4
+	row := make([]byte, stride)
+	le := binary.LittleEndian
+	for i := 0; i < h.height; i++ {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return fmt.Errorf("read row %d: %w", i, err)
+		}
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+		dst := pix.Pix[y*pix.Stride:]
+		for x := 0; x < h.width; x++ {
+			var c color.NRGBA
+			switch h.bpp {
+			case 1, 4, 8:
+				shift := 8 - h.bpp - (x*h.bpp)%8
+				idx := int(row[x*h.bpp/8]>>shift) & (1<<h.bpp - 1)
+				c = color.NRGBA{A: 0xFF}
+				if idx < len(h.palette) {
+					c = h.palette[idx]
+				}
+			case 16:
+				c = unpackBitfields(uint32(le.Uint16(row[x*2:])), &h.masks)
+			case 24:
+				c = color.NRGBA{R: row[x*3+2], G: row[x*3+1], B: row[x*3], A: 0xFF}
+			case 32:
+				c = unpackBitfields(le.Uint32(row[x*4:]), &h.masks)
+			}
+			dst[x*4], dst[x*4+1], dst[x*4+2], dst[x*4+3] = c.R, c.G, c.B, c.A
+		}
+	}
+	return nil
+}
+
+// unpackBitfields extracts channels by mask, scaling each to 8 bits.
+// A zero alpha mask means the pixel is opaque.
+func unpackBitfields(v uint32, masks *[4]uint32) color.NRGBA {
+	var ch [4]uint8
+	for i, mask := range masks {
+		if mask == 0 {
+			ch[i] = 0xFF
+			continue
+		}
+		shift := bits.TrailingZeros32(mask)
+		maxv := mask >> shift
+		ch[i] = uint8((uint64(v&mask>>shift)*255 + uint64(maxv)/2) / uint64(maxv))
+	}
+	return color.NRGBA{R: ch[0], G: ch[1], B: ch[2], A: ch[3]}
+}
+
+// readBMPRLE decodes RLE8 and RLE4 streams.
+func readBMPRLE(br *bufio.Reader, h *bmpHeader, pix *stdimage.NRGBA) error {
+	if len(h.palette) == 0 {
+		return fmt.Errorf("missing palette")
+	}
+	nibbles := h.compression == bmpRLE4
+	x, row := 0, 0
+	set := func(idx int) {
+		if x >= h.width || row >= h.height {
+			x++
+			return
+		}
+		y := h.height - 1 - row
+		if h.topDown {
+			y = row
+		}
+		c := color.NRGBA{A: 0xFF}
+		if idx < len(h.palette) {
+			c = h.palette[idx]
+		}
+		o := y*pix.Stride + x*4
+		pix.Pix[o], pix.Pix[o+1], pix.Pix[o+2], pix.Pix[o+3] = c.R, c.G, c.B, c.A
+		x++
+	}
+
+	for {
+		var pair [2]byte
+		if _, err := io.ReadFull(br, pair[:]); err != nil {
+			return fmt.Errorf("read RLE data: %w", err)
+		}
+		count, value := int(pair[0]), pair[1]
+		if count > 0 {
+			for i := 0; i < count; i++ {
+				if nibbles {
+					set(int(value>>(4*(1-i%2))) & 0x0F)
+				} else {
+					set(int(value))
+				}
+			}
+			continue
+		}
+
+		switch value {
+		case 0: // end of line
+			x, row = 0, row+1
+		case 1: // end of bitmap
+			return nil
+		case 2: // delta
+			var delta [2]byte
+			if _, err := io.ReadFull(br, delta[:]); err != nil {
+				return err
+			}
+			x, row = x+int(delta[0]), row+int(delta[1])
+		default: // absolute run
+			n := int(value)
+			size := n
+			if nibbles {
+				size = (n + 1) / 2
+			}
+			data := make([]byte, size+size%2)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				if nibbles {
+					set(int(data[i/2]>>(4*(1-i%2))) & 0x0F)
+				} else {
+					set(int(data[i]))
+				}
+			}
+		}
+		if row > h.height {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"testing"
+
+	"photoapp/internal/image"
+)
+
+func TestBMPRoundTrip(t *testing.T) {
+	transparent := photo(67, 41)
+	for x := 0; x < 67; x++ {
+		transparent.Pix[transparent.PixOffset(x, 3)+3] = uint8(x * 3)
+	}
+	tests := map[string]*stdimage.NRGBA{
+		"24-bit": photo(67, 41), // odd width pads every row
+		"32-bit": transparent,
+		"1x1":    photo(1, 1),
+	}
+	for name, src := range tests {
+		data, err := NewBMPEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := NewBMPDecoder().Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if meta := got.Metadata(); meta.Width != src.Rect.Dx() || meta.Height != src.Rect.Dy() || meta.Format != FormatBMP {
+			t.Errorf("%s: decoded %dx%d %s", name, meta.Width, meta.Height, meta.Format)
+		}
+		if !bytes.Equal(got.Pixels().Pix, src.Pix) {
+			t.Errorf("%s: pixels differ after round trip", name)
+		}
+	}
+}
+
+func TestBMPRLERoundTrip(t *testing.T) {
+	// Runs longer than 255, short literals and long literals of odd
+	// length exercise every RLE8 opcode the encoder writes.
+	palette := []color.NRGBA{{A: 0xFF}, {R: 0xFF, A: 0xFF}, {G: 0xC0, B: 0xFF, A: 0xFF}, {R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}}
+	flat := stdimage.NewNRGBA(stdimage.Rect(0, 0, 301, 7))
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 301; x++ {
+			c := palette[y%2]
+			switch {
+			case x >= 280:
+				c = palette[(x*7+y)%len(palette)]
+			case x >= 270:
+				c = palette[2+x%2]
+			}
+			flat.SetNRGBA(x, y, c)
+		}
+	}
+	opts := &EncodeOptions{RLE: true, NoDither: true}
+	data, err := NewBMPEncoder().Encode(image.NewBasicImage("flat", flat, image.ImageMetadata{}), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= 301*7 {
+		t.Errorf("RLE output %d bytes for %d pixels", len(data), 301*7)
+	}
+	got, err := NewBMPDecoder().Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Pixels().Pix, flat.Pix) {
+		t.Error("pixels differ after RLE round trip")
+	}
+
+	// A photo is quantized to 256 colors, so it only comes back close.
+	src := photo(67, 41)
+	data, err = NewBMPEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), &EncodeOptions{RLE: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = NewBMPDecoder().Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if worst, mean := pixelError(src, got.Pixels()); worst > 48 || mean > 6 {
+		t.Errorf("RLE photo error: worst %d, mean %.2f", worst, mean)
+	}
+}
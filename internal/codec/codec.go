@@ -1,25 +1,53 @@
 // Package codec provides image encoding and decoding functionality.
-// Simple encoder/decoder implementations for JPEG and PNG formats.
+// PNG is backed by the standard library image/png; JPEG decoding uses
+// image/jpeg and encoding uses a baseline or progressive writer with
+// selectable subsampling.
 package codec
 
 import (
+	"bytes"
 	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
 
+	"photoapp/internal/exif"
 	"photoapp/internal/image"
 )
 
-// Encoder encodes an image to bytes
+const (
+	FormatJPEG = "JPEG"
+	FormatPNG  = "PNG"
+)
+
+// maxPixels bounds the raster size decoders of uncompressed formats will
+// allocate from header values alone.
+const maxPixels = 1 << 28
+
+// Encoder encodes an image to bytes or to a stream.
+// A nil opts selects the format's defaults.
 type Encoder interface {
-	Encode(img image.Image) ([]byte, error)
+	Encode(img image.Image, opts *EncodeOptions) ([]byte, error)
+	EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error
 	Format() string
 }
 
-// Decoder decodes bytes to an image
+// Decoder decodes bytes or a stream to an image
 type Decoder interface {
 	Decode(data []byte) (image.Image, error)
+	DecodeFrom(r io.Reader) (image.Image, error)
 	Format() string
 }
 
+// encodeBytes buffers a streaming encode for callers that want a byte slice
+func encodeBytes(e Encoder, img image.Image, opts *EncodeOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := e.EncodeTo(&buf, img, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // JPEGEncoder encodes images to JPEG format
 type JPEGEncoder struct{}
 
@@ -28,17 +56,48 @@ func NewJPEGEncoder() *JPEGEncoder {
 	return &JPEGEncoder{}
 }
 
-// Encode simulates JPEG encoding
-func (e *JPEGEncoder) Encode(img image.Image) ([]byte, error) {
-	data := img.Data()
-	// Simulate JPEG compression (prefix with magic bytes)
-	encoded := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, data...)
-	return encoded, nil
+// Encode encodes the image as a baseline or progressive JPEG
+func (e *JPEGEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as a JPEG using the quality, chroma
+// subsampling and progressive setting from opts. EXIF and XMP metadata are
+// written to APP1 segments and the ICC profile to APP2 segments.
+func (e *JPEGEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	quality, err := opts.quality()
+	if err != nil {
+		return fmt.Errorf("encode JPEG: %w", err)
+	}
+	var segments [][]byte
+	if x := exifFor(img.Metadata()); x != nil {
+		if seg := exifSegment(x); seg != nil {
+			segments = append(segments, seg)
+		}
+	}
+	if packet := xmpPacket(img.Metadata()); packet != nil {
+		seg, err := appSegment(markerAPP1, xmpHeader, packet)
+		if err != nil {
+			return fmt.Errorf("encode JPEG: XMP: %w", err)
+		}
+		segments = append(segments, seg)
+	}
+	if profile := iccProfile(img.Metadata()); profile != nil {
+		segs, err := iccSegments(profile)
+		if err != nil {
+			return fmt.Errorf("encode JPEG: %w", err)
+		}
+		segments = append(segments, segs...)
+	}
+	if err := writeJPEG(w, img.Pixels(), quality, opts.subsampling(), opts.progressive(), segments...); err != nil {
+		return fmt.Errorf("encode JPEG: %w", err)
+	}
+	return nil
 }
 
 // Format returns the format name
 func (e *JPEGEncoder) Format() string {
-	return "JPEG"
+	return FormatJPEG
 }
 
 // JPEGDecoder decodes JPEG images
@@ -49,26 +108,38 @@ func NewJPEGDecoder() *JPEGDecoder {
 	return &JPEGDecoder{}
 }
 
-// Decode simulates JPEG decoding
+// Decode decodes a JPEG image
 func (d *JPEGDecoder) Decode(data []byte) (image.Image, error) {
-	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
-		return nil, fmt.Errorf("invalid JPEG data")
+	return d.DecodeFrom(bytes.NewReader(data))
+}
+
+// DecodeFrom decodes a JPEG image from a stream, along with any EXIF and
+// XMP metadata in its APP1 segments and ICC profile in its APP2 segments.
+// Damaged metadata is ignored.
+func (d *JPEGDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	segments, rd := readJPEGHeader(r)
+	decoded, err := jpeg.Decode(rd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JPEG data: %w", err)
 	}
-	// Remove JPEG header
-	rawData := data[4:]
 
 	metadata := image.ImageMetadata{
-		Format: "JPEG",
-		Width:  1920,
-		Height: 1080,
+		Format: FormatJPEG,
 	}
+	if raw := findSegment(segments, markerAPP1, exif.Header); raw != nil {
+		if x, err := exif.Parse(raw); err == nil {
+			applyEXIF(&metadata, x)
+		}
+	}
+	applyXMPPacket(&metadata, findSegment(segments, markerAPP1, xmpHeader))
+	applyICC(&metadata, findICC(segments))
 
-	return image.NewBasicImage("decoded-jpeg", rawData, metadata), nil
+	return image.NewBasicImage("decoded-jpeg", image.ToNRGBA(decoded), metadata), nil
 }
 
 // Format returns the format name
 func (d *JPEGDecoder) Format() string {
-	return "JPEG"
+	return FormatJPEG
 }
 
 // PNGEncoder encodes images to PNG format
@@ -79,17 +150,32 @@ func NewPNGEncoder() *PNGEncoder {
 	return &PNGEncoder{}
 }
 
-// Encode simulates PNG encoding
-func (e *PNGEncoder) Encode(img image.Image) ([]byte, error) {
-	data := img.Data()
-	// Simulate PNG encoding (prefix with PNG signature)
-	encoded := append([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, data...)
-	return encoded, nil
+// Encode encodes the image as a lossless PNG
+func (e *PNGEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as a lossless PNG using the compression
+// level from opts. The ICC profile is written to an iCCP chunk and XMP
+// metadata to an iTXt chunk.
+func (e *PNGEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	var chunks []pngChunk
+	if profile := iccProfile(img.Metadata()); profile != nil {
+		chunks = append(chunks, iCCPChunk(profile))
+	}
+	if packet := xmpPacket(img.Metadata()); packet != nil {
+		chunks = append(chunks, iTXtChunk(pngXMPKeyword, packet))
+	}
+	enc := &png.Encoder{CompressionLevel: opts.compression().png()}
+	if err := enc.Encode(newPNGChunkWriter(w, chunks), img.Pixels()); err != nil {
+		return fmt.Errorf("encode PNG: %w", err)
+	}
+	return nil
 }
 
 // Format returns the format name
 func (e *PNGEncoder) Format() string {
-	return "PNG"
+	return FormatPNG
 }
 
 // PNGDecoder decodes PNG images
@@ -100,24 +186,30 @@ func NewPNGDecoder() *PNGDecoder {
 	return &PNGDecoder{}
 }
 
-// Decode simulates PNG decoding
+// Decode decodes a PNG image
 func (d *PNGDecoder) Decode(data []byte) (image.Image, error) {
-	if len(data) < 8 || data[0] != 0x89 || data[1] != 0x50 {
-		return nil, fmt.Errorf("invalid PNG data")
+	return d.DecodeFrom(bytes.NewReader(data))
+}
+
+// DecodeFrom decodes a PNG image from a stream, along with any ICC profile
+// and XMP metadata. Damaged metadata is ignored.
+func (d *PNGDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	chunks, rd := readPNGHeader(r)
+	decoded, err := png.Decode(rd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PNG data: %w", err)
 	}
-	// Remove PNG header
-	rawData := data[8:]
 
 	metadata := image.ImageMetadata{
-		Format: "PNG",
-		Width:  1920,
-		Height: 1080,
+		Format: FormatPNG,
 	}
+	applyXMPPacket(&metadata, findITXt(chunks, pngXMPKeyword))
+	applyICC(&metadata, findICCP(chunks))
 
-	return image.NewBasicImage("decoded-png", rawData, metadata), nil
+	return image.NewBasicImage("decoded-png", image.ToNRGBA(decoded), metadata), nil
 }
 
 // Format returns the format name
 func (d *PNGDecoder) Format() string {
-	return "PNG"
+	return FormatPNG
 }
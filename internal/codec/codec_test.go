@@ -0,0 +1,392 @@
+package codec
+
+import (
+	"bytes"
+	stdimage "image"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"photoapp/internal/exif"
+	"photoapp/internal/image"
+)
+
+// photo returns a photo-like raster: smooth gradients with a soft ripple,
+// so that JPEG error stays within what a real photo would see.
+func photo(w, h int) *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			ripple := 20 * math.Sin(fx*9) * math.Cos(fy*7)
+			i := pix.PixOffset(x, y)
+			pix.Pix[i] = uint8(40 + 170*fx + ripple)
+			pix.Pix[i+1] = uint8(60 + 150*fy - ripple)
+			pix.Pix[i+2] = uint8(120 + 60*(fx-fy) + ripple/2)
+			pix.Pix[i+3] = 0xFF
+		}
+	}
+	return pix
+}
+
+// pixelError returns the largest and mean absolute difference between the
+// color channels of a and b.
+func pixelError(a, b *stdimage.NRGBA) (int, float64) {
+	var worst, sum int
+	n := 0
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			i, j := a.PixOffset(x, y), b.PixOffset(x, y)
+			for c := 0; c < 3; c++ {
+				d := int(a.Pix[i+c]) - int(b.Pix[j+c])
+				if d < 0 {
+					d = -d
+				}
+				worst = max(worst, d)
+				sum += d
+				n++
+			}
+		}
+	}
+	return worst, float64(sum) / float64(n)
+}
+
+func TestPNGRoundTrip(t *testing.T) {
+	src := photo(67, 41) // odd sizes catch stride mistakes
+	for x := 0; x < 20; x++ {
+		src.Pix[src.PixOffset(x, 5)+3] = uint8(x * 12) // partial transparency
+	}
+	for _, level := range []CompressionLevel{CompressionDefault, CompressionNone, CompressionFast, CompressionBest} {
+		t.Run(level.String(), func(t *testing.T) {
+			data, err := NewPNGEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), &EncodeOptions{CompressionLevel: level})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := NewPNGDecoder().Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := got.Metadata()
+			if meta.Width != 67 || meta.Height != 41 || meta.Format != FormatPNG {
+				t.Errorf("decoded %dx%d %s, want 67x41 PNG", meta.Width, meta.Height, meta.Format)
+			}
+			if !bytes.Equal(got.Pixels().Pix, src.Pix) {
+				t.Error("pixels differ after round trip")
+			}
+		})
+	}
+}
+
+func TestJPEGRoundTrip(t *testing.T) {
+	src := photo(96, 64)
+	tests := []struct {
+		quality     int
+		subsampling ChromaSubsampling
+		maxErr      int
+		meanErr     float64
+	}{
+		{95, ChromaSubsampling444, 6, 1},
+		{95, ChromaSubsampling422, 8, 1.5},
+		{90, ChromaSubsampling420, 12, 2},
+		{75, ChromaSubsampling420, 16, 3},
+		{30, ChromaSubsampling420, 32, 5},
+	}
+	for _, tt := range tests {
+		opts := &EncodeOptions{Quality: tt.quality, ChromaSubsampling: tt.subsampling}
+		data, err := NewJPEGEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), opts)
+		if err != nil {
+			t.Fatalf("q%d %v: %v", tt.quality, tt.subsampling, err)
+		}
+		got, err := NewJPEGDecoder().Decode(data)
+		if err != nil {
+			t.Fatalf("q%d %v: %v", tt.quality, tt.subsampling, err)
+		}
+		meta := got.Metadata()
+		if meta.Width != 96 || meta.Height != 64 || meta.Format != FormatJPEG {
+			t.Errorf("q%d %v: decoded %dx%d %s, want 96x64 JPEG", tt.quality, tt.subsampling, meta.Width, meta.Height, meta.Format)
+			continue
+		}
+		worst, mean := pixelError(src, got.Pixels())
+		if worst > tt.maxErr || mean > tt.meanErr {
+			t.Errorf("q%d %v: max error %d, mean %.2f; want at most %d, %.2f", tt.quality, tt.subsampling, worst, mean, tt.maxErr, tt.meanErr)
+		}
+	}
+}
+
+func TestJPEGProgressive(t *testing.T) {
+	// Sizes that leave partial MCUs, where a component's own block grid is
+	// narrower than the MCU grid.
+	for _, size := range []stdimage.Point{{96, 64}, {37, 23}, {1, 1}} {
+		img := image.NewBasicImage("src", photo(size.X, size.Y), image.ImageMetadata{})
+		for _, sub := range []ChromaSubsampling{ChromaSubsampling420, ChromaSubsampling422, ChromaSubsampling444} {
+			baseline, err := NewJPEGEncoder().Encode(img, &EncodeOptions{ChromaSubsampling: sub})
+			if err != nil {
+				t.Fatal(err)
+			}
+			progressive, err := NewJPEGEncoder().Encode(img, &EncodeOptions{ChromaSubsampling: sub, Progressive: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(progressive, []byte{0xFF, 0xC2}) || bytes.Contains(progressive, []byte{0xFF, 0xC0}) {
+				t.Errorf("%v %v: no progressive SOF2 marker", size, sub)
+			}
+			want, err := NewJPEGDecoder().Decode(baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := NewJPEGDecoder().Decode(progressive)
+			if err != nil {
+				t.Fatalf("%v %v: %v", size, sub, err)
+			}
+			// Both carry the same quantized coefficients.
+			if !bytes.Equal(got.Pixels().Pix, want.Pixels().Pix) {
+				t.Errorf("%v %v: progressive pixels differ from baseline", size, sub)
+			}
+		}
+	}
+}
+
+func TestJPEGQualityShrinksFile(t *testing.T) {
+	img := image.NewBasicImage("src", photo(96, 64), image.ImageMetadata{})
+	prev := 0
+	for _, q := range []int{95, 75, 30} {
+		data, err := NewJPEGEncoder().Encode(img, &EncodeOptions{Quality: q})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev != 0 && len(data) >= prev {
+			t.Errorf("quality %d: %d bytes, not smaller than %d", q, len(data), prev)
+		}
+		prev = len(data)
+	}
+}
+
+func TestEncodeRecordsPixelDimensions(t *testing.T) {
+	// Metadata from a 6000x4000 original, written with a 96x64 raster.
+	x := &exif.EXIF{Make: "Acme", PixelXDimension: 6000, PixelYDimension: 4000}
+	img := image.NewBasicImage("src", photo(96, 64), image.ImageMetadata{EXIF: x})
+	for _, format := range []string{FormatJPEG, FormatTIFF} {
+		encoder, err := DefaultRegistry().Encoder(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := encoder.Encode(img, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := DefaultRegistry().DecodeAny(data, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if e := got.Metadata().EXIF; e == nil || e.PixelXDimension != 96 || e.PixelYDimension != 64 {
+			t.Errorf("%s: EXIF %+v, want 96x64 pixel dimensions", format, e)
+		}
+	}
+	if x.PixelXDimension != 6000 {
+		t.Error("encoding modified the image's EXIF")
+	}
+}
+
+// cameraEXIF returns the fields a camera records, with a capture time in
+// a zone other than the local one.
+func cameraEXIF() *exif.EXIF {
+	return &exif.EXIF{
+		Make:             "Canon",
+		Model:            "Canon EOS R5",
+		Orientation:      exif.OrientationRotate90,
+		DateTimeOriginal: time.Date(2024, 6, 1, 12, 30, 5, 0, time.FixedZone("", -7*3600)),
+		ExposureTime:     exif.Rational{Num: 1, Den: 250},
+		FNumber:          2.8,
+		ISO:              800,
+		FocalLength:      35.5,
+		GPS:              &exif.GPS{Latitude: 37.774929, Longitude: -122.419416, Altitude: -12.5},
+	}
+}
+
+func TestEXIFRoundTrip(t *testing.T) {
+	want := cameraEXIF()
+	img := image.NewBasicImage("src", photo(48, 32), image.ImageMetadata{EXIF: want})
+	for _, format := range []string{FormatJPEG, FormatTIFF} {
+		encoder, _ := DefaultRegistry().Encoder(format)
+		data, err := encoder.Encode(img, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := DefaultRegistry().DecodeAny(data, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		meta := got.Metadata()
+		e := meta.EXIF
+		if e == nil {
+			t.Fatalf("%s: no EXIF decoded", format)
+		}
+		if e.Make != want.Make || e.Model != want.Model || e.Orientation != want.Orientation {
+			t.Errorf("%s: camera %q %q, orientation %v", format, e.Make, e.Model, e.Orientation)
+		}
+		if e.ExposureTime != want.ExposureTime || e.FNumber != want.FNumber || e.ISO != want.ISO || e.FocalLength != want.FocalLength {
+			t.Errorf("%s: exposure %v f/%v ISO %d %vmm", format, e.ExposureTime, e.FNumber, e.ISO, e.FocalLength)
+		}
+		if !e.DateTimeOriginal.Equal(want.DateTimeOriginal) || !meta.CapturedAt.Equal(want.DateTimeOriginal) {
+			t.Errorf("%s: taken %v, captured at %v, want %v", format, e.DateTimeOriginal, meta.CapturedAt, want.DateTimeOriginal)
+		}
+		// Seconds are stored in hundredths, a few millionths of a degree.
+		if g := e.GPS; g == nil || math.Abs(g.Latitude-want.GPS.Latitude) > 1e-5 ||
+			math.Abs(g.Longitude-want.GPS.Longitude) > 1e-5 || g.Altitude != want.GPS.Altitude {
+			t.Errorf("%s: GPS %+v, want %+v", format, g, want.GPS)
+		}
+	}
+}
+
+func TestCapturedAtFromEXIF(t *testing.T) {
+	taken := time.Date(2023, 12, 24, 18, 0, 0, 0, time.UTC)
+	modified := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		format string
+		meta   image.ImageMetadata
+		want   time.Time
+	}{
+		{"original", FormatJPEG, image.ImageMetadata{EXIF: &exif.EXIF{DateTimeOriginal: taken, DateTime: modified}}, taken},
+		{"original", FormatTIFF, image.ImageMetadata{EXIF: &exif.EXIF{DateTimeOriginal: taken, DateTime: modified}}, taken},
+		// CapturedAt is written as DateTimeOriginal, replacing the EXIF value.
+		{"captured", FormatJPEG, image.ImageMetadata{CapturedAt: modified, EXIF: &exif.EXIF{DateTimeOriginal: taken}}, modified},
+		// TIFF files often carry only DateTime.
+		{"modified only", FormatTIFF, image.ImageMetadata{EXIF: &exif.EXIF{DateTime: modified}}, modified},
+	}
+	for _, tt := range tests {
+		encoder, _ := DefaultRegistry().Encoder(tt.format)
+		data, err := encoder.Encode(image.NewBasicImage("src", photo(8, 8), tt.meta), nil)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.name, tt.format, err)
+		}
+		got, err := DefaultRegistry().DecodeAny(data, nil)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.name, tt.format, err)
+		}
+		if at := got.Metadata().CapturedAt; !at.Equal(tt.want) {
+			t.Errorf("%s %s: captured at %v, want %v", tt.name, tt.format, at, tt.want)
+		}
+	}
+}
+
+func TestJPEGOversizedEXIF(t *testing.T) {
+	// An Exif directory with two large entries the parser does not know,
+	// each small enough to preserve but together over the segment limit.
+	const exifIFD = 0x8769
+	sub := []exif.Field{
+		exif.UndefinedField(0xC000, bytes.Repeat([]byte{1}, 40000)),
+		exif.UndefinedField(0xC001, bytes.Repeat([]byte{2}, 40000)),
+	}
+	ifd0 := []exif.Field{exif.ASCIIField(0x010F, "Canon"), exif.LongField(exifIFD, 0)}
+	subOff := 8 + exif.IFDSize(ifd0)
+	ifd0[1] = exif.LongField(exifIFD, subOff)
+	raw := append([]byte("II*\x00\x08\x00\x00\x00"), exif.EncodeIFD(ifd0, 8, 0)...)
+	big, err := exif.Parse(append(raw, exif.EncodeIFD(sub, subOff, 0)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first block fits once the preserved entries are dropped; the
+	// second is too large on its own and is left out.
+	tests := []struct {
+		name     string
+		exif     *exif.EXIF
+		wantMake string
+	}{
+		{"preserved entries", big, "Canon"},
+		{"core fields", &exif.EXIF{Make: "Canon", Copyright: strings.Repeat("c", 70000)}, ""},
+	}
+	for _, tt := range tests {
+		meta := image.ImageMetadata{EXIF: tt.exif, Rating: 4}
+		data, err := NewJPEGEncoder().Encode(image.NewBasicImage("src", photo(16, 16), meta), nil)
+		if err != nil {
+			t.Fatalf("%s: re-save failed: %v", tt.name, err)
+		}
+		got, err := NewJPEGDecoder().Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotMake := ""
+		if e := got.Metadata().EXIF; e != nil {
+			gotMake = e.Make
+		}
+		if gotMake != tt.wantMake {
+			t.Errorf("%s: make %q, want %q", tt.name, gotMake, tt.wantMake)
+		}
+		if got.Metadata().Rating != 4 {
+			t.Errorf("%s: other metadata lost", tt.name)
+		}
+	}
+}
+
+func TestDecodeRejectsGarbage(t *testing.T) {
+	for _, d := range []Decoder{NewJPEGDecoder(), NewPNGDecoder()} {
+		if _, err := d.Decode([]byte("not an image")); err == nil {
+			t.Errorf("%s: decoded garbage without error", d.Format())
+		}
+	}
+}
+
+func TestDecodeAutoOrient(t *testing.T) {
+	// Stored pixels, as a camera writes them with each orientation, of a
+	// scene that displays as "abc/def". Letters go in the red channel.
+	stored := map[exif.Orientation]string{
+		exif.OrientationNormal:     "abc/def",
+		exif.OrientationFlipH:      "cba/fed",
+		exif.OrientationRotate180:  "fed/cba",
+		exif.OrientationFlipV:      "def/abc",
+		exif.OrientationTranspose:  "ad/be/cf",
+		exif.OrientationRotate90:   "cf/be/ad",
+		exif.OrientationTransverse: "fc/eb/da",
+		exif.OrientationRotate270:  "da/eb/fc",
+	}
+	layout := func(pix *stdimage.NRGBA) string {
+		var b strings.Builder
+		for y := 0; y < pix.Rect.Dy(); y++ {
+			if y > 0 {
+				b.WriteByte('/')
+			}
+			for x := 0; x < pix.Rect.Dx(); x++ {
+				b.WriteByte(pix.Pix[pix.PixOffset(x, y)])
+			}
+		}
+		return b.String()
+	}
+
+	for o, rows := range stored {
+		lines := strings.Split(rows, "/")
+		pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, len(lines[0]), len(lines)))
+		for y, line := range lines {
+			for x := range line {
+				pix.Pix[pix.PixOffset(x, y)], pix.Pix[pix.PixOffset(x, y)+3] = line[x], 0xFF
+			}
+		}
+		img := image.NewBasicImage("src", pix, image.ImageMetadata{EXIF: &exif.EXIF{Orientation: o}})
+		data, err := NewTIFFEncoder().Encode(img, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", o, err)
+		}
+
+		got, err := DefaultRegistry().DecodeAny(data, &DecodeOptions{AutoOrient: true})
+		if err != nil {
+			t.Fatalf("%v: %v", o, err)
+		}
+		meta := got.Metadata()
+		if l := layout(got.Pixels()); l != "abc/def" || meta.Width != 3 || meta.Height != 2 {
+			t.Errorf("%v: decoded %dx%d %s, want 3x2 abc/def", o, meta.Width, meta.Height, l)
+		}
+		if meta.EXIF == nil || meta.EXIF.Orientation != exif.OrientationNormal {
+			t.Errorf("%v: orientation not reset: %+v", o, meta.EXIF)
+		}
+
+		raw, err := DefaultRegistry().DecodeAny(data, nil)
+		if err != nil {
+			t.Fatalf("%v: %v", o, err)
+		}
+		if l := layout(raw.Pixels()); l != rows || raw.Metadata().EXIF.Orientation != o {
+			t.Errorf("%v: without AutoOrient decoded %s with orientation %v", o, l, raw.Metadata().EXIF.Orientation)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	"photoapp/internal/image"
+)
+
+const FormatGIF = "GIF"
+
+// gifDelayUnit is the resolution of GIF frame delays.
+const gifDelayUnit = 10 * time.Millisecond
+
+// Animation is a sequence of frames played back in order.
+type Animation struct {
+	Frames    []image.Image
+	Delays    []time.Duration // one per frame; missing entries default to 100ms
+	LoopCount int             // 0 loops forever, -1 plays once, n repeats n more times
+}
+
+// AnimationEncoder is implemented by encoders whose format can hold a frame sequence.
+type AnimationEncoder interface {
+	EncodeAnimation(w io.Writer, anim Animation, opts *EncodeOptions) error
+}
+
+// AnimationDecoder is implemented by decoders whose format can hold a frame sequence.
+type AnimationDecoder interface {
+	DecodeAnimation(r io.Reader) (*Animation, error)
+}
+
+// GIFEncoder encodes still and animated GIF images. Each frame gets its own
+// palette, median cut unless EncodeOptions.Quantizer says otherwise, and
+// pixels are dithered onto it unless disabled.
+type GIFEncoder struct{}
+
+// NewGIFEncoder creates a new GIF encoder
+func NewGIFEncoder() *GIFEncoder {
+	return &GIFEncoder{}
+}
+
+// Encode encodes the image as a single-frame GIF
+func (e *GIFEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as a single-frame GIF
+func (e *GIFEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	return e.EncodeAnimation(w, Animation{Frames: []image.Image{img}}, opts)
+}
+
+// EncodeAnimation streams an animated GIF to w. Frames smaller than the
+// largest one are placed at the top-left corner of the canvas.
+func (e *GIFEncoder) EncodeAnimation(w io.Writer, anim Animation, opts *EncodeOptions) error {
+	if len(anim.Frames) == 0 {
+		return fmt.Errorf("encode GIF: animation has no frames")
+	}
+	n, err := opts.numColors()
+	if err != nil {
+		return fmt.Errorf("encode GIF: %w", err)
+	}
+
+	g := &gif.GIF{LoopCount: anim.LoopCount}
+	for i, frame := range anim.Frames {
+		pix := frame.Pixels()
+		if pix.Rect.Dx() > 0xFFFF || pix.Rect.Dy() > 0xFFFF {
+			return fmt.Errorf("encode GIF: frame %d is too large", i)
+		}
+		g.Config.Width = max(g.Config.Width, pix.Rect.Dx())
+		g.Config.Height = max(g.Config.Height, pix.Rect.Dy())
+
+		g.Image = append(g.Image, quantizeFrame(pix, n, opts.quantizer(), opts.dither()))
+		delay := 100 * time.Millisecond
+		if i < len(anim.Delays) {
+			delay = anim.Delays[i]
+		}
+		// Round to the nearest unit: a zero delay plays as fast as the
+		// viewer can.
+		g.Delay = append(g.Delay, max(1, int((delay+gifDelayUnit/2)/gifDelayUnit)))
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+
+	if err := gif.EncodeAll(w, g); err != nil {
+		return fmt.Errorf("encode GIF: %w", err)
+	}
+	return nil
+}
+
+// quantizeFrame reduces a frame to at most n colors, reserving one palette
+// slot for transparency when the frame has transparent pixels.
+func quantizeFrame(pix *stdimage.NRGBA, n int, q image.Quantizer, dither image.Dither) *stdimage.Paletted {
+	transparent := hasTransparency(pix)
+	if transparent {
+		n--
+	}
+	palette := image.Palette(pix, n, q)
+	if transparent || len(palette) == 0 {
+		palette = append(palette, color.NRGBA{})
+	}
+	return image.Remap(pix, palette, dither)
+}
+
+func hasTransparency(pix *stdimage.NRGBA) bool {
+	for y := 0; y < pix.Rect.Dy(); y++ {
+		row := pix.Pix[y*pix.Stride : y*pix.Stride+pix.Rect.Dx()*4]
+		for i := 3; i < len(row); i += 4 {
+			if row[i] < 0xFF {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Format returns the format name
+func (e *GIFEncoder) Format() string {
+	return FormatGIF
+}
+
+// GIFDecoder decodes still and animated GIF images
+type GIFDecoder struct{}
+
+// NewGIFDecoder creates a new GIF decoder
+func NewGIFDecoder() *GIFDecoder {
+	return &GIFDecoder{}
+}
+
+// Decode decodes the first frame of a GIF
+func (d *GIFDecoder) Decode(data []byte) (image.Image, error) {
+	return d.DecodeFrom(bytes.NewReader(data))
+}
+
+// DecodeFrom decodes the first frame of a GIF from a stream. The frame's
+// metadata still reports the frame count and timings of the whole animation.
+func (d *GIFDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	anim, err := d.DecodeAnimation(r)
+	if err != nil {
+		return nil, err
+	}
+	return anim.Frames[0], nil
+}
+
+// DecodeAnimation decodes every frame of a GIF, compositing each one onto
+// the canvas according to the previous frame's disposal method so that
+// every returned frame is a complete picture.
+func (d *GIFDecoder) DecodeAnimation(r io.Reader) (*Animation, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GIF data: %w", err)
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("invalid GIF data: no frames")
+	}
+
+	anim := &Animation{LoopCount: g.LoopCount}
+	for _, delay := range g.Delay {
+		anim.Delays = append(anim.Delays, time.Duration(delay)*gifDelayUnit)
+	}
+
+	canvas := stdimage.NewNRGBA(stdimage.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, frame := range g.Image {
+		var previous *stdimage.NRGBA
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		metadata := image.ImageMetadata{
+			Format:      FormatGIF,
+			Frames:      len(g.Image),
+			FrameDelays: anim.Delays,
+			LoopCount:   g.LoopCount,
+		}
+		id := fmt.Sprintf("decoded-gif-%d", i)
+		anim.Frames = append(anim.Frames, image.NewBasicImage(id, cloneNRGBA(canvas), metadata))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), stdimage.Transparent, stdimage.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return anim, nil
+}
+
+// Format returns the format name
+func (d *GIFDecoder) Format() string {
+	return FormatGIF
+}
+
+func cloneNRGBA(src *stdimage.NRGBA) *stdimage.NRGBA {
+	dst := stdimage.NewNRGBA(src.Rect)
+	copy(dst.Pix, src.Pix)
+	return dst
+}
@@ -0,0 +1,166 @@
+package codec
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"testing"
+	"time"
+
+	"photoapp/internal/image"
+)
+
+func solidFrame(w, h int, c color.NRGBA) image.Image {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i := 0; i < len(pix.Pix); i += 4 {
+		pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2], pix.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return image.NewBasicImage("frame", pix, image.ImageMetadata{})
+}
+
+// colorCount returns the number of distinct colors in pix.
+func colorCount(pix *stdimage.NRGBA) int {
+	seen := make(map[color.NRGBA]bool)
+	for y := 0; y < pix.Rect.Dy(); y++ {
+		for x := 0; x < pix.Rect.Dx(); x++ {
+			seen[pix.NRGBAAt(x, y)] = true
+		}
+	}
+	return len(seen)
+}
+
+func TestGIFAnimationRoundTrip(t *testing.T) {
+	red := color.NRGBA{R: 0xFF, A: 0xFF}
+	green := color.NRGBA{G: 0xFF, A: 0xFF}
+	blue := color.NRGBA{B: 0xFF, A: 0xFF}
+	anim := Animation{
+		Frames:    []image.Image{solidFrame(20, 10, red), solidFrame(20, 10, green), solidFrame(8, 4, blue)},
+		Delays:    []time.Duration{50 * time.Millisecond, 1200 * time.Millisecond}, // the last frame gets the default
+		LoopCount: 2,
+	}
+	var buf bytes.Buffer
+	if err := NewGIFEncoder().EncodeAnimation(&buf, anim, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewGIFDecoder().DecodeAnimation(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Frames) != 3 || got.LoopCount != 2 {
+		t.Fatalf("%d frames looping %d, want 3 looping 2", len(got.Frames), got.LoopCount)
+	}
+	wantDelays := []time.Duration{50 * time.Millisecond, 1200 * time.Millisecond, 100 * time.Millisecond}
+	for i, d := range wantDelays {
+		if got.Delays[i] != d {
+			t.Errorf("frame %d: delay %v, want %v", i, got.Delays[i], d)
+		}
+	}
+
+	// Every frame is a full 20x10 canvas; the small last frame sits at the
+	// top-left over the background the previous frame was disposed to.
+	checks := []struct {
+		frame int
+		at    stdimage.Point
+		want  color.NRGBA
+	}{
+		{0, stdimage.Pt(19, 9), red},
+		{1, stdimage.Pt(0, 0), green},
+		{2, stdimage.Pt(7, 3), blue},
+		{2, stdimage.Pt(15, 8), color.NRGBA{}},
+	}
+	for _, c := range checks {
+		pix := got.Frames[c.frame].Pixels()
+		if pix.Rect != stdimage.Rect(0, 0, 20, 10) {
+			t.Fatalf("frame %d: %v", c.frame, pix.Rect)
+		}
+		if p := pix.NRGBAAt(c.at.X, c.at.Y); p != c.want {
+			t.Errorf("frame %d at %v: %v, want %v", c.frame, c.at, p, c.want)
+		}
+	}
+	meta := got.Frames[0].Metadata()
+	if meta.Format != FormatGIF || meta.Frames != 3 || len(meta.FrameDelays) != 3 {
+		t.Errorf("metadata %+v", meta)
+	}
+
+	if err := NewGIFEncoder().EncodeAnimation(&buf, Animation{}, nil); err == nil {
+		t.Error("encoded an animation without frames")
+	}
+}
+
+func TestGIFNumColors(t *testing.T) {
+	opaque := photo(64, 48)
+	transparent := photo(64, 48)
+	for x := 0; x < 64; x++ {
+		transparent.Pix[transparent.PixOffset(x, 0)+3] = 0
+	}
+	for _, n := range []int{2, 5, 16, 256} {
+		for name, src := range map[string]*stdimage.NRGBA{"opaque": opaque, "transparent": transparent} {
+			data, err := NewGIFEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), &EncodeOptions{NumColors: n})
+			if err != nil {
+				t.Fatalf("%d colors, %s: %v", n, name, err)
+			}
+			got, err := NewGIFDecoder().Decode(data)
+			if err != nil {
+				t.Fatalf("%d colors, %s: %v", n, name, err)
+			}
+			// The transparent slot counts towards the limit.
+			if c := colorCount(got.Pixels()); c > n {
+				t.Errorf("%d colors, %s: decoded %d colors", n, name, c)
+			}
+			if a := got.Pixels().NRGBAAt(10, 0).A; (name == "transparent") != (a == 0) {
+				t.Errorf("%d colors, %s: alpha %d at a transparent pixel", n, name, a)
+			}
+		}
+	}
+
+	// Without dithering and enough colors, a few flat colors survive exactly.
+	flat := stdimage.NewNRGBA(stdimage.Rect(0, 0, 30, 30))
+	for i := 0; i < len(flat.Pix); i += 4 {
+		flat.Pix[i], flat.Pix[i+1], flat.Pix[i+3] = byte(i/4%3*120), byte(i/4%7*30), 0xFF
+	}
+	data, err := NewGIFEncoder().Encode(image.NewBasicImage("flat", flat, image.ImageMetadata{}), &EncodeOptions{NoDither: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := NewGIFDecoder().Decode(data); err != nil || !bytes.Equal(got.Pixels().Pix, flat.Pix) {
+		t.Errorf("flat image not kept exactly: %v", err)
+	}
+
+	for _, n := range []int{1, 257} {
+		if _, err := NewGIFEncoder().Encode(image.NewBasicImage("src", opaque, image.ImageMetadata{}), &EncodeOptions{NumColors: n}); err == nil {
+			t.Errorf("%d colors accepted", n)
+		}
+	}
+}
+
+func TestGIFDelayRounding(t *testing.T) {
+	tests := []struct {
+		in, want time.Duration
+	}{
+		{15 * time.Millisecond, 20 * time.Millisecond},
+		{14 * time.Millisecond, 10 * time.Millisecond},
+		{9 * time.Millisecond, 10 * time.Millisecond},
+		{0, 10 * time.Millisecond}, // zero would play as fast as possible
+		{-time.Second, 10 * time.Millisecond},
+		{2 * time.Second, 2 * time.Second},
+	}
+	anim := Animation{}
+	for _, tt := range tests {
+		anim.Frames = append(anim.Frames, solidFrame(2, 2, color.NRGBA{A: 0xFF}))
+		anim.Delays = append(anim.Delays, tt.in)
+	}
+	var buf bytes.Buffer
+	if err := NewGIFEncoder().EncodeAnimation(&buf, anim, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewGIFDecoder().DecodeAnimation(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		if got.Delays[i] != tt.want {
+			t.Errorf("delay %v stored as %v, want %v", tt.in, got.Delays[i], tt.want)
+		}
+	}
+}
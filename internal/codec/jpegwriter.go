@@ -0,0 +1,496 @@
+package codec
+
+import (
+	"bufio"
+	"fmt"
+	stdimage "image"
+	"io"
+	"math"
+)
+
+// The standard library JPEG writer always subsamples chroma 4:2:0 and cannot
+// write progressive files, so this file carries a small Huffman encoder that
+// lets the caller choose the sampling factors and between baseline
+// (sequential) and progressive (spectral selection) coding. Tables are the
+// example tables from Annex K of the JPEG specification.
+
+// unzig maps zigzag order to natural (row-major) order.
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// baseQuant holds the luminance and chrominance tables in zigzag order.
+var baseQuant = [2][64]int{
+	{
+		16, 11, 12, 14, 12, 10, 16, 14,
+		13, 14, 18, 17, 16, 19, 24, 40,
+		26, 24, 22, 22, 24, 49, 35, 37,
+		29, 40, 58, 51, 61, 60, 57, 51,
+		56, 55, 64, 72, 92, 78, 64, 68,
+		87, 69, 55, 56, 80, 109, 81, 87,
+		95, 98, 103, 104, 103, 62, 77, 113,
+		121, 112, 100, 120, 92, 101, 103, 99,
+	},
+	{
+		17, 18, 18, 24, 21, 24, 47, 26,
+		26, 47, 99, 66, 56, 66, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+type huffmanSpec struct {
+	class, id byte
+	counts    [16]byte
+	values    []byte
+}
+
+// huffmanSpecs are, in order: luminance DC, luminance AC, chrominance DC, chrominance AC.
+var huffmanSpecs = [4]huffmanSpec{
+	{0, 0, [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	{1, 0, [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+		[]byte{
+			0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12, 0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+			0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08, 0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+			0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+			0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+			0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+			0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+			0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+			0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+			0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+			0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		}},
+	{0, 1, [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+		[]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	{1, 1, [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+		[]byte{
+			0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21, 0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+			0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91, 0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+			0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34, 0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+			0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38, 0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+			0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+			0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+			0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+			0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+			0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+			0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+			0xf9, 0xfa,
+		}},
+}
+
+// huffmanCode is a code word and its length in bits.
+type huffmanCode struct {
+	bits uint32
+	size uint
+}
+
+type huffmanTable [256]huffmanCode
+
+var huffmanTables = buildHuffmanTables()
+
+// buildHuffmanTables derives canonical code words from the specs (Annex C).
+func buildHuffmanTables() [4]huffmanTable {
+	var tables [4]huffmanTable
+	for i, spec := range huffmanSpecs {
+		code, k := uint32(0), 0
+		for length := 1; length <= 16; length++ {
+			for n := 0; n < int(spec.counts[length-1]); n++ {
+				tables[i][spec.values[k]] = huffmanCode{bits: code, size: uint(length)}
+				code++
+				k++
+			}
+			code <<= 1
+		}
+	}
+	return tables
+}
+
+// dctCos[u][x] = C(u)/2 * cos((2x+1)uπ/16), the 1-D forward DCT basis.
+var dctCos = func() [8][8]float64 {
+	var t [8][8]float64
+	for u := 0; u < 8; u++ {
+		c := 0.5
+		if u == 0 {
+			c = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			t[u][x] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// progressiveScans is the scan script for progressive files, after a first
+// scan carrying the DC coefficients of all components: low luma frequencies
+// first, so that a coarse image appears early, then chroma, then the rest
+// of the luma detail. Successive approximation is not used, so each scan
+// sends its coefficients at full precision.
+var progressiveScans = []struct{ comp, ss, se int }{
+	{0, 1, 5},
+	{1, 1, 63},
+	{2, 1, 63},
+	{0, 6, 63},
+}
+
+// jpegWriter emits a baseline or progressive JPEG stream.
+type jpegWriter struct {
+	w     *bufio.Writer
+	quant [2][64]int
+	acc   uint32
+	nbits uint
+	err   error
+}
+
+// writeJPEG encodes m as a baseline or, if progressive is set, progressive
+// JPEG. Alpha is premultiplied, so transparent areas come out black as with
+// the standard library encoder. Extra segments (complete APPn markers) are
+// written right after SOI.
+func writeJPEG(w io.Writer, m *stdimage.NRGBA, quality int, sub ChromaSubsampling, progressive bool, segments ...[]byte) error {
+	b := m.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > 0xFFFF || b.Dy() > 0xFFFF {
+		return fmt.Errorf("cannot encode %dx%d image as JPEG", b.Dx(), b.Dy())
+	}
+
+	jw := &jpegWriter{w: bufio.NewWriter(w)}
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	for t := range baseQuant {
+		for i, q := range baseQuant[t] {
+			jw.quant[t][i] = min(max((q*scale+50)/100, 1), 255)
+		}
+	}
+
+	h, v := 2, 2
+	switch sub {
+	case ChromaSubsampling422:
+		v = 1
+	case ChromaSubsampling444:
+		h, v = 1, 1
+	}
+
+	jw.write([]byte{0xFF, 0xD8})
+	for _, seg := range segments {
+		jw.write(seg)
+	}
+	jw.writeDQT()
+	jw.writeSOF(b.Dx(), b.Dy(), h, v, progressive)
+	jw.writeDHT()
+	if progressive {
+		jw.writeProgressive(m, h, v)
+	} else {
+		jw.writeBaseline(m, h, v)
+	}
+	jw.write([]byte{0xFF, 0xD9})
+	if jw.err != nil {
+		return jw.err
+	}
+	return jw.w.Flush()
+}
+
+func (jw *jpegWriter) write(p []byte) {
+	if jw.err == nil {
+		_, jw.err = jw.w.Write(p)
+	}
+}
+
+func (jw *jpegWriter) writeByte(c byte) {
+	if jw.err == nil {
+		jw.err = jw.w.WriteByte(c)
+	}
+}
+
+func (jw *jpegWriter) writeMarker(marker byte, length int) {
+	jw.write([]byte{0xFF, marker, byte(length >> 8), byte(length)})
+}
+
+func (jw *jpegWriter) writeDQT() {
+	jw.writeMarker(0xDB, 2+2*65)
+	for t := range jw.quant {
+		jw.write([]byte{byte(t)})
+		table := make([]byte, 64)
+		for i, q := range jw.quant[t] {
+			table[i] = byte(q)
+		}
+		jw.write(table)
+	}
+}
+
+func (jw *jpegWriter) writeSOF(width, height, h, v int, progressive bool) {
+	marker := byte(0xC0)
+	if progressive {
+		marker = 0xC2
+	}
+	jw.writeMarker(marker, 8+3*3)
+	jw.write([]byte{
+		8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 3,
+		1, byte(h<<4 | v), 0,
+		2, 0x11, 1,
+		3, 0x11, 1,
+	})
+}
+
+func (jw *jpegWriter) writeDHT() {
+	length := 2
+	for _, spec := range huffmanSpecs {
+		length += 1 + 16 + len(spec.values)
+	}
+	jw.writeMarker(0xC4, length)
+	for _, spec := range huffmanSpecs {
+		jw.write([]byte{spec.class<<4 | spec.id})
+		jw.write(spec.counts[:])
+		jw.write(spec.values)
+	}
+}
+
+// writeSOS writes a scan header for the given components (0 is Y, 1 Cb,
+// 2 Cr) and spectral band.
+func (jw *jpegWriter) writeSOS(comps []int, ss, se int) {
+	jw.writeMarker(0xDA, 6+2*len(comps))
+	jw.writeByte(byte(len(comps)))
+	for _, c := range comps {
+		jw.write([]byte{byte(c + 1), byte(min(c, 1) * 0x11)})
+	}
+	jw.write([]byte{byte(ss), byte(se), 0})
+}
+
+// writeBaseline writes a single interleaved scan, coding each block as it
+// is transformed so that only one MCU is held in memory.
+func (jw *jpegWriter) writeBaseline(m *stdimage.NRGBA, h, v int) {
+	jw.writeSOS([]int{0, 1, 2}, 0, 63)
+	var prevDC [3]int
+	forEachBlock(m, h, v, &jw.quant, func(c, _, _ int, q *[64]int) {
+		jw.emitDC(q[0]-prevDC[c], min(c, 1))
+		jw.emitAC(q[:], min(c, 1), 1, 63)
+		prevDC[c] = q[0]
+	})
+	jw.flushBits()
+}
+
+// writeProgressive writes an interleaved DC scan followed by the AC scans
+// of progressiveScans. Every scan revisits every block, so the quantized
+// coefficients of the whole image are kept, two bytes per sample.
+func (jw *jpegWriter) writeProgressive(m *stdimage.NRGBA, h, v int) {
+	b := m.Bounds()
+	mcuCols, mcuRows := (b.Dx()+8*h-1)/(8*h), (b.Dy()+8*v-1)/(8*v)
+	type plane struct {
+		cols, rows int // blocks coded in the component's own scans
+		stride     int // blocks per row, including MCU padding
+		blocks     [][64]int16
+	}
+	planes := [3]plane{
+		{cols: (b.Dx() + 7) / 8, rows: (b.Dy() + 7) / 8, stride: mcuCols * h},
+		{cols: mcuCols, rows: mcuRows, stride: mcuCols},
+		{cols: mcuCols, rows: mcuRows, stride: mcuCols},
+	}
+	planes[0].blocks = make([][64]int16, mcuCols*h*mcuRows*v)
+	planes[1].blocks = make([][64]int16, mcuCols*mcuRows)
+	planes[2].blocks = make([][64]int16, mcuCols*mcuRows)
+
+	jw.writeSOS([]int{0, 1, 2}, 0, 0)
+	var prevDC [3]int
+	forEachBlock(m, h, v, &jw.quant, func(c, bx, by int, q *[64]int) {
+		block := &planes[c].blocks[by*planes[c].stride+bx]
+		for k, coef := range q {
+			block[k] = int16(coef)
+		}
+		jw.emitDC(q[0]-prevDC[c], min(c, 1))
+		prevDC[c] = q[0]
+	})
+	jw.flushBits()
+
+	var q [64]int
+	for _, scan := range progressiveScans {
+		jw.writeSOS([]int{scan.comp}, scan.ss, scan.se)
+		p := &planes[scan.comp]
+		for by := 0; by < p.rows; by++ {
+			for bx := 0; bx < p.cols; bx++ {
+				for k, coef := range p.blocks[by*p.stride+bx] {
+					q[k] = int(coef)
+				}
+				jw.emitAC(q[:], min(scan.comp, 1), scan.ss, scan.se)
+			}
+		}
+		jw.flushBits()
+	}
+}
+
+// forEachBlock transforms m to YCbCr and calls fn with every quantized 8x8
+// block, in zigzag order, in MCU order: the h*v luma blocks of each MCU,
+// then Cb, then Cr. bx and by locate the block in its component's grid.
+func forEachBlock(m *stdimage.NRGBA, h, v int, quant *[2][64]int, fn func(c, bx, by int, q *[64]int)) {
+	b := m.Bounds()
+	mcuW, mcuH := 8*h, 8*v
+	var yPlane, cbPlane, crPlane [256]float64
+	var block [64]float64
+	var q [64]int
+
+	for my := 0; my < b.Dy(); my += mcuH {
+		for mx := 0; mx < b.Dx(); mx += mcuW {
+			// Convert the MCU to level-shifted YCbCr, replicating edge pixels.
+			for y := 0; y < mcuH; y++ {
+				sy := min(my+y, b.Dy()-1)
+				for x := 0; x < mcuW; x++ {
+					sx := min(mx+x, b.Dx()-1)
+					p := m.Pix[sy*m.Stride+sx*4:]
+					a := float64(p[3]) / 255
+					r, g, bl := float64(p[0])*a, float64(p[1])*a, float64(p[2])*a
+					i := y*mcuW + x
+					yPlane[i] = 0.299*r + 0.587*g + 0.114*bl - 128
+					cbPlane[i] = -0.168736*r - 0.331264*g + 0.5*bl
+					crPlane[i] = 0.5*r - 0.418688*g - 0.081312*bl
+				}
+			}
+
+			for by := 0; by < v; by++ {
+				for bx := 0; bx < h; bx++ {
+					for y := 0; y < 8; y++ {
+						copy(block[y*8:y*8+8], yPlane[(by*8+y)*mcuW+bx*8:])
+					}
+					quantizeBlock(&block, &quant[0], &q)
+					fn(0, mx/8+bx, my/mcuH*v+by, &q)
+				}
+			}
+			for c, plane := range [2]*[256]float64{&cbPlane, &crPlane} {
+				for y := 0; y < 8; y++ {
+					for x := 0; x < 8; x++ {
+						var sum float64
+						for dy := 0; dy < v; dy++ {
+							for dx := 0; dx < h; dx++ {
+								sum += plane[(y*v+dy)*mcuW+x*h+dx]
+							}
+						}
+						block[y*8+x] = sum / float64(h*v)
+					}
+				}
+				quantizeBlock(&block, &quant[1], &q)
+				fn(c+1, mx/mcuW, my/mcuH, &q)
+			}
+		}
+	}
+}
+
+// quantizeBlock transforms one 8x8 block and quantizes the coefficients
+// into q in zigzag order.
+func quantizeBlock(block *[64]float64, quant *[64]int, q *[64]int) {
+	var rows, coef [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += dctCos[u][x] * block[y*8+x]
+			}
+			rows[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for vv := 0; vv < 8; vv++ {
+			var s float64
+			for y := 0; y < 8; y++ {
+				s += dctCos[vv][y] * rows[y*8+u]
+			}
+			coef[vv*8+u] = s
+		}
+	}
+	for k := 0; k < 64; k++ {
+		q[k] = int(math.Round(coef[unzig[k]] / float64(quant[k])))
+	}
+}
+
+// emitDC codes the difference between a block's DC coefficient and the
+// previous block's in the same component.
+func (jw *jpegWriter) emitDC(diff, table int) {
+	size := bitLength(diff)
+	jw.emitCode(huffmanTables[2*table][size])
+	jw.emitValue(diff, size)
+}
+
+// emitAC codes the AC coefficients ss through se of a zigzag-ordered
+// block, ending with EOB when the band finishes in zeros.
+func (jw *jpegWriter) emitAC(q []int, table, ss, se int) {
+	ac := &huffmanTables[2*table+1]
+	run := 0
+	for k := ss; k <= se; k++ {
+		if q[k] == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			jw.emitCode(ac[0xF0])
+			run -= 16
+		}
+		size := bitLength(q[k])
+		jw.emitCode(ac[byte(run<<4)|byte(size)])
+		jw.emitValue(q[k], size)
+		run = 0
+	}
+	if run > 0 {
+		jw.emitCode(ac[0x00])
+	}
+}
+
+func (jw *jpegWriter) emitCode(c huffmanCode) {
+	jw.emitBits(c.bits, c.size)
+}
+
+// emitValue writes the low size bits of a coefficient, using the JPEG
+// one's-complement convention for negative values.
+func (jw *jpegWriter) emitValue(v int, size uint) {
+	if size == 0 {
+		return
+	}
+	if v < 0 {
+		v--
+	}
+	jw.emitBits(uint32(v)&(1<<size-1), size)
+}
+
+// emitBits appends bits MSB first, stuffing a zero after every 0xFF byte.
+func (jw *jpegWriter) emitBits(bits uint32, size uint) {
+	jw.acc = jw.acc<<size | bits
+	jw.nbits += size
+	for jw.nbits >= 8 {
+		c := byte(jw.acc >> (jw.nbits - 8))
+		jw.writeByte(c)
+		if c == 0xFF {
+			jw.writeByte(0)
+		}
+		jw.nbits -= 8
+	}
+	jw.acc &= 1<<jw.nbits - 1
+}
+
+// flushBits pads the final byte with one bits.
+func (jw *jpegWriter) flushBits() {
+	if jw.nbits > 0 {
+		pad := 8 - jw.nbits
+		jw.emitBits(1<<pad-1, pad)
+	}
+}
+
+func bitLength(v int) uint {
+	if v < 0 {
+		v = -v
+	}
+	var n uint
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
@@ -0,0 +1,170 @@
+package codec
+
+import (
+	"fmt"
+)
+
+// TIFF LZW differs from the GIF flavour in compress/lzw: codes are packed
+// MSB first and the code width grows one code early ("early change").
+const (
+	lzwClear    = 256
+	lzwEOI      = 257
+	lzwFirst    = 258
+	lzwMinWidth = 9
+	lzwMaxWidth = 12
+	lzwTableMax = 1 << lzwMaxWidth
+)
+
+// lzwDecode decompresses a TIFF LZW strip or tile, stopping once want
+// bytes have been produced.
+func lzwDecode(src []byte, want int) ([]byte, error) {
+	var (
+		out    = make([]byte, 0, min(len(src)*3, want))
+		prefix [lzwTableMax]int32
+		suffix [lzwTableMax]byte
+		length [lzwTableMax]int32
+		buf    [lzwTableMax]byte
+		next   = lzwFirst
+		width  = lzwMinWidth
+		prev   = -1
+		acc    uint32
+		nbits  uint
+		pos    int
+	)
+	for i := 0; i < 256; i++ {
+		suffix[i] = byte(i)
+		length[i] = 1
+		prefix[i] = -1
+	}
+
+	// expand returns the string for code, written back to front into buf.
+	expand := func(code int) []byte {
+		n := int(length[code])
+		for i := n - 1; i >= 0; i-- {
+			buf[i] = suffix[code]
+			code = int(prefix[code])
+		}
+		return buf[:n]
+	}
+
+	for len(out) < want {
+		for nbits < uint(width) {
+			if pos >= len(src) {
+				// Some writers omit EOI; treat running out of input as the end.
+				return out, nil
+			}
+			acc = acc<<8 | uint32(src[pos])
+			pos++
+			nbits += 8
+		}
+		code := int(acc >> (nbits - uint(width)) & (1<<width - 1))
+		nbits -= uint(width)
+
+		switch {
+		case code == lzwClear:
+			next, width, prev = lzwFirst, lzwMinWidth, -1
+			continue
+		case code == lzwEOI:
+			return out, nil
+		case prev < 0:
+			if code > 255 {
+				return nil, fmt.Errorf("lzw: invalid first code %d", code)
+			}
+			out = append(out, byte(code))
+			prev = code
+			continue
+		}
+
+		var first byte
+		switch {
+		case code < next:
+			s := expand(code)
+			first = s[0]
+			out = append(out, s...)
+		case code == next:
+			s := expand(prev)
+			first = s[0]
+			out = append(out, s...)
+			out = append(out, first)
+		default:
+			return nil, fmt.Errorf("lzw: invalid code %d", code)
+		}
+
+		if next < lzwTableMax {
+			prefix[next] = int32(prev)
+			suffix[next] = first
+			length[next] = length[prev] + 1
+			next++
+		}
+		if next >= 1<<width-1 && width < lzwMaxWidth {
+			width++
+		}
+		prev = code
+	}
+	return out[:want], nil
+}
+
+// lzwEncode compresses data as a single TIFF LZW strip or tile.
+func lzwEncode(data []byte) []byte {
+	type key struct {
+		prefix int
+		c      byte
+	}
+	var (
+		out   []byte
+		acc   uint32
+		nbits uint
+		width = lzwMinWidth
+		next  = lzwFirst
+		table = make(map[key]int, lzwTableMax)
+	)
+	emit := func(code int) {
+		acc = acc<<uint(width) | uint32(code)
+		nbits += uint(width)
+		for nbits >= 8 {
+			out = append(out, byte(acc>>(nbits-8)))
+			nbits -= 8
+		}
+		acc &= 1<<nbits - 1
+	}
+
+	emit(lzwClear)
+	if len(data) == 0 {
+		emit(lzwEOI)
+		return flushLZW(out, acc, nbits)
+	}
+
+	cur := int(data[0])
+	for _, c := range data[1:] {
+		if code, ok := table[key{cur, c}]; ok {
+			cur = code
+			continue
+		}
+		emit(cur)
+		table[key{cur, c}] = next
+		next++
+		if next == lzwTableMax-2 {
+			// Table is full: start over before codes would need 13 bits.
+			emit(lzwClear)
+			clear(table)
+			next, width = lzwFirst, lzwMinWidth
+		} else if next >= 1<<width && width < lzwMaxWidth {
+			width++
+		}
+		cur = int(c)
+	}
+	emit(cur)
+	next++
+	if next >= 1<<width && width < lzwMaxWidth {
+		width++
+	}
+	emit(lzwEOI)
+	return flushLZW(out, acc, nbits)
+}
+
+func flushLZW(out []byte, acc uint32, nbits uint) []byte {
+	if nbits > 0 {
+		out = append(out, byte(acc<<(8-nbits)))
+	}
+	return out
+}
@@ -0,0 +1,237 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"photoapp/internal/exif"
+	"photoapp/internal/icc"
+	"photoapp/internal/image"
+	"photoapp/internal/xmp"
+)
+
+// JPEG markers used when reading and writing metadata segments.
+const (
+	markerSOI  = 0xD8
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	markerAPP2 = 0xE2
+	markerAPPF = 0xEF
+	markerCOM  = 0xFE
+
+	maxSegmentPayload = 0xFFFF - 2
+
+	// xmpHeader prefixes an XMP packet in a JPEG APP1 segment.
+	xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+	// iccHeader prefixes each APP2 segment of an ICC profile, followed by
+	// the one-based chunk number and the chunk count.
+	iccHeader   = "ICC_PROFILE\x00"
+	maxICCChunk = maxSegmentPayload - len(iccHeader) - 2
+)
+
+// jpegSegment is an APPn segment from a JPEG header, without its length.
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// readJPEGHeader collects the APPn segments that precede the frame header
+// and returns a reader replaying the complete stream for the pixel decoder.
+// Malformed input is not an error here; the pixel decoder reports it.
+func readJPEGHeader(r io.Reader) ([]jpegSegment, io.Reader) {
+	br := bufio.NewReader(r)
+	var head bytes.Buffer
+	tr := io.TeeReader(br, &head)
+	replay := func() io.Reader { return io.MultiReader(&head, br) }
+
+	var soi [2]byte
+	if _, err := io.ReadFull(tr, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return nil, replay()
+	}
+	var segments []jpegSegment
+	for {
+		var m [4]byte
+		if _, err := io.ReadFull(tr, m[:2]); err != nil || m[0] != 0xFF {
+			return segments, replay()
+		}
+		marker := m[1]
+		if (marker < markerAPP0 || marker > markerAPPF) && marker != markerCOM {
+			return segments, replay()
+		}
+		if _, err := io.ReadFull(tr, m[2:]); err != nil {
+			return segments, replay()
+		}
+		n := int(binary.BigEndian.Uint16(m[2:])) - 2
+		if n < 0 {
+			return segments, replay()
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(tr, data); err != nil {
+			return segments, replay()
+		}
+		if marker != markerCOM {
+			segments = append(segments, jpegSegment{marker: marker, data: data})
+		}
+	}
+}
+
+// findSegment returns the payload after prefix of the first segment with
+// the given marker whose payload starts with prefix.
+func findSegment(segments []jpegSegment, marker byte, prefix string) []byte {
+	for _, s := range segments {
+		if s.marker == marker && bytes.HasPrefix(s.data, []byte(prefix)) {
+			return s.data[len(prefix):]
+		}
+	}
+	return nil
+}
+
+// appSegment encodes a complete APPn marker segment.
+func appSegment(marker byte, prefix string, payload []byte) ([]byte, error) {
+	n := len(prefix) + len(payload)
+	if n > maxSegmentPayload {
+		return nil, fmt.Errorf("APP%d segment of %d bytes exceeds the 64 KiB limit", marker-markerAPP0, n)
+	}
+	seg := make([]byte, 0, 4+n)
+	seg = append(seg, 0xFF, marker, byte((n+2)>>8), byte(n+2))
+	seg = append(seg, prefix...)
+	return append(seg, payload...), nil
+}
+
+// exifFor returns the EXIF to embed for meta: a copy of its EXIF block with
+// DateTimeOriginal taken from CapturedAt and the pixel dimensions from the
+// image being written, or nil if there is nothing to write.
+func exifFor(meta image.ImageMetadata) *exif.EXIF {
+	if meta.EXIF == nil && meta.CapturedAt.IsZero() {
+		return nil
+	}
+	var e exif.EXIF
+	if meta.EXIF != nil {
+		e = *meta.EXIF
+	}
+	if !meta.CapturedAt.IsZero() {
+		e.DateTimeOriginal = meta.CapturedAt
+	}
+	e.PixelXDimension, e.PixelYDimension = meta.Width, meta.Height
+	return &e
+}
+
+// exifSegment encodes e as a JPEG APP1 segment. A block over the segment
+// size limit, which only entries preserved from the source can produce, is
+// written without them, and left out entirely if it still does not fit,
+// so that re-saving a photo never fails over its metadata.
+func exifSegment(e *exif.EXIF) []byte {
+	seg, err := appSegment(markerAPP1, exif.Header, e.Marshal())
+	if err != nil {
+		seg, err = appSegment(markerAPP1, exif.Header, e.WithoutPreserved().Marshal())
+	}
+	if err != nil {
+		return nil
+	}
+	return seg
+}
+
+// applyEXIF attaches a decoded EXIF block to meta, taking CapturedAt from
+// DateTimeOriginal when present.
+func applyEXIF(meta *image.ImageMetadata, e *exif.EXIF) {
+	if e == nil {
+		return
+	}
+	meta.EXIF = e
+	if !e.DateTimeOriginal.IsZero() {
+		meta.CapturedAt = e.DateTimeOriginal
+	}
+}
+
+// xmpPacket returns the XMP packet to embed for meta, or nil if there is
+// nothing to write.
+func xmpPacket(meta image.ImageMetadata) []byte {
+	if x := meta.XMPMetadata(); x != nil {
+		return x.MarshalPacket()
+	}
+	return nil
+}
+
+// applyXMPPacket attaches an embedded XMP packet to meta. A damaged packet
+// is ignored.
+func applyXMPPacket(meta *image.ImageMetadata, packet []byte) {
+	if packet == nil {
+		return
+	}
+	if x, err := xmp.Parse(packet); err == nil {
+		meta.ApplyXMP(x)
+	}
+}
+
+// iccSegments splits an ICC profile into complete APP2 segments.
+func iccSegments(profile []byte) ([][]byte, error) {
+	count := (len(profile) + maxICCChunk - 1) / maxICCChunk
+	if count > 255 {
+		return nil, fmt.Errorf("ICC profile of %d bytes exceeds the JPEG limit", len(profile))
+	}
+	segments := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := profile[i*maxICCChunk : min((i+1)*maxICCChunk, len(profile))]
+		payload := append([]byte{byte(i + 1), byte(count)}, chunk...)
+		seg, err := appSegment(markerAPP2, iccHeader, payload)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// findICC reassembles an ICC profile from its APP2 segments, returning nil
+// if there is none or a chunk is missing.
+func findICC(segments []jpegSegment) []byte {
+	var chunks [][]byte
+	for _, s := range segments {
+		if s.marker != markerAPP2 || !bytes.HasPrefix(s.data, []byte(iccHeader)) {
+			continue
+		}
+		d := s.data[len(iccHeader):]
+		if len(d) < 2 || d[0] == 0 || d[0] > d[1] {
+			return nil
+		}
+		if chunks == nil {
+			chunks = make([][]byte, d[1])
+		}
+		if int(d[1]) != len(chunks) {
+			return nil
+		}
+		chunks[d[0]-1] = d[2:]
+	}
+	var profile []byte
+	for _, c := range chunks {
+		if c == nil {
+			return nil
+		}
+		profile = append(profile, c...)
+	}
+	return profile
+}
+
+// iccProfile returns the ICC profile to embed for meta, or nil if there is
+// nothing to write.
+func iccProfile(meta image.ImageMetadata) []byte {
+	if meta.ICC == nil {
+		return nil
+	}
+	return meta.ICC.Data
+}
+
+// applyICC attaches an embedded ICC profile to meta. A damaged profile is
+// ignored.
+func applyICC(meta *image.ImageMetadata, data []byte) {
+	if data == nil {
+		return
+	}
+	if p, err := icc.Parse(data); err == nil {
+		meta.ICC = p
+	}
+}
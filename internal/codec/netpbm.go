@@ -0,0 +1,354 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"io"
+	"strconv"
+
+	"photoapp/internal/image"
+)
+
+const (
+	FormatPBM = "PBM"
+	FormatPGM = "PGM"
+	FormatPPM = "PPM"
+)
+
+// netpbmLineLimit is the maximum line length for plain (ASCII) output.
+const netpbmLineLimit = 70
+
+// NetpbmEncoder encodes images to one of the Netpbm formats: PBM (bitmap,
+// thresholded at mid-gray), PGM (Rec. 601 luma) or PPM (RGB). Output is the
+// binary variant unless EncodeOptions.Plain asks for ASCII. Alpha is dropped.
+type NetpbmEncoder struct {
+	format string
+}
+
+// NewPBMEncoder creates a new PBM encoder
+func NewPBMEncoder() *NetpbmEncoder {
+	return &NetpbmEncoder{format: FormatPBM}
+}
+
+// NewPGMEncoder creates a new PGM encoder
+func NewPGMEncoder() *NetpbmEncoder {
+	return &NetpbmEncoder{format: FormatPGM}
+}
+
+// NewPPMEncoder creates a new PPM encoder
+func NewPPMEncoder() *NetpbmEncoder {
+	return &NetpbmEncoder{format: FormatPPM}
+}
+
+// Encode encodes the image as Netpbm
+func (e *NetpbmEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as Netpbm
+func (e *NetpbmEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	pix := img.Pixels()
+	width, height := pix.Rect.Dx(), pix.Rect.Dy()
+	plain := opts != nil && opts.Plain
+
+	magic := map[string][2]string{
+		FormatPBM: {"P4", "P1"},
+		FormatPGM: {"P5", "P2"},
+		FormatPPM: {"P6", "P3"},
+	}[e.format]
+	header := magic[0]
+	if plain {
+		header = magic[1]
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n%d %d\n", header, width, height)
+	if e.format != FormatPBM {
+		fmt.Fprintf(bw, "255\n")
+	}
+
+	pw := &plainWriter{w: bw}
+	for y := 0; y < height; y++ {
+		row := pix.Pix[y*pix.Stride : y*pix.Stride+width*4]
+		switch e.format {
+		case FormatPBM:
+			bits := make([]byte, (width+7)/8)
+			for x := 0; x < width; x++ {
+				p := row[x*4:]
+				if grayOf(p) < 128 {
+					bits[x/8] |= 0x80 >> (x % 8)
+					if plain {
+						pw.value(1)
+					}
+				} else if plain {
+					pw.value(0)
+				}
+			}
+			if !plain {
+				bw.Write(bits)
+			}
+		case FormatPGM:
+			for x := 0; x < width; x++ {
+				v := grayOf(row[x*4:])
+				if plain {
+					pw.value(int(v))
+				} else {
+					bw.WriteByte(v)
+				}
+			}
+		default:
+			for x := 0; x < width; x++ {
+				p := row[x*4 : x*4+3]
+				if plain {
+					pw.value(int(p[0]))
+					pw.value(int(p[1]))
+					pw.value(int(p[2]))
+				} else {
+					bw.Write(p)
+				}
+			}
+		}
+		if plain {
+			pw.newline()
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("encode %s: %w", e.format, err)
+	}
+	return nil
+}
+
+// Format returns the format name
+func (e *NetpbmEncoder) Format() string {
+	return e.format
+}
+
+func grayOf(p []byte) uint8 {
+	return uint8((19595*uint32(p[0]) + 38470*uint32(p[1]) + 7471*uint32(p[2]) + 1<<15) >> 16)
+}
+
+// plainWriter writes space-separated decimal values, wrapping lines at the
+// Netpbm limit of 70 characters.
+type plainWriter struct {
+	w   *bufio.Writer
+	col int
+}
+
+func (p *plainWriter) value(v int) {
+	s := strconv.Itoa(v)
+	if p.col > 0 && p.col+1+len(s) > netpbmLineLimit {
+		p.newline()
+	}
+	if p.col > 0 {
+		p.w.WriteByte(' ')
+		p.col++
+	}
+	p.w.WriteString(s)
+	p.col += len(s)
+}
+
+func (p *plainWriter) newline() {
+	if p.col > 0 {
+		p.w.WriteByte('\n')
+		p.col = 0
+	}
+}
+
+// NetpbmDecoder decodes all six Netpbm variants (P1-P6), with maxval up to
+// 65535. Samples are scaled to 8 bits.
+type NetpbmDecoder struct {
+	format string
+}
+
+// NewNetpbmDecoder creates a decoder that accepts any Netpbm variant and
+// reports format as the decoded image's format.
+func NewNetpbmDecoder(format string) *NetpbmDecoder {
+	return &NetpbmDecoder{format: format}
+}
+
+// Decode decodes a Netpbm image
+func (d *NetpbmDecoder) Decode(data []byte) (image.Image, error) {
+	return d.DecodeFrom(bytes.NewReader(data))
+}
+
+// DecodeFrom decodes a Netpbm image from a stream
+func (d *NetpbmDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	pix, format, err := readNetpbm(bufio.NewReader(r))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Netpbm data: %w", err)
+	}
+	metadata := image.ImageMetadata{
+		Format: format,
+	}
+	return image.NewBasicImage("decoded-"+format, pix, metadata), nil
+}
+
+// Format returns the format name
+func (d *NetpbmDecoder) Format() string {
+	return d.format
+}
+
+func readNetpbm(br *bufio.Reader) (*stdimage.NRGBA, string, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, "", err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return nil, "", fmt.Errorf("bad magic %q", magic[:])
+	}
+	kind := magic[1]
+	format := [...]string{FormatPBM, FormatPGM, FormatPPM}[(kind-'1')%3]
+	plain := kind <= '3'
+
+	width, err := readNetpbmInt(br)
+	if err != nil {
+		return nil, "", fmt.Errorf("read width: %w", err)
+	}
+	height, err := readNetpbmInt(br)
+	if err != nil {
+		return nil, "", fmt.Errorf("read height: %w", err)
+	}
+	maxval := 1
+	if format != FormatPBM {
+		if maxval, err = readNetpbmInt(br); err != nil {
+			return nil, "", fmt.Errorf("read maxval: %w", err)
+		}
+	}
+	if width < 1 || height < 1 || maxval < 1 || maxval > 0xFFFF {
+		return nil, "", fmt.Errorf("bad header %dx%d maxval %d", width, height, maxval)
+	}
+	if width > maxPixels/height {
+		return nil, "", fmt.Errorf("image %dx%d too large", width, height)
+	}
+	if !plain {
+		// Exactly one whitespace byte separates the header from the raster.
+		if _, err := br.ReadByte(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	channels := map[string]int{FormatPBM: 1, FormatPGM: 1, FormatPPM: 3}[format]
+	sampleBytes := 1
+	if maxval > 0xFF {
+		sampleBytes = 2
+	}
+	readSample := func() (int, error) {
+		if plain {
+			if format == FormatPBM {
+				return readPlainBit(br)
+			}
+			return readNetpbmInt(br)
+		}
+		if sampleBytes == 1 {
+			b, err := br.ReadByte()
+			return int(b), err
+		}
+		var b [2]byte
+		_, err := io.ReadFull(br, b[:])
+		return int(b[0])<<8 | int(b[1]), err
+	}
+
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := pix.Pix[y*pix.Stride:]
+		if format == FormatPBM && !plain {
+			packed := make([]byte, (width+7)/8)
+			if _, err := io.ReadFull(br, packed); err != nil {
+				return nil, "", fmt.Errorf("read row %d: %w", y, err)
+			}
+			for x := 0; x < width; x++ {
+				v := uint8(0xFF)
+				if packed[x/8]&(0x80>>(x%8)) != 0 {
+					v = 0
+				}
+				row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = v, v, v, 0xFF
+			}
+			continue
+		}
+		for x := 0; x < width; x++ {
+			var rgb [3]uint8
+			for c := 0; c < channels; c++ {
+				s, err := readSample()
+				if err != nil {
+					return nil, "", fmt.Errorf("read row %d: %w", y, err)
+				}
+				if s > maxval {
+					return nil, "", fmt.Errorf("sample %d exceeds maxval %d", s, maxval)
+				}
+				if format == FormatPBM {
+					rgb[c] = uint8(255 * (1 - s))
+				} else {
+					rgb[c] = uint8((s*255 + maxval/2) / maxval)
+				}
+			}
+			if channels == 1 {
+				rgb[1], rgb[2] = rgb[0], rgb[0]
+			}
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = rgb[0], rgb[1], rgb[2], 0xFF
+		}
+	}
+	return pix, format, nil
+}
+
+// skipNetpbmSpace skips whitespace and '#' comments.
+func skipNetpbmSpace(br *bufio.Reader) error {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case c == '#':
+			if _, err := br.ReadString('\n'); err != nil {
+				return err
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+		default:
+			return br.UnreadByte()
+		}
+	}
+}
+
+func readNetpbmInt(br *bufio.Reader) (int, error) {
+	if err := skipNetpbmSpace(br); err != nil {
+		return 0, err
+	}
+	n, digits := 0, 0
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c < '0' || c > '9' {
+			if digits == 0 {
+				return 0, fmt.Errorf("expected number, found %q", c)
+			}
+			return n, br.UnreadByte()
+		}
+		n = n*10 + int(c-'0')
+		digits++
+		if n > 1<<24 {
+			return 0, fmt.Errorf("number too large")
+		}
+	}
+}
+
+// readPlainBit reads one P1 sample; plain PBM digits need not be separated.
+func readPlainBit(br *bufio.Reader) (int, error) {
+	if err := skipNetpbmSpace(br); err != nil {
+		return 0, err
+	}
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c != '0' && c != '1' {
+		return 0, fmt.Errorf("expected bit, found %q", c)
+	}
+	return int(c - '0'), nil
+}
@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"bytes"
+	stdimage "image"
+	"strings"
+	"testing"
+
+	"photoapp/internal/image"
+)
+
+// netpbmFixture returns an image that each Netpbm format can hold exactly:
+// black and white for PBM, gray for PGM and full color for PPM.
+func netpbmFixture(format string) *stdimage.NRGBA {
+	pix := photo(37, 13) // odd width leaves PBM rows with spare bits
+	for i := 0; i < len(pix.Pix); i += 4 {
+		switch format {
+		case FormatPBM:
+			v := byte(0)
+			if (i/4)%5 < 2 {
+				v = 0xFF
+			}
+			pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2] = v, v, v
+		case FormatPGM:
+			pix.Pix[i+1], pix.Pix[i+2] = pix.Pix[i], pix.Pix[i]
+		}
+	}
+	return pix
+}
+
+func TestNetpbmRoundTrip(t *testing.T) {
+	encoders := map[string]*NetpbmEncoder{FormatPBM: NewPBMEncoder(), FormatPGM: NewPGMEncoder(), FormatPPM: NewPPMEncoder()}
+	for format, enc := range encoders {
+		src := netpbmFixture(format)
+		for _, plain := range []bool{false, true} {
+			data, err := enc.Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), &EncodeOptions{Plain: plain})
+			if err != nil {
+				t.Fatalf("%s plain=%v: %v", format, plain, err)
+			}
+			magic := map[string]string{FormatPBM: "P4", FormatPGM: "P5", FormatPPM: "P6"}[format]
+			if plain {
+				magic = string([]byte{'P', magic[1] - 3})
+				for _, line := range strings.Split(string(data), "\n") {
+					if len(line) > netpbmLineLimit {
+						t.Errorf("%s plain: %d-character line", format, len(line))
+						break
+					}
+				}
+			}
+			if !bytes.HasPrefix(data, []byte(magic+"\n")) {
+				t.Errorf("%s plain=%v: header %q, want %s", format, plain, data[:2], magic)
+			}
+
+			got, err := NewNetpbmDecoder(format).Decode(data)
+			if err != nil {
+				t.Fatalf("%s plain=%v: %v", format, plain, err)
+			}
+			if meta := got.Metadata(); meta.Width != 37 || meta.Height != 13 || meta.Format != format {
+				t.Errorf("%s plain=%v: decoded %dx%d %s", format, plain, meta.Width, meta.Height, meta.Format)
+			}
+			if !bytes.Equal(got.Pixels().Pix, src.Pix) {
+				t.Errorf("%s plain=%v: pixels differ after round trip", format, plain)
+			}
+		}
+	}
+}
+
+func TestNetpbmDecodeComments(t *testing.T) {
+	data := "P2\n# a comment\n3 2 # trailing\n# another\n15\n0 5 15\n15 10 0\n"
+	got, err := NewNetpbmDecoder(FormatPGM).Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix := got.Pixels()
+	if pix.Rect.Size() != stdimage.Pt(3, 2) {
+		t.Fatalf("size %v", pix.Rect.Size())
+	}
+	// A maxval of 15 is scaled up to 8 bits.
+	if v := pix.NRGBAAt(1, 0).R; v != 85 {
+		t.Errorf("5 of 15 decoded as %d, want 85", v)
+	}
+	if v := pix.NRGBAAt(0, 1).G; v != 255 {
+		t.Errorf("15 of 15 decoded as %d, want 255", v)
+	}
+}
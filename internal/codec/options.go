@@ -0,0 +1,260 @@
+package codec
+
+import (
+	"compress/zlib"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"photoapp/internal/image"
+)
+
+// ChromaSubsampling selects how JPEG chroma planes are downsampled.
+type ChromaSubsampling int
+
+const (
+	ChromaSubsampling420 ChromaSubsampling = iota // half width, half height (default)
+	ChromaSubsampling422                          // half width, full height
+	ChromaSubsampling444                          // full resolution
+)
+
+func (c ChromaSubsampling) String() string {
+	switch c {
+	case ChromaSubsampling422:
+		return "4:2:2"
+	case ChromaSubsampling444:
+		return "4:4:4"
+	default:
+		return "4:2:0"
+	}
+}
+
+// ParseChromaSubsampling parses "4:4:4", "4:2:2" or "4:2:0" (colons optional).
+func ParseChromaSubsampling(s string) (ChromaSubsampling, error) {
+	switch strings.ReplaceAll(strings.TrimSpace(s), ":", "") {
+	case "420", "":
+		return ChromaSubsampling420, nil
+	case "422":
+		return ChromaSubsampling422, nil
+	case "444":
+		return ChromaSubsampling444, nil
+	default:
+		return 0, fmt.Errorf("unknown chroma subsampling %q", s)
+	}
+}
+
+// CompressionLevel trades PNG and TIFF Deflate encoding speed for size.
+type CompressionLevel int
+
+const (
+	CompressionDefault CompressionLevel = iota
+	CompressionNone
+	CompressionFast
+	CompressionBest
+)
+
+func (c CompressionLevel) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionFast:
+		return "fast"
+	case CompressionBest:
+		return "best"
+	default:
+		return "default"
+	}
+}
+
+// ParseCompressionLevel parses "default", "none", "fast" or "best".
+func ParseCompressionLevel(s string) (CompressionLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "default", "":
+		return CompressionDefault, nil
+	case "none":
+		return CompressionNone, nil
+	case "fast":
+		return CompressionFast, nil
+	case "best":
+		return CompressionBest, nil
+	default:
+		return 0, fmt.Errorf("unknown compression level %q", s)
+	}
+}
+
+func (c CompressionLevel) png() png.CompressionLevel {
+	switch c {
+	case CompressionNone:
+		return png.NoCompression
+	case CompressionFast:
+		return png.BestSpeed
+	case CompressionBest:
+		return png.BestCompression
+	default:
+		return png.DefaultCompression
+	}
+}
+
+func (c CompressionLevel) zlib() int {
+	switch c {
+	case CompressionNone:
+		return zlib.NoCompression
+	case CompressionFast:
+		return zlib.BestSpeed
+	case CompressionBest:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
+
+// TIFFCompression selects the scheme used for TIFF strips and tiles.
+type TIFFCompression int
+
+const (
+	TIFFCompressionLZW     TIFFCompression = iota // LZW with horizontal differencing (default)
+	TIFFCompressionDeflate                        // zlib with horizontal differencing
+	TIFFCompressionNone                           // uncompressed
+)
+
+func (c TIFFCompression) String() string {
+	switch c {
+	case TIFFCompressionDeflate:
+		return "deflate"
+	case TIFFCompressionNone:
+		return "none"
+	default:
+		return "lzw"
+	}
+}
+
+// ParseTIFFCompression parses "lzw", "deflate" (or "zip") or "none".
+func ParseTIFFCompression(s string) (TIFFCompression, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "lzw", "":
+		return TIFFCompressionLZW, nil
+	case "deflate", "zip":
+		return TIFFCompressionDeflate, nil
+	case "none":
+		return TIFFCompressionNone, nil
+	default:
+		return 0, fmt.Errorf("unknown TIFF compression %q", s)
+	}
+}
+
+// EncodeOptions tunes an encoder. Encoders ignore fields that do not apply to
+// their format, and a nil or zero-valued EncodeOptions selects the defaults.
+type EncodeOptions struct {
+	Quality           int               // JPEG quality 1-100; 0 means jpeg.DefaultQuality
+	ChromaSubsampling ChromaSubsampling // JPEG chroma downsampling
+	Progressive       bool              // JPEG: write a progressive file; buffers the whole image while encoding
+	CompressionLevel  CompressionLevel  // PNG and TIFF Deflate effort
+	NumColors         int               // GIF palette size 2-256; 0 means 256
+	Quantizer         image.Quantizer   // GIF and BMP RLE palette selection
+	Dither            image.Dither      // GIF and BMP RLE dithering onto the palette
+	NoDither          bool              // GIF and BMP RLE: map to the palette without dithering, overriding Dither
+	Plain             bool              // Netpbm: write the ASCII variant (P1-P3)
+	RLE               bool              // BMP: write 8-bit run-length encoding with a quantized palette
+	TIFFCompression   TIFFCompression   // TIFF strip/tile compression
+	SixteenBit        bool              // TIFF: write 16 bits per channel
+	TileSize          int               // TIFF: square tile edge, a multiple of 16; 0 writes strips
+}
+
+// quality returns the effective JPEG quality.
+func (o *EncodeOptions) quality() (int, error) {
+	if o == nil || o.Quality == 0 {
+		return jpeg.DefaultQuality, nil
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return 0, fmt.Errorf("quality %d out of range [1, 100]", o.Quality)
+	}
+	return o.Quality, nil
+}
+
+func (o *EncodeOptions) subsampling() ChromaSubsampling {
+	if o == nil {
+		return ChromaSubsampling420
+	}
+	return o.ChromaSubsampling
+}
+
+func (o *EncodeOptions) progressive() bool {
+	return o != nil && o.Progressive
+}
+
+func (o *EncodeOptions) compression() CompressionLevel {
+	if o == nil {
+		return CompressionDefault
+	}
+	return o.CompressionLevel
+}
+
+// numColors returns the effective GIF palette size.
+func (o *EncodeOptions) numColors() (int, error) {
+	if o == nil || o.NumColors == 0 {
+		return 256, nil
+	}
+	if o.NumColors < 2 || o.NumColors > 256 {
+		return 0, fmt.Errorf("palette size %d out of range [2, 256]", o.NumColors)
+	}
+	return o.NumColors, nil
+}
+
+func (o *EncodeOptions) quantizer() image.Quantizer {
+	if o == nil {
+		return image.QuantizeMedianCut
+	}
+	return o.Quantizer
+}
+
+func (o *EncodeOptions) dither() image.Dither {
+	switch {
+	case o == nil:
+		return image.DitherFloydSteinberg
+	case o.NoDither:
+		return image.DitherNone
+	}
+	return o.Dither
+}
+
+func (o *EncodeOptions) tiffCompression() TIFFCompression {
+	if o == nil {
+		return TIFFCompressionLZW
+	}
+	return o.TIFFCompression
+}
+
+// tileSize returns the TIFF tile edge, or 0 for strips.
+func (o *EncodeOptions) tileSize() (int, error) {
+	if o == nil || o.TileSize == 0 {
+		return 0, nil
+	}
+	if o.TileSize < 16 || o.TileSize%16 != 0 || o.TileSize > 0xFFFF {
+		return 0, fmt.Errorf("tile size %d is not a positive multiple of 16", o.TileSize)
+	}
+	return o.TileSize, nil
+}
+
+// DecodeOptions tunes decoding through a Registry. A nil DecodeOptions
+// selects the defaults.
+type DecodeOptions struct {
+	AutoOrient    bool // turn pixels upright per the EXIF orientation and reset the tag
+	ConvertToSRGB bool // convert pixels with a matrix/TRC ICC profile to sRGB; other profiles are kept
+}
+
+// apply post-processes a decoded image according to o.
+func (o *DecodeOptions) apply(img image.Image) image.Image {
+	if o == nil {
+		return img
+	}
+	if o.ConvertToSRGB {
+		if converted, err := image.ToSRGB(img); err == nil {
+			img = converted
+		}
+	}
+	if o.AutoOrient {
+		img = image.Upright(img)
+	}
+	return img
+}
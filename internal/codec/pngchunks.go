@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	pngSignature = "\x89PNG\r\n\x1a\n"
+
+	// pngHeaderLen covers the signature and the IHDR chunk, which always
+	// has 13 data bytes. Ancillary chunks are inserted right after it.
+	pngHeaderLen = 8 + 12 + 13
+
+	// maxPNGChunk bounds the ancillary chunks read into memory.
+	maxPNGChunk = 16 << 20
+
+	pngXMPKeyword = "XML:com.adobe.xmp"
+
+	// pngICCName names the embedded profile; readers ignore it.
+	pngICCName = "ICC Profile"
+)
+
+// pngChunk is an ancillary chunk from the part of a PNG before the image data.
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGHeader collects the chunks that precede the first IDAT and returns
+// a reader replaying the complete stream for the pixel decoder. Malformed
+// input is not an error here; the pixel decoder reports it.
+func readPNGHeader(r io.Reader) ([]pngChunk, io.Reader) {
+	br := bufio.NewReader(r)
+	var head bytes.Buffer
+	tr := io.TeeReader(br, &head)
+	replay := func() io.Reader { return io.MultiReader(&head, br) }
+
+	var sig [8]byte
+	if _, err := io.ReadFull(tr, sig[:]); err != nil || string(sig[:]) != pngSignature {
+		return nil, replay()
+	}
+	var chunks []pngChunk
+	for {
+		var h [8]byte
+		if _, err := io.ReadFull(tr, h[:]); err != nil {
+			return chunks, replay()
+		}
+		n := binary.BigEndian.Uint32(h[:4])
+		typ := string(h[4:])
+		if typ == "IDAT" || typ == "IEND" || n > maxPNGChunk {
+			return chunks, replay()
+		}
+		data := make([]byte, n+4) // data and CRC
+		if _, err := io.ReadFull(tr, data); err != nil {
+			return chunks, replay()
+		}
+		chunks = append(chunks, pngChunk{typ: typ, data: data[:n]})
+	}
+}
+
+// pngChunkWriter passes a PNG stream through, inserting extra chunks right
+// after IHDR.
+type pngChunkWriter struct {
+	w      io.Writer
+	chunks []pngChunk
+	header int // header bytes still to pass through before inserting
+}
+
+func newPNGChunkWriter(w io.Writer, chunks []pngChunk) *pngChunkWriter {
+	return &pngChunkWriter{w: w, chunks: chunks, header: pngHeaderLen}
+}
+
+func (p *pngChunkWriter) Write(b []byte) (int, error) {
+	if p.header == 0 {
+		return p.w.Write(b)
+	}
+	n := min(p.header, len(b))
+	if _, err := p.w.Write(b[:n]); err != nil {
+		return 0, err
+	}
+	p.header -= n
+	if p.header > 0 {
+		return n, nil
+	}
+	for _, c := range p.chunks {
+		if err := writePNGChunk(p.w, c); err != nil {
+			return n, err
+		}
+	}
+	m, err := p.w.Write(b[n:])
+	return n + m, err
+}
+
+func writePNGChunk(w io.Writer, c pngChunk) error {
+	buf := make([]byte, 0, 12+len(c.data))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(c.data)))
+	buf = append(buf, c.typ...)
+	buf = append(buf, c.data...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	_, err := w.Write(buf)
+	return err
+}
+
+// iTXtChunk builds an uncompressed international text chunk.
+func iTXtChunk(keyword string, text []byte) pngChunk {
+	data := make([]byte, 0, len(keyword)+5+len(text))
+	data = append(data, keyword...)
+	data = append(data, 0, 0, 0) // separator, compression flag, method
+	data = append(data, 0, 0)    // empty language tag and translated keyword
+	return pngChunk{typ: "iTXt", data: append(data, text...)}
+}
+
+// findITXt returns the text of the first iTXt chunk with keyword.
+func findITXt(chunks []pngChunk, keyword string) []byte {
+	for _, c := range chunks {
+		if c.typ != "iTXt" || !bytes.HasPrefix(c.data, []byte(keyword+"\x00")) {
+			continue
+		}
+		rest := c.data[len(keyword)+1:]
+		if len(rest) < 2 {
+			return nil
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for i := 0; i < 2; i++ { // language tag, translated keyword
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return nil
+			}
+			rest = rest[end+1:]
+		}
+		if !compressed {
+			return rest
+		}
+		return inflate(rest)
+	}
+	return nil
+}
+
+// iCCPChunk builds an embedded ICC profile chunk.
+func iCCPChunk(profile []byte) pngChunk {
+	var b bytes.Buffer
+	b.WriteString(pngICCName)
+	b.Write([]byte{0, 0}) // separator, compression method
+	zw := zlib.NewWriter(&b)
+	zw.Write(profile)
+	zw.Close()
+	return pngChunk{typ: "iCCP", data: b.Bytes()}
+}
+
+// findICCP returns the decompressed profile of the iCCP chunk, if any.
+func findICCP(chunks []pngChunk) []byte {
+	for _, c := range chunks {
+		if c.typ != "iCCP" {
+			continue
+		}
+		end := bytes.IndexByte(c.data, 0)
+		if end < 0 || end+2 > len(c.data) {
+			return nil
+		}
+		return inflate(c.data[end+2:])
+	}
+	return nil
+}
+
+// inflate decompresses zlib data from an ancillary chunk, returning nil if
+// it is damaged.
+func inflate(data []byte) []byte {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	text, err := io.ReadAll(io.LimitReader(zr, maxPNGChunk))
+	if err != nil {
+		return nil
+	}
+	return text
+}
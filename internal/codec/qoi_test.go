@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"bytes"
+	stdimage "image"
+	"io"
+	"sync"
+	"testing"
+
+	"photoapp/internal/image"
+)
+
+func TestQOIRoundTrip(t *testing.T) {
+	opaque := photo(67, 41)
+	transparent := photo(67, 41)
+	for x := 0; x < 67; x++ {
+		transparent.Pix[transparent.PixOffset(x, 7)+3] = uint8(x * 3)
+	}
+	// Long runs and repeated colors exercise the run and index opcodes.
+	flat := stdimage.NewNRGBA(stdimage.Rect(0, 0, 200, 3))
+	for i := 0; i < len(flat.Pix); i += 4 {
+		flat.Pix[i], flat.Pix[i+3] = byte(i/4%3*100), 0xFF
+	}
+
+	for name, src := range map[string]*stdimage.NRGBA{"opaque": opaque, "transparent": transparent, "flat": flat} {
+		data, err := NewQOIEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := NewQOIDecoder().Decode(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if meta := got.Metadata(); meta.Width != src.Rect.Dx() || meta.Height != src.Rect.Dy() || meta.Format != FormatQOI {
+			t.Errorf("%s: decoded %dx%d %s", name, meta.Width, meta.Height, meta.Format)
+		}
+		if !bytes.Equal(got.Pixels().Pix, src.Pix) {
+			t.Errorf("%s: pixels differ after round trip", name)
+		}
+	}
+}
+
+// benchPhoto is a 12 MP raster of gradients with sensor-like noise, so that
+// neither codec gets an unrealistically easy image.
+var benchPhoto = sync.OnceValue(func() image.Image {
+	pix := photo(4000, 3000)
+	seed := uint32(1)
+	for i := 0; i < len(pix.Pix); i++ {
+		if i%4 == 3 {
+			continue
+		}
+		seed = seed*1664525 + 1013904223
+		pix.Pix[i] = uint8(min(255, max(0, int(pix.Pix[i])+int(seed>>29)-4)))
+	}
+	return image.NewBasicImage("bench", pix, image.ImageMetadata{})
+})
+
+func benchmarkEncode(b *testing.B, e Encoder) {
+	img := benchPhoto()
+	data, err := e.Encode(img, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(img.Data())))
+	for b.Loop() {
+		if err := e.EncodeTo(io.Discard, img, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data))/float64(len(img.Data())), "ratio")
+}
+
+func benchmarkDecode(b *testing.B, e Encoder, d Decoder) {
+	img := benchPhoto()
+	data, err := e.Encode(img, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(img.Data())))
+	for b.Loop() {
+		if _, err := d.Decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQOIEncode(b *testing.B) {
+	benchmarkEncode(b, NewQOIEncoder())
+}
+
+func BenchmarkPNGEncode(b *testing.B) {
+	benchmarkEncode(b, NewPNGEncoder())
+}
+
+func BenchmarkQOIDecode(b *testing.B) {
+	benchmarkDecode(b, NewQOIEncoder(), NewQOIDecoder())
+}
+
+func BenchmarkPNGDecode(b *testing.B) {
+	benchmarkDecode(b, NewPNGEncoder(), NewPNGDecoder())
+}
@@ -0,0 +1,282 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"photoapp/internal/image"
+)
+
+// UnknownFormatError is returned when no registered format matches a name,
+// extension or byte signature.
+type UnknownFormatError struct {
+	Format string // empty when detection by content failed
+}
+
+func (e *UnknownFormatError) Error() string {
+	if e.Format == "" {
+		return "unknown image format: no signature matched"
+	}
+	return fmt.Sprintf("unknown image format: %s", e.Format)
+}
+
+// FormatSpec describes a format and the codecs that handle it.
+// Either Encoder or Decoder may be nil for read-only or write-only formats.
+type FormatSpec struct {
+	Name       string
+	Extensions []string // without the leading dot, e.g. "jpg"
+	Magic      [][]byte // leading byte signatures used for content sniffing
+	Encoder    Encoder
+	Decoder    Decoder
+	EmbedsXMP  bool // the codecs read and write embedded XMP packets
+}
+
+// Registry maps format names, file extensions and signatures to codecs.
+type Registry struct {
+	mu      sync.RWMutex
+	formats map[string]FormatSpec
+	order   []string // registration order, used for sniffing
+}
+
+// NewRegistry creates an empty codec registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		formats: make(map[string]FormatSpec),
+	}
+}
+
+var defaultRegistry = newBuiltinRegistry()
+
+// DefaultRegistry returns the registry holding all built-in formats.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a format. Names are case-insensitive and must be unique.
+func (r *Registry) Register(spec FormatSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("format name cannot be empty")
+	}
+	if spec.Encoder == nil && spec.Decoder == nil {
+		return fmt.Errorf("format %s has neither encoder nor decoder", spec.Name)
+	}
+	key := strings.ToLower(spec.Name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.formats[key]; ok {
+		return fmt.Errorf("format %s already registered", spec.Name)
+	}
+	r.formats[key] = spec
+	r.order = append(r.order, key)
+	return nil
+}
+
+// Lookup finds a format by name or, failing that, by file extension.
+func (r *Registry) Lookup(name string) (FormatSpec, error) {
+	key := strings.ToLower(strings.TrimPrefix(name, "."))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if spec, ok := r.formats[key]; ok {
+		return spec, nil
+	}
+	for _, k := range r.order {
+		spec := r.formats[k]
+		for _, ext := range spec.Extensions {
+			if strings.EqualFold(ext, key) {
+				return spec, nil
+			}
+		}
+	}
+	return FormatSpec{}, &UnknownFormatError{Format: name}
+}
+
+// Encoder returns the encoder for a format name or extension.
+func (r *Registry) Encoder(format string) (Encoder, error) {
+	spec, err := r.Lookup(format)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Encoder == nil {
+		return nil, fmt.Errorf("format %s cannot be encoded", spec.Name)
+	}
+	return spec.Encoder, nil
+}
+
+// Decoder returns the decoder for a format name or extension.
+func (r *Registry) Decoder(format string) (Decoder, error) {
+	spec, err := r.Lookup(format)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Decoder == nil {
+		return nil, fmt.Errorf("format %s cannot be decoded", spec.Name)
+	}
+	return spec.Decoder, nil
+}
+
+// Sniff detects the format of data from its leading signature bytes.
+func (r *Registry) Sniff(data []byte) (FormatSpec, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.order {
+		spec := r.formats[k]
+		for _, magic := range spec.Magic {
+			if bytes.HasPrefix(data, magic) {
+				return spec, nil
+			}
+		}
+	}
+	return FormatSpec{}, &UnknownFormatError{}
+}
+
+// DecodeAny detects the format of data and decodes it.
+// A nil opts selects the defaults.
+func (r *Registry) DecodeAny(data []byte, opts *DecodeOptions) (image.Image, error) {
+	spec, err := r.Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Decoder == nil {
+		return nil, fmt.Errorf("format %s cannot be decoded", spec.Name)
+	}
+	img, err := spec.Decoder.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return opts.apply(img), nil
+}
+
+// DecodeAnyFrom detects the format of a stream from its leading bytes and
+// decodes it without buffering the whole stream first.
+// A nil opts selects the defaults.
+func (r *Registry) DecodeAnyFrom(rd io.Reader, opts *DecodeOptions) (image.Image, error) {
+	br := bufio.NewReader(rd)
+	head, err := br.Peek(r.maxMagicLen())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("read signature: %w", err)
+	}
+	spec, err := r.Sniff(head)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Decoder == nil {
+		return nil, fmt.Errorf("format %s cannot be decoded", spec.Name)
+	}
+	img, err := spec.Decoder.DecodeFrom(br)
+	if err != nil {
+		return nil, err
+	}
+	return opts.apply(img), nil
+}
+
+func (r *Registry) maxMagicLen() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 1
+	for _, spec := range r.formats {
+		for _, magic := range spec.Magic {
+			n = max(n, len(magic))
+		}
+	}
+	return n
+}
+
+// Formats returns the registered format names in sorted order.
+func (r *Registry) Formats() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.formats))
+	for _, spec := range r.formats {
+		names = append(names, spec.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newBuiltinRegistry() *Registry {
+	r := NewRegistry()
+	for _, spec := range builtinFormats() {
+		if err := r.Register(spec); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+func builtinFormats() []FormatSpec {
+	return []FormatSpec{
+		{
+			Name:       FormatJPEG,
+			Extensions: []string{"jpg", "jpeg", "jpe"},
+			Magic:      [][]byte{{0xFF, 0xD8, 0xFF}},
+			Encoder:    NewJPEGEncoder(),
+			Decoder:    NewJPEGDecoder(),
+			EmbedsXMP:  true,
+		},
+		{
+			Name:       FormatPNG,
+			Extensions: []string{"png"},
+			Magic:      [][]byte{[]byte("\x89PNG\r\n\x1a\n")},
+			Encoder:    NewPNGEncoder(),
+			Decoder:    NewPNGDecoder(),
+			EmbedsXMP:  true,
+		},
+		{
+			Name:       FormatGIF,
+			Extensions: []string{"gif"},
+			Magic:      [][]byte{[]byte("GIF87a"), []byte("GIF89a")},
+			Encoder:    NewGIFEncoder(),
+			Decoder:    NewGIFDecoder(),
+		},
+		{
+			Name:       FormatBMP,
+			Extensions: []string{"bmp", "dib"},
+			Magic:      [][]byte{[]byte("BM")},
+			Encoder:    NewBMPEncoder(),
+			Decoder:    NewBMPDecoder(),
+		},
+		{
+			Name:       FormatTIFF,
+			Extensions: []string{"tif", "tiff"},
+			Magic:      [][]byte{[]byte("II*\x00"), []byte("MM\x00*")},
+			Encoder:    NewTIFFEncoder(),
+			Decoder:    NewTIFFDecoder(),
+			EmbedsXMP:  true,
+		},
+		{
+			Name:       FormatQOI,
+			Extensions: []string{"qoi"},
+			Magic:      [][]byte{[]byte("qoif")},
+			Encoder:    NewQOIEncoder(),
+			Decoder:    NewQOIDecoder(),
+		},
+		{
+			Name:       FormatPBM,
+			Extensions: []string{"pbm"},
+			Magic:      [][]byte{[]byte("P1"), []byte("P4")},
+			Encoder:    NewPBMEncoder(),
+			Decoder:    NewNetpbmDecoder(FormatPBM),
+		},
+		{
+			Name:       FormatPGM,
+			Extensions: []string{"pgm"},
+			Magic:      [][]byte{[]byte("P2"), []byte("P5")},
+			Encoder:    NewPGMEncoder(),
+			Decoder:    NewNetpbmDecoder(FormatPGM),
+		},
+		{
+			Name:       FormatPPM,
+			Extensions: []string{"ppm", "pnm"},
+			Magic:      [][]byte{[]byte("P3"), []byte("P6")},
+			Encoder:    NewPPMEncoder(),
+			Decoder:    NewNetpbmDecoder(FormatPPM),
+		},
+	}
+}
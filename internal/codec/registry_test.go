@@ -0,0 +1,164 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"photoapp/internal/image"
+)
+
+func TestSniffBuiltinFormats(t *testing.T) {
+	src := image.NewBasicImage("src", photo(9, 7), image.ImageMetadata{})
+	reg := DefaultRegistry()
+	for _, name := range reg.Formats() {
+		spec, err := reg.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every signature selects its own format.
+		for _, magic := range spec.Magic {
+			got, err := reg.Sniff(append(append([]byte(nil), magic...), "\n0000"...))
+			if err != nil || got.Name != spec.Name {
+				t.Errorf("%s: signature %q sniffed as %q, %v", name, magic, got.Name, err)
+			}
+		}
+
+		// Real files, in every variant with a different signature, decode
+		// through the format they were written in.
+		variants := []*EncodeOptions{nil}
+		switch name {
+		case FormatPBM, FormatPGM, FormatPPM:
+			variants = append(variants, &EncodeOptions{Plain: true})
+		}
+		for _, opts := range variants {
+			data, err := spec.Encoder.Encode(src, opts)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if got, err := reg.Sniff(data); err != nil || got.Name != name {
+				t.Errorf("%s file %q sniffed as %q, %v", name, data[:4], got.Name, err)
+			}
+			img, err := reg.DecodeAny(data, nil)
+			if err != nil || img.Metadata().Format != name {
+				t.Errorf("%s: DecodeAny: %v", name, err)
+			}
+			img, err = reg.DecodeAnyFrom(bytes.NewReader(data), nil)
+			if err != nil || img.Metadata().Format != name {
+				t.Errorf("%s: DecodeAnyFrom: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestSniffUnknown(t *testing.T) {
+	inputs := []string{
+		"",
+		"P",             // Netpbm magic is two bytes
+		"P0\n1 1\n",     // no such Netpbm type
+		"P7\nWIDTH 1\n", // PAM, not supported
+		"p6\n1 1\n255\n",
+		"PK\x03\x04",
+		"GIF88a",
+		"\xFF\xD8", // truncated JPEG signature
+		"BN",
+		"qoi",
+	}
+	for _, in := range inputs {
+		var unknown *UnknownFormatError
+		if spec, err := DefaultRegistry().Sniff([]byte(in)); !errors.As(err, &unknown) || unknown.Format != "" {
+			t.Errorf("%q sniffed as %q, %v", in, spec.Name, err)
+		}
+		if _, err := DefaultRegistry().DecodeAny([]byte(in), nil); !errors.As(err, &unknown) {
+			t.Errorf("DecodeAny(%q): %v", in, err)
+		}
+		if _, err := DefaultRegistry().DecodeAnyFrom(bytes.NewReader([]byte(in)), nil); !errors.As(err, &unknown) {
+			t.Errorf("DecodeAnyFrom(%q): %v", in, err)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := map[string]string{
+		"jpeg": FormatJPEG,
+		"JPEG": FormatJPEG,
+		"jpg":  FormatJPEG,
+		".jpg": FormatJPEG,
+		".JPE": FormatJPEG,
+		"Tiff": FormatTIFF,
+		".tif": FormatTIFF,
+		"dib":  FormatBMP,
+		".pnm": FormatPPM,
+		"qoi":  FormatQOI,
+		".Png": FormatPNG,
+	}
+	for in, want := range tests {
+		if spec, err := DefaultRegistry().Lookup(in); err != nil || spec.Name != want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", in, spec.Name, err, want)
+		}
+	}
+
+	for _, in := range []string{"webp", ".heic", "", ".", "jp"} {
+		var unknown *UnknownFormatError
+		if _, err := DefaultRegistry().Lookup(in); !errors.As(err, &unknown) || unknown.Format != in {
+			t.Errorf("Lookup(%q): %v", in, err)
+		}
+		if _, err := DefaultRegistry().Encoder(in); !errors.As(err, &unknown) {
+			t.Errorf("Encoder(%q): %v", in, err)
+		}
+		if _, err := DefaultRegistry().Decoder(in); !errors.As(err, &unknown) {
+			t.Errorf("Decoder(%q): %v", in, err)
+		}
+	}
+}
+
+// textDecoder decodes a made-up format: "TXT1" followed by one gray value.
+type textDecoder struct{}
+
+func (textDecoder) Decode(data []byte) (image.Image, error) {
+	return textDecoder{}.DecodeFrom(bytes.NewReader(data))
+}
+
+func (textDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil || len(data) != 5 {
+		return nil, errors.New("invalid TXT1 data")
+	}
+	pix := photo(1, 1)
+	pix.Pix[0], pix.Pix[1], pix.Pix[2] = data[4], data[4], data[4]
+	return image.NewBasicImage("txt", pix, image.ImageMetadata{Format: "TXT1"}), nil
+}
+
+func (textDecoder) Format() string { return "TXT1" }
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	spec := FormatSpec{Name: "TXT1", Extensions: []string{"txt1"}, Magic: [][]byte{[]byte("TXT1")}, Decoder: textDecoder{}}
+	if err := r.Register(spec); err != nil {
+		t.Fatal(err)
+	}
+	img, err := r.DecodeAny([]byte("TXT1\x80"), nil)
+	if err != nil || img.Pixels().Pix[0] != 0x80 {
+		t.Errorf("decoded %v, %v", img, err)
+	}
+	if _, err := r.Decoder(".TXT1"); err != nil {
+		t.Error(err)
+	}
+	if _, err := r.Encoder("txt1"); err == nil {
+		t.Error("decode-only format returned an encoder")
+	}
+
+	for _, bad := range []FormatSpec{
+		{Name: "txt1", Decoder: textDecoder{}}, // names are case-insensitive
+		{Name: "", Decoder: textDecoder{}},
+		{Name: "nocodec"},
+	} {
+		if err := r.Register(bad); err == nil {
+			t.Errorf("registered %q", bad.Name)
+		}
+	}
+	if got := r.Formats(); len(got) != 1 || got[0] != "TXT1" {
+		t.Errorf("formats %v", got)
+	}
+}
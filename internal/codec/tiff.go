@@ -0,0 +1,710 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	stdimage "image"
+	"io"
+
+	"photoapp/internal/exif"
+	"photoapp/internal/image"
+)
+
+const FormatTIFF = "TIFF"
+
+// Baseline TIFF tags.
+const (
+	tagNewSubfileType   = 254
+	tagImageWidth       = 256
+	tagImageLength      = 257
+	tagBitsPerSample    = 258
+	tagCompression      = 259
+	tagPhotometric      = 262
+	tagImageDescription = 270
+	tagStripOffsets     = 273
+	tagSamplesPerPixel  = 277
+	tagRowsPerStrip     = 278
+	tagStripByteCounts  = 279
+	tagXResolution      = 282
+	tagYResolution      = 283
+	tagPlanarConfig     = 284
+	tagResolutionUnit   = 296
+	tagPageNumber       = 297
+	tagPredictor        = 317
+	tagColorMap         = 320
+	tagTileWidth        = 322
+	tagTileLength       = 323
+	tagTileOffsets      = 324
+	tagTileByteCounts   = 325
+	tagExtraSamples     = 338
+	tagSampleFormat     = 339
+	tagXMP              = 700
+	tagICCProfile       = 34675
+)
+
+// Compression schemes.
+const (
+	tiffCompressionNone       = 1
+	tiffCompressionLZW        = 5
+	tiffCompressionDeflate    = 8
+	tiffCompressionPackBits   = 32773
+	tiffCompressionDeflateOld = 32946
+)
+
+// Photometric interpretations.
+const (
+	tiffWhiteIsZero = 0
+	tiffBlackIsZero = 1
+	tiffRGB         = 2
+	tiffPalette     = 3
+)
+
+// Extra sample kinds.
+const (
+	tiffAssociatedAlpha   = 1
+	tiffUnassociatedAlpha = 2
+)
+
+const (
+	tiffPredictorHorizontal = 2
+	tiffSubfileReduced      = 1 // NewSubfileType bit for thumbnails
+	tiffSubfilePage         = 2 // NewSubfileType bit for one page of many
+	tiffStripBytes          = 8 << 10
+	maxTIFFPages            = 1 << 12
+)
+
+// MultiPageEncoder is implemented by encoders whose format can hold several
+// independent pages.
+type MultiPageEncoder interface {
+	EncodePages(w io.Writer, pages []image.Image, opts *EncodeOptions) error
+}
+
+// MultiPageDecoder is implemented by decoders whose format can hold several
+// independent pages.
+type MultiPageDecoder interface {
+	DecodePages(r io.Reader) ([]image.Image, error)
+}
+
+// TIFFEncoder writes baseline little-endian TIFF: RGB or RGBA (unassociated
+// alpha, only when the image has transparency) at 8 or 16 bits per channel,
+// in strips or tiles, uncompressed or LZW/Deflate with horizontal differencing.
+type TIFFEncoder struct{}
+
+// NewTIFFEncoder creates a new TIFF encoder
+func NewTIFFEncoder() *TIFFEncoder {
+	return &TIFFEncoder{}
+}
+
+// Encode encodes the image as a single-page TIFF
+func (e *TIFFEncoder) Encode(img image.Image, opts *EncodeOptions) ([]byte, error) {
+	return encodeBytes(e, img, opts)
+}
+
+// EncodeTo streams the image to w as a single-page TIFF
+func (e *TIFFEncoder) EncodeTo(w io.Writer, img image.Image, opts *EncodeOptions) error {
+	return e.EncodePages(w, []image.Image{img}, opts)
+}
+
+// EncodePages streams a multi-page TIFF to w. Only one page's compressed
+// data is held in memory at a time; each directory precedes its EXIF
+// sub-directories and pixel data so that offsets are known before anything
+// is written.
+func (e *TIFFEncoder) EncodePages(w io.Writer, pages []image.Image, opts *EncodeOptions) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("encode TIFF: no pages")
+	}
+	if len(pages) > 0xFFFF {
+		return fmt.Errorf("encode TIFF: too many pages")
+	}
+	tile, err := opts.tileSize()
+	if err != nil {
+		return fmt.Errorf("encode TIFF: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("II*\x00\x08\x00\x00\x00") // first directory follows the header
+
+	pos := uint64(8)
+	for i, page := range pages {
+		fields, chunks, err := tiffPage(page, i, len(pages), tile, opts)
+		if err != nil {
+			return fmt.Errorf("encode TIFF: page %d: %w", i, err)
+		}
+
+		offsetTag := uint16(tagStripOffsets)
+		if tile > 0 {
+			offsetTag = tagTileOffsets
+		}
+		offsets := make([]uint32, len(chunks))
+		offsetsAt := len(fields)
+		fields = append(fields, exif.LongField(offsetTag, offsets...))
+
+		// EXIF sub-directories sit between the page directory and its data.
+		x := exifFor(page.Metadata())
+		var sub []byte
+		pointersAt := len(fields)
+		if x != nil {
+			fields = append(fields, x.IFD0()...)
+			pointers, _ := x.SubIFDs(0)
+			pointersAt = len(fields)
+			fields = append(fields, pointers...)
+		}
+		subStart := pos + uint64(exif.IFDSize(fields))
+		if x != nil {
+			var pointers []exif.Field
+			pointers, sub = x.SubIFDs(uint32(subStart))
+			copy(fields[pointersAt:], pointers)
+		}
+
+		dataStart := subStart + uint64(len(sub))
+		end := dataStart
+		for j, c := range chunks {
+			offsets[j] = uint32(end)
+			end += uint64(len(c))
+		}
+		pad := end & 1 // keep the next directory word-aligned
+		end += pad
+		if end > 0xFFFFFFFF {
+			return fmt.Errorf("encode TIFF: file exceeds 4 GiB")
+		}
+		fields[offsetsAt] = exif.LongField(offsetTag, offsets...)
+
+		next := uint32(0)
+		if i < len(pages)-1 {
+			next = uint32(end)
+		}
+		bw.Write(exif.EncodeIFD(fields, uint32(pos), next))
+		bw.Write(sub)
+		for _, c := range chunks {
+			bw.Write(c)
+		}
+		if pad == 1 {
+			bw.WriteByte(0)
+		}
+		pos = end
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("encode TIFF: %w", err)
+	}
+	return nil
+}
+
+// tiffPage compresses one page and returns its directory fields, minus the
+// chunk offsets which depend on where the directory lands.
+func tiffPage(page image.Image, index, count, tile int, opts *EncodeOptions) ([]exif.Field, [][]byte, error) {
+	pix := page.Pixels()
+	width, height := pix.Rect.Dx(), pix.Rect.Dy()
+	if width < 1 || height < 1 {
+		return nil, nil, fmt.Errorf("empty image")
+	}
+	spp := 3
+	if hasTransparency(pix) {
+		spp = 4
+	}
+	bps := 8
+	if opts != nil && opts.SixteenBit {
+		bps = 16
+	}
+
+	var compression uint16
+	var compress func([]byte) ([]byte, error)
+	switch opts.tiffCompression() {
+	case TIFFCompressionNone:
+		compression = tiffCompressionNone
+	case TIFFCompressionDeflate:
+		compression = tiffCompressionDeflate
+		level := opts.compression().zlib()
+		compress = func(raw []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			zw, err := zlib.NewWriterLevel(&buf, level)
+			if err != nil {
+				return nil, err
+			}
+			zw.Write(raw)
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+	default:
+		compression = tiffCompressionLZW
+		compress = func(raw []byte) ([]byte, error) { return lzwEncode(raw), nil }
+	}
+
+	bitsPerSample := make([]uint16, spp)
+	for i := range bitsPerSample {
+		bitsPerSample[i] = uint16(bps)
+	}
+	fields := []exif.Field{
+		exif.LongField(tagImageWidth, uint32(width)),
+		exif.LongField(tagImageLength, uint32(height)),
+		exif.ShortField(tagBitsPerSample, bitsPerSample...),
+		exif.ShortField(tagCompression, compression),
+		exif.ShortField(tagPhotometric, tiffRGB),
+		exif.ShortField(tagSamplesPerPixel, uint16(spp)),
+		exif.RationalField(tagXResolution, 72, 1),
+		exif.RationalField(tagYResolution, 72, 1),
+		exif.ShortField(tagPlanarConfig, 1),
+		exif.ShortField(tagResolutionUnit, 2),
+	}
+	if spp == 4 {
+		fields = append(fields, exif.ShortField(tagExtraSamples, tiffUnassociatedAlpha))
+	}
+	if compress != nil {
+		fields = append(fields, exif.ShortField(tagPredictor, tiffPredictorHorizontal))
+	}
+	if count > 1 {
+		fields = append(fields,
+			exif.LongField(tagNewSubfileType, tiffSubfilePage),
+			exif.ShortField(tagPageNumber, uint16(index), uint16(count)))
+	}
+	meta := page.Metadata()
+	if meta.Description != "" {
+		fields = append(fields, exif.ASCIIField(tagImageDescription, meta.Description))
+	}
+	if packet := xmpPacket(meta); packet != nil {
+		fields = append(fields, exif.Field{Tag: tagXMP, Type: exif.TypeByte, Count: uint32(len(packet)), Value: packet})
+	}
+	if profile := iccProfile(meta); profile != nil {
+		fields = append(fields, exif.UndefinedField(tagICCProfile, profile))
+	}
+
+	// Chunks are tiles, padded at the right and bottom edges, or full-width
+	// strips of about tiffStripBytes each.
+	chunkW, chunkH := width, max(1, min(height, tiffStripBytes/(width*spp*bps/8)))
+	across, down := 1, (height+chunkH-1)/chunkH
+	if tile > 0 {
+		chunkW, chunkH = tile, tile
+		across, down = (width+tile-1)/tile, (height+tile-1)/tile
+		fields = append(fields,
+			exif.LongField(tagTileWidth, uint32(tile)),
+			exif.LongField(tagTileLength, uint32(tile)))
+	} else {
+		fields = append(fields, exif.LongField(tagRowsPerStrip, uint32(chunkH)))
+	}
+
+	rowBytes := chunkW * spp * bps / 8
+	chunks := make([][]byte, 0, across*down)
+	counts := make([]uint32, 0, across*down)
+	for ty := 0; ty < down; ty++ {
+		for tx := 0; tx < across; tx++ {
+			x0, y0 := tx*chunkW, ty*chunkH
+			rows := chunkH
+			if tile == 0 {
+				rows = min(chunkH, height-y0)
+			}
+			raw := make([]byte, rows*rowBytes)
+			for y := 0; y < rows && y0+y < height; y++ {
+				row := raw[y*rowBytes : (y+1)*rowBytes]
+				src := pix.Pix[(y0+y)*pix.Stride:]
+				for x := 0; x < chunkW && x0+x < width; x++ {
+					p := src[(x0+x)*4:]
+					for c := 0; c < spp; c++ {
+						if bps == 8 {
+							row[x*spp+c] = p[c]
+						} else {
+							binary.LittleEndian.PutUint16(row[2*(x*spp+c):], uint16(p[c])*0x101)
+						}
+					}
+				}
+				if compress != nil {
+					differenceRow(row, spp, bps)
+				}
+			}
+			chunk := raw
+			if compress != nil {
+				var err error
+				if chunk, err = compress(raw); err != nil {
+					return nil, nil, err
+				}
+			}
+			chunks = append(chunks, chunk)
+			counts = append(counts, uint32(len(chunk)))
+		}
+	}
+	countTag := uint16(tagStripByteCounts)
+	if tile > 0 {
+		countTag = tagTileByteCounts
+	}
+	fields = append(fields, exif.LongField(countTag, counts...))
+	return fields, chunks, nil
+}
+
+// differenceRow applies the horizontal differencing predictor to one
+// little-endian row in place.
+func differenceRow(row []byte, spp, bps int) {
+	if bps == 8 {
+		for i := len(row) - 1; i >= spp; i-- {
+			row[i] -= row[i-spp]
+		}
+		return
+	}
+	le := binary.LittleEndian
+	for i := len(row)/2 - 1; i >= spp; i-- {
+		le.PutUint16(row[2*i:], le.Uint16(row[2*i:])-le.Uint16(row[2*(i-spp):]))
+	}
+}
+
+// Format returns the format name
+func (e *TIFFEncoder) Format() string {
+	return FormatTIFF
+}
+
+// TIFFDecoder decodes baseline TIFF: bilevel, grayscale, palette and RGB
+// images at 1-16 bits per sample with optional alpha, stored in strips or
+// tiles, uncompressed or compressed with LZW, Deflate or PackBits.
+type TIFFDecoder struct{}
+
+// NewTIFFDecoder creates a new TIFF decoder
+func NewTIFFDecoder() *TIFFDecoder {
+	return &TIFFDecoder{}
+}
+
+// Decode decodes the first page of a TIFF
+func (d *TIFFDecoder) Decode(data []byte) (image.Image, error) {
+	pages, err := d.decodePages(data, 1)
+	if err != nil {
+		return nil, err
+	}
+	return pages[0], nil
+}
+
+// DecodeFrom decodes the first page of a TIFF from a stream. TIFF offsets
+// may point anywhere in the file, so the stream is read fully first.
+func (d *TIFFDecoder) DecodeFrom(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read TIFF: %w", err)
+	}
+	return d.Decode(data)
+}
+
+// DecodePages decodes every page of a TIFF. Reduced-resolution subfiles
+// (embedded thumbnails) are skipped. Each page's metadata carries its index
+// and the page count.
+func (d *TIFFDecoder) DecodePages(r io.Reader) ([]image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read TIFF: %w", err)
+	}
+	return d.decodePages(data, maxTIFFPages)
+}
+
+func (d *TIFFDecoder) decodePages(data []byte, limit int) ([]image.Image, error) {
+	t, off, err := exif.NewReader(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIFF data: %w", err)
+	}
+
+	// Walk the whole chain first so that every page knows the page count.
+	var dirs []exif.IFD
+	seen := make(map[uint32]bool)
+	for off != 0 && len(dirs) < maxTIFFPages {
+		if seen[off] {
+			return nil, fmt.Errorf("invalid TIFF data: directory loop at %d", off)
+		}
+		seen[off] = true
+		dir, next, err := t.ReadIFD(off)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIFF data: %w", err)
+		}
+		if t.Uint(dir, tagNewSubfileType, 0)&tiffSubfileReduced == 0 {
+			dirs = append(dirs, dir)
+		}
+		off = next
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("invalid TIFF data: no pages")
+	}
+
+	var pages []image.Image
+	for i, dir := range dirs {
+		if i == limit {
+			break
+		}
+		pix, err := decodeTIFFImage(t, dir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIFF data: page %d: %w", i, err)
+		}
+		metadata := image.ImageMetadata{
+			Format:      FormatTIFF,
+			Description: t.ASCII(dir, tagImageDescription),
+			Page:        i,
+		}
+		if len(dirs) > 1 {
+			metadata.Pages = len(dirs)
+		}
+		// EXIF is optional; a damaged block is ignored like in JPEG files.
+		if x, err := exif.FromIFD(t, dir); err == nil && x != nil {
+			applyEXIF(&metadata, x)
+			if metadata.CapturedAt.IsZero() {
+				metadata.CapturedAt = x.DateTime
+			}
+		}
+		if f, ok := dir[tagXMP]; ok {
+			applyXMPPacket(&metadata, f.Value)
+		}
+		if f, ok := dir[tagICCProfile]; ok {
+			applyICC(&metadata, f.Value)
+		}
+		id := fmt.Sprintf("decoded-tiff-%d", i)
+		pages = append(pages, image.NewBasicImage(id, pix, metadata))
+	}
+	return pages, nil
+}
+
+// Format returns the format name
+func (d *TIFFDecoder) Format() string {
+	return FormatTIFF
+}
+
+// decodeTIFFImage decodes the raster described by one directory.
+func decodeTIFFImage(t *exif.Reader, dir exif.IFD) (*stdimage.NRGBA, error) {
+	width := int(t.Uint(dir, tagImageWidth, 0))
+	height := int(t.Uint(dir, tagImageLength, 0))
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("bad dimensions %dx%d", width, height)
+	}
+	if width > maxPixels/height {
+		return nil, fmt.Errorf("image %dx%d too large", width, height)
+	}
+
+	spp := int(t.Uint(dir, tagSamplesPerPixel, 1))
+	bpsList := t.Uints(dir, tagBitsPerSample)
+	if len(bpsList) == 0 {
+		bpsList = []uint32{1}
+	}
+	bps := int(bpsList[0])
+	for _, b := range bpsList {
+		if int(b) != bps {
+			return nil, fmt.Errorf("mixed bits per sample %v", bpsList)
+		}
+	}
+	if t.Uint(dir, tagPlanarConfig, 1) != 1 {
+		return nil, fmt.Errorf("planar configuration is not supported")
+	}
+	if t.Uint(dir, tagSampleFormat, 1) != 1 {
+		return nil, fmt.Errorf("only unsigned integer samples are supported")
+	}
+
+	defaultPhotometric := uint32(tiffBlackIsZero)
+	if spp >= 3 {
+		defaultPhotometric = tiffRGB
+	}
+	photometric := t.Uint(dir, tagPhotometric, defaultPhotometric)
+	colors := 1
+	switch photometric {
+	case tiffWhiteIsZero, tiffBlackIsZero, tiffPalette:
+		if bps != 1 && bps != 2 && bps != 4 && bps != 8 && bps != 16 {
+			return nil, fmt.Errorf("unsupported bit depth %d", bps)
+		}
+	case tiffRGB:
+		colors = 3
+		if bps != 8 && bps != 16 {
+			return nil, fmt.Errorf("unsupported RGB bit depth %d", bps)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported photometric interpretation %d", photometric)
+	}
+	if spp < colors {
+		return nil, fmt.Errorf("%d samples per pixel is too few", spp)
+	}
+	alpha := 0
+	if extra := t.Uints(dir, tagExtraSamples); spp > colors && len(extra) > 0 {
+		if extra[0] == tiffAssociatedAlpha || extra[0] == tiffUnassociatedAlpha {
+			alpha = int(extra[0])
+		}
+	}
+
+	var cmap []uint32
+	if photometric == tiffPalette {
+		cmap = t.Uints(dir, tagColorMap)
+		if len(cmap) != 3<<bps {
+			return nil, fmt.Errorf("color map has %d entries, want %d", len(cmap), 3<<bps)
+		}
+	}
+
+	compression := t.Uint(dir, tagCompression, tiffCompressionNone)
+	predictor := t.Uint(dir, tagPredictor, 1)
+	if predictor != 1 && predictor != tiffPredictorHorizontal {
+		return nil, fmt.Errorf("unsupported predictor %d", predictor)
+	}
+	if predictor == tiffPredictorHorizontal && bps != 8 && bps != 16 {
+		return nil, fmt.Errorf("predictor requires 8 or 16 bits per sample")
+	}
+
+	// Work out the chunk grid: tiles when tile tags are present, otherwise
+	// full-width strips.
+	var offsets, counts []uint32
+	chunkW, chunkH := width, int(t.Uint(dir, tagRowsPerStrip, uint32(height)))
+	if chunkH < 1 || chunkH > height {
+		chunkH = height
+	}
+	if _, tiled := dir[tagTileWidth]; tiled {
+		chunkW = int(t.Uint(dir, tagTileWidth, 0))
+		chunkH = int(t.Uint(dir, tagTileLength, 0))
+		if chunkW < 1 || chunkH < 1 || chunkW > maxPixels/chunkH {
+			return nil, fmt.Errorf("bad tile size %dx%d", chunkW, chunkH)
+		}
+		offsets = t.Uints(dir, tagTileOffsets)
+		counts = t.Uints(dir, tagTileByteCounts)
+	} else {
+		offsets = t.Uints(dir, tagStripOffsets)
+		counts = t.Uints(dir, tagStripByteCounts)
+	}
+	across, down := (width+chunkW-1)/chunkW, (height+chunkH-1)/chunkH
+	if len(offsets) < across*down || len(counts) < across*down {
+		return nil, fmt.Errorf("expected %d strips or tiles, found %d", across*down, len(offsets))
+	}
+
+	rowBytes := (chunkW*spp*bps + 7) / 8
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, width, height))
+	samples := make([]uint32, spp)
+	for ty := 0; ty < down; ty++ {
+		for tx := 0; tx < across; tx++ {
+			i := ty*across + tx
+			x0, y0 := tx*chunkW, ty*chunkH
+			rows := min(chunkH, height-y0)
+
+			start, size := uint64(offsets[i]), uint64(counts[i])
+			if start+size > uint64(len(t.Data)) {
+				return nil, fmt.Errorf("chunk %d out of range", i)
+			}
+			raw, err := tiffDecompress(t.Data[start:start+size], compression, rows*rowBytes)
+			if err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", i, err)
+			}
+			if len(raw) < rows*rowBytes {
+				return nil, fmt.Errorf("chunk %d truncated", i)
+			}
+
+			for y := 0; y < rows; y++ {
+				row := raw[y*rowBytes : (y+1)*rowBytes]
+				if predictor == tiffPredictorHorizontal {
+					undifferenceRow(row, spp, bps, t.Order)
+				}
+				dst := pix.Pix[(y0+y)*pix.Stride:]
+				for x := 0; x < chunkW && x0+x < width; x++ {
+					for c := range samples {
+						samples[c] = tiffSample(row, x*spp+c, bps, t.Order)
+					}
+					p := dst[(x0+x)*4 : (x0+x)*4+4]
+					tiffPixel(p, samples, bps, photometric, cmap, alpha, colors)
+				}
+			}
+		}
+	}
+	return pix, nil
+}
+
+// tiffPixel converts the samples of one pixel to NRGBA.
+func tiffPixel(p []byte, s []uint32, bps int, photometric uint32, cmap []uint32, alpha, colors int) {
+	a := uint8(0xFF)
+	if alpha != 0 {
+		a = scaleSample(s[colors], bps)
+	}
+	switch photometric {
+	case tiffRGB:
+		p[0], p[1], p[2] = scaleSample(s[0], bps), scaleSample(s[1], bps), scaleSample(s[2], bps)
+	case tiffPalette:
+		n := uint32(1) << bps
+		p[0], p[1], p[2] = uint8(cmap[s[0]]>>8), uint8(cmap[n+s[0]]>>8), uint8(cmap[2*n+s[0]]>>8)
+	default:
+		v := scaleSample(s[0], bps)
+		if photometric == tiffWhiteIsZero {
+			v = 0xFF - v
+		}
+		p[0], p[1], p[2] = v, v, v
+	}
+	p[3] = a
+	if alpha == tiffAssociatedAlpha && a > 0 && a < 0xFF {
+		for c := 0; c < 3; c++ {
+			p[c] = uint8(min(0xFF, (uint32(p[c])*0xFF+uint32(a)/2)/uint32(a)))
+		}
+	}
+}
+
+// tiffSample extracts sample i from a row packed at bps bits per sample.
+func tiffSample(row []byte, i, bps int, order binary.ByteOrder) uint32 {
+	switch bps {
+	case 8:
+		return uint32(row[i])
+	case 16:
+		return uint32(order.Uint16(row[2*i:]))
+	default:
+		bit := i * bps
+		shift := 8 - bps - bit%8
+		return uint32(row[bit/8]>>shift) & (1<<bps - 1)
+	}
+}
+
+// scaleSample maps a bps-bit sample to 8 bits.
+func scaleSample(v uint32, bps int) uint8 {
+	if bps == 8 {
+		return uint8(v)
+	}
+	maxval := uint32(1)<<bps - 1
+	return uint8((v*0xFF + maxval/2) / maxval)
+}
+
+// undifferenceRow reverses the horizontal differencing predictor in place.
+func undifferenceRow(row []byte, spp, bps int, order binary.ByteOrder) {
+	if bps == 8 {
+		for i := spp; i < len(row); i++ {
+			row[i] += row[i-spp]
+		}
+		return
+	}
+	for i := spp; i < len(row)/2; i++ {
+		order.PutUint16(row[2*i:], order.Uint16(row[2*i:])+order.Uint16(row[2*(i-spp):]))
+	}
+}
+
+// tiffDecompress expands one strip or tile. want is the expected size,
+// used to bound the output of the decompressors.
+func tiffDecompress(src []byte, compression uint32, want int) ([]byte, error) {
+	switch compression {
+	case tiffCompressionNone:
+		return src, nil
+	case tiffCompressionLZW:
+		return lzwDecode(src, want)
+	case tiffCompressionDeflate, tiffCompressionDeflateOld:
+		zr, err := zlib.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, int64(want)))
+	case tiffCompressionPackBits:
+		return unpackBits(src, want)
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", compression)
+	}
+}
+
+// unpackBits decodes Apple PackBits run-length data.
+func unpackBits(src []byte, want int) ([]byte, error) {
+	out := make([]byte, 0, want)
+	for i := 0; i < len(src) && len(out) < want; {
+		n := int(int8(src[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(src) {
+				return nil, fmt.Errorf("packbits literal run overflows input")
+			}
+			out = append(out, src[i:i+n+1]...)
+			i += n + 1
+		case n != -128:
+			if i >= len(src) {
+				return nil, fmt.Errorf("packbits repeat run overflows input")
+			}
+			out = append(out, bytes.Repeat(src[i:i+1], 1-n)...)
+			i++
+		}
+	}
+	return out, nil
+}
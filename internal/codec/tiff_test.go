@@ -0,0 +1,172 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"testing"
+
+	"photoapp/internal/exif"
+	"photoapp/internal/image"
+)
+
+func TestTIFFRoundTrip(t *testing.T) {
+	opaque := photo(67, 41) // not a multiple of any tile size
+	transparent := photo(67, 41)
+	for x := 0; x < 67; x++ {
+		transparent.Pix[transparent.PixOffset(x, 9)+3] = uint8(x * 3)
+	}
+
+	for name, src := range map[string]*stdimage.NRGBA{"opaque": opaque, "transparent": transparent} {
+		for _, compression := range []TIFFCompression{TIFFCompressionLZW, TIFFCompressionDeflate, TIFFCompressionNone} {
+			for _, sixteen := range []bool{false, true} {
+				for _, tile := range []int{0, 16, 48} {
+					opts := &EncodeOptions{TIFFCompression: compression, SixteenBit: sixteen, TileSize: tile}
+					t.Run(fmt.Sprintf("%s/%s/16bit=%v/tile=%d", name, compression, sixteen, tile), func(t *testing.T) {
+						data, err := NewTIFFEncoder().Encode(image.NewBasicImage("src", src, image.ImageMetadata{}), opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						checkTIFFLayout(t, data, compression, sixteen, tile)
+						got, err := NewTIFFDecoder().Decode(data)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if meta := got.Metadata(); meta.Width != 67 || meta.Height != 41 || meta.Format != FormatTIFF {
+							t.Errorf("decoded %dx%d %s, want 67x41 TIFF", meta.Width, meta.Height, meta.Format)
+						}
+						if !bytes.Equal(got.Pixels().Pix, src.Pix) {
+							t.Error("pixels differ after round trip")
+						}
+					})
+				}
+			}
+		}
+	}
+}
+
+// checkTIFFLayout checks that the first directory of data records the
+// compression, sample depth and strip or tile layout that was asked for.
+func checkTIFFLayout(t *testing.T, data []byte, compression TIFFCompression, sixteen bool, tile int) {
+	t.Helper()
+	r, off, err := exif.NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _, err := r.ReadIFD(off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCompression := map[TIFFCompression]uint32{
+		TIFFCompressionLZW:     tiffCompressionLZW,
+		TIFFCompressionDeflate: tiffCompressionDeflate,
+		TIFFCompressionNone:    tiffCompressionNone,
+	}[compression]
+	if got := r.Uint(dir, tagCompression, 0); got != wantCompression {
+		t.Errorf("compression tag %d, want %d", got, wantCompression)
+	}
+	wantBPS := uint32(8)
+	if sixteen {
+		wantBPS = 16
+	}
+	if got := r.Uint(dir, tagBitsPerSample, 0); got != wantBPS {
+		t.Errorf("bits per sample %d, want %d", got, wantBPS)
+	}
+	_, tiled := dir[tagTileOffsets]
+	if got := r.Uint(dir, tagTileWidth, 0); tiled != (tile > 0) || got != uint32(tile) {
+		t.Errorf("tile width %d (tiled %v), want %d", got, tiled, tile)
+	}
+}
+
+func TestTIFFMultiPage(t *testing.T) {
+	sizes := []stdimage.Point{{30, 20}, {17, 33}, {8, 8}}
+	pages := make([]image.Image, len(sizes))
+	for i, s := range sizes {
+		pages[i] = image.NewBasicImage(fmt.Sprint("page", i), photo(s.X, s.Y), image.ImageMetadata{Description: fmt.Sprint("page ", i)})
+	}
+	var buf bytes.Buffer
+	if err := NewTIFFEncoder().EncodePages(&buf, pages, &EncodeOptions{TileSize: 16}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := NewTIFFDecoder().DecodePages(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(pages) {
+		t.Fatalf("%d pages, want %d", len(got), len(pages))
+	}
+	for i, page := range got {
+		meta := page.Metadata()
+		if meta.Page != i || meta.Pages != len(pages) || meta.Description != fmt.Sprint("page ", i) {
+			t.Errorf("page %d: metadata page %d of %d, %q", i, meta.Page, meta.Pages, meta.Description)
+		}
+		if !bytes.Equal(page.Pixels().Pix, pages[i].Pixels().Pix) {
+			t.Errorf("page %d: pixels differ after round trip", i)
+		}
+	}
+
+	// Single-image decoding returns the first page.
+	first, err := NewTIFFDecoder().Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Pixels().Rect.Size() != sizes[0] {
+		t.Errorf("Decode returned a %v page", first.Pixels().Rect.Size())
+	}
+
+	if err := NewTIFFEncoder().EncodePages(&buf, nil, nil); err == nil {
+		t.Error("encoded a TIFF without pages")
+	}
+	if _, err := NewTIFFEncoder().Encode(pages[0], &EncodeOptions{TileSize: 24}); err == nil {
+		t.Error("tile size 24 accepted")
+	}
+}
+
+func TestLZWRoundTrip(t *testing.T) {
+	// Noise fills the code table and forces resets; runs exercise the
+	// KwKwK case where a code is used as soon as it is defined.
+	noise := make([]byte, 200_000)
+	seed := uint32(7)
+	for i := range noise {
+		seed = seed*1664525 + 1013904223
+		noise[i] = byte(seed >> 24)
+	}
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"byte":   {42},
+		"run":    bytes.Repeat([]byte{9}, 100_000),
+		"cycle":  bytes.Repeat([]byte("abcabcabd"), 5000),
+		"noise":  noise,
+		"pixels": photo(300, 200).Pix,
+	}
+	for name, data := range inputs {
+		got, err := lzwDecode(lzwEncode(data), len(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: %d bytes decoded, want %d identical", name, len(got), len(data))
+		}
+	}
+}
+
+func TestLZWDecodeBounded(t *testing.T) {
+	// 8 MB of zeros compress to about 7 kilobytes; a strip that
+	// size must not expand past what the image can hold.
+	bomb := lzwEncode(make([]byte, 8<<20))
+	got, err := tiffDecompress(bomb, tiffCompressionLZW, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4096 || cap(got) > 4096+lzwTableMax {
+		t.Errorf("decoded %d bytes into a %d byte buffer, want 4096", len(got), cap(got))
+	}
+
+	// Short data still decodes in full.
+	short := []byte("abcabcabc")
+	if got, err := lzwDecode(lzwEncode(short), 100); err != nil || !bytes.Equal(got, short) {
+		t.Errorf("short strip: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package collage implements the Strategy pattern for combining many photos
+// into one. A Layout decides where each photo goes; the Composer draws the
+// photos, their borders and captions into the frames it is given.
+package collage
+
+import (
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"math"
+	"strings"
+	"time"
+
+	"photoapp/internal/gallery"
+	"photoapp/internal/image"
+)
+
+// maxCanvas bounds the width and height of a composed image, and
+// maxPixels its area, matching the limit the codecs decode to.
+const (
+	maxCanvas = 1 << 16
+	maxPixels = 1 << 28
+)
+
+// captionLines is the number of text lines in a caption: ID, capture date
+// and rating.
+const captionLines = 3
+
+// Style controls the spacing, borders, background and captions of a
+// composed image.
+type Style struct {
+	Spacing      int // gap between frames and around the edges, in pixels
+	Border       int // border width around each photo, in pixels
+	BorderColor  color.NRGBA
+	Background   color.NRGBA
+	Captions     bool // print ID, capture date and rating under each photo
+	CaptionSize  int  // capital height of caption text in pixels; 0 means 10
+	CaptionColor color.NRGBA
+}
+
+// DefaultStyle returns a contact sheet look: photos with a thin gray
+// border on white, captioned in dark gray.
+func DefaultStyle() Style {
+	return Style{
+		Spacing:      16,
+		Border:       1,
+		BorderColor:  color.NRGBA{R: 0xB0, G: 0xB0, B: 0xB0, A: 0xFF},
+		Background:   color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		Captions:     true,
+		CaptionColor: color.NRGBA{R: 0x30, G: 0x30, B: 0x30, A: 0xFF},
+	}
+}
+
+func (s Style) captionSize() int {
+	if s.CaptionSize <= 0 {
+		return 10
+	}
+	return s.CaptionSize
+}
+
+// captionHeight returns the space a layout reserves below each frame for
+// its caption, or 0 when captions are off.
+func (s Style) captionHeight() int {
+	if !s.Captions {
+		return 0
+	}
+	size := s.captionSize()
+	return size/2 + image.MeasureText(strings.Repeat("\n", captionLines-1)+" ", size).Y
+}
+
+// Frame is where a Layout puts one photo.
+type Frame struct {
+	Photo   stdimage.Rectangle // the photo and its border are fitted inside, centered
+	Caption stdimage.Rectangle // empty when the layout leaves no room for one
+}
+
+// Layout arranges photos on a canvas (Strategy interface).
+type Layout interface {
+	// Arrange returns the canvas size and one frame for each of the
+	// photo sizes, in order.
+	Arrange(sizes []stdimage.Point, style Style) (stdimage.Point, []Frame, error)
+	Name() string
+}
+
+// Composer draws photos onto a single canvas as its layout directs.
+type Composer struct {
+	layout Layout
+	style  Style
+}
+
+// NewComposer creates a new composer.
+func NewComposer(layout Layout, style Style) *Composer {
+	if layout == nil {
+		panic("layout cannot be nil")
+	}
+	return &Composer{layout: layout, style: style}
+}
+
+// Compose lays out the gallery's images, in gallery order, as a new image
+// with the given ID.
+func (c *Composer) Compose(id string, g *gallery.Gallery) (image.Image, error) {
+	return c.ComposeImages(id, g.Images())
+}
+
+// ComposeImages lays out images as a new image with the given ID.
+func (c *Composer) ComposeImages(id string, images []image.Image) (image.Image, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("compose: no images")
+	}
+	sizes := make([]stdimage.Point, len(images))
+	for i, img := range images {
+		sizes[i] = img.Pixels().Rect.Size()
+	}
+	canvasSize, frames, err := c.layout.Arrange(sizes, c.style)
+	if err != nil {
+		return nil, fmt.Errorf("compose: %w", err)
+	}
+	if canvasSize.X < 1 || canvasSize.Y < 1 || canvasSize.X > maxCanvas || canvasSize.Y > maxCanvas ||
+		canvasSize.X > maxPixels/canvasSize.Y {
+		return nil, fmt.Errorf("compose: %dx%d canvas out of range", canvasSize.X, canvasSize.Y)
+	}
+
+	canvas := stdimage.NewNRGBA(stdimage.Rectangle{Max: canvasSize})
+	fill(canvas, canvas.Rect, c.style.Background)
+	for i, frame := range frames {
+		c.drawPhoto(canvas, images[i].Pixels(), frame.Photo)
+		if !frame.Caption.Empty() {
+			c.drawCaption(canvas, images[i], frame.Caption)
+		}
+	}
+
+	meta := image.ImageMetadata{
+		CapturedAt:  time.Now(),
+		Description: fmt.Sprintf("%s of %d photos", c.layout.Name(), len(images)),
+	}
+	return image.NewBasicImage(id, canvas, meta), nil
+}
+
+// drawPhoto scales pix to fit inside r less the border, keeping its aspect
+// ratio, and draws it centered with its border.
+func (c *Composer) drawPhoto(canvas, pix *stdimage.NRGBA, r stdimage.Rectangle) {
+	b := c.style.Border
+	inner := r.Inset(b)
+	size := fitInside(pix.Rect.Size(), inner.Size())
+	if size.X < 1 || size.Y < 1 {
+		return
+	}
+	if size != pix.Rect.Size() {
+		pix = image.Resize(pix, size.X, size.Y, image.ResampleLanczos)
+	}
+	at := inner.Min.Add(inner.Size().Sub(size).Div(2))
+	if b > 0 {
+		fill(canvas, stdimage.Rectangle{Min: at, Max: at.Add(size)}.Inset(-b), c.style.BorderColor)
+	}
+	image.DrawOver(canvas, pix, at, 1)
+}
+
+// drawCaption prints the photo's ID, capture date and rating centered in r,
+// cutting off lines that are too long.
+func (c *Composer) drawCaption(canvas *stdimage.NRGBA, img image.Image, r stdimage.Rectangle) {
+	meta := img.Metadata()
+	date := ""
+	if !meta.CapturedAt.IsZero() {
+		date = meta.CapturedAt.Format("2006-01-02 15:04")
+	}
+	text := strings.Join([]string{img.ID(), date, ratingText(meta.Rating)}, "\n")
+
+	size := c.style.captionSize()
+	rendered := image.RenderText(text, size, image.TextStyle{Color: c.style.CaptionColor})
+	visible := rendered.Rect.Intersect(stdimage.Rect(0, 0, r.Dx(), r.Dy()-size/2))
+	if visible.Empty() {
+		return
+	}
+	at := stdimage.Pt(r.Min.X+(r.Dx()-visible.Dx())/2, r.Min.Y+size/2)
+	image.DrawOver(canvas, rendered.SubImage(visible).(*stdimage.NRGBA), at, 1)
+}
+
+// ratingText shows a rating out of five, with asterisks for stars since
+// the bundled font has none.
+func ratingText(rating int) string {
+	switch {
+	case rating < 0:
+		return "rejected"
+	case rating == 0:
+		return "unrated"
+	}
+	return strings.Repeat("*", min(rating, 5)) + strings.Repeat(".", max(0, 5-rating))
+}
+
+// fitInside scales size to the largest size that fits within box, keeping
+// its aspect ratio.
+func fitInside(size, box stdimage.Point) stdimage.Point {
+	if size.X < 1 || size.Y < 1 || box.X < 1 || box.Y < 1 {
+		return stdimage.Point{}
+	}
+	scale := math.Min(float64(box.X)/float64(size.X), float64(box.Y)/float64(size.Y))
+	return stdimage.Pt(
+		min(box.X, max(1, int(math.Round(float64(size.X)*scale)))),
+		min(box.Y, max(1, int(math.Round(float64(size.Y)*scale)))),
+	)
+}
+
+func fill(dst *stdimage.NRGBA, r stdimage.Rectangle, c color.NRGBA) {
+	r = r.Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := dst.Pix[y*dst.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := row[x*4 : x*4+4]
+			p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package collage
+
+import (
+	stdimage "image"
+	"image/color"
+	"testing"
+
+	"photoapp/internal/gallery"
+	"photoapp/internal/image"
+)
+
+var (
+	white = color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	gray  = color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xFF}
+	red   = color.NRGBA{R: 0xFF, A: 0xFF}
+	black = color.NRGBA{A: 0xFF}
+)
+
+// plainStyle has no captions so that frame positions are easy to work out.
+func plainStyle() Style {
+	return Style{Spacing: 4, Border: 1, BorderColor: gray, Background: white}
+}
+
+func solid(id string, w, h int, c color.NRGBA) image.Image {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i := 0; i < len(pix.Pix); i += 4 {
+		pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2], pix.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return image.NewBasicImage(id, pix, image.ImageMetadata{Rating: 3})
+}
+
+func sizes(n int) []stdimage.Point {
+	s := make([]stdimage.Point, n)
+	for i := range s {
+		s[i] = stdimage.Pt(60, 40)
+	}
+	return s
+}
+
+func TestGridArrange(t *testing.T) {
+	tests := []struct {
+		name   string
+		photos int
+		canvas stdimage.Point
+		frames []stdimage.Rectangle
+	}{
+		{"empty", 0, stdimage.Pt(48, 4), nil},
+		{"single", 1, stdimage.Pt(48, 38), []stdimage.Rectangle{stdimage.Rect(4, 4, 44, 34)}},
+		{"wraps", 3, stdimage.Pt(92, 72), []stdimage.Rectangle{
+			stdimage.Rect(4, 4, 44, 34),
+			stdimage.Rect(48, 4, 88, 34),
+			stdimage.Rect(4, 38, 44, 68),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canvas, frames, err := NewGrid(2, 40, 30).Arrange(sizes(tt.photos), plainStyle())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if canvas != tt.canvas {
+				t.Errorf("canvas %v, want %v", canvas, tt.canvas)
+			}
+			if len(frames) != len(tt.frames) {
+				t.Fatalf("%d frames, want %d", len(frames), len(tt.frames))
+			}
+			for i, f := range frames {
+				if f.Photo != tt.frames[i] || !f.Caption.Empty() {
+					t.Errorf("frame %d: photo %v caption %v, want %v and no caption", i, f.Photo, f.Caption, tt.frames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGridCaptions(t *testing.T) {
+	style := plainStyle()
+	style.Captions = true
+	caption := style.captionHeight()
+	if caption <= 0 {
+		t.Fatalf("caption height %d", caption)
+	}
+	canvas, frames, err := NewGrid(2, 40, 30).Arrange(sizes(3), style)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := stdimage.Pt(92, 4+2*(30+caption+4)); canvas != want {
+		t.Errorf("canvas %v, want %v", canvas, want)
+	}
+	for i, f := range frames {
+		want := stdimage.Rect(f.Photo.Min.X, f.Photo.Max.Y, f.Photo.Max.X, f.Photo.Max.Y+caption)
+		if f.Caption != want {
+			t.Errorf("frame %d: caption %v, want %v", i, f.Caption, want)
+		}
+	}
+	if frames[2].Photo.Min.Y != frames[0].Caption.Max.Y+4 {
+		t.Errorf("second row starts at %d, want spacing below caption at %d", frames[2].Photo.Min.Y, frames[0].Caption.Max.Y)
+	}
+}
+
+func TestGridRejectsBadCells(t *testing.T) {
+	for _, l := range []*Grid{NewGrid(0, 40, 30), NewGrid(2, 2, 30), NewGrid(2, 40, 1)} {
+		if _, _, err := l.Arrange(sizes(2), plainStyle()); err == nil {
+			t.Errorf("%+v accepted", *l)
+		}
+	}
+}
+
+func TestJustifiedArrange(t *testing.T) {
+	style := Style{Spacing: 5}
+	tests := []struct {
+		name   string
+		sizes  []stdimage.Point
+		canvas stdimage.Point
+		frames []stdimage.Rectangle
+	}{
+		{"empty", nil, stdimage.Pt(200, 5), nil},
+		{"single", []stdimage.Point{{100, 50}}, stdimage.Pt(200, 60), []stdimage.Rectangle{stdimage.Rect(5, 5, 105, 55)}},
+		{
+			// Aspects 2, 1 and 2 at height 50 overflow 190 pixels, so the
+			// row shrinks to (190 - 2*5) / 5 = 36 and ends flush.
+			"full row",
+			[]stdimage.Point{{100, 50}, {50, 50}, {100, 50}},
+			stdimage.Pt(200, 46),
+			[]stdimage.Rectangle{stdimage.Rect(5, 5, 77, 41), stdimage.Rect(82, 5, 118, 41), stdimage.Rect(123, 5, 195, 41)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canvas, frames, err := NewJustified(200, 50).Arrange(tt.sizes, style)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if canvas != tt.canvas {
+				t.Errorf("canvas %v, want %v", canvas, tt.canvas)
+			}
+			if len(frames) != len(tt.frames) {
+				t.Fatalf("%d frames, want %d", len(frames), len(tt.frames))
+			}
+			for i, f := range frames {
+				if f.Photo != tt.frames[i] {
+					t.Errorf("frame %d: %v, want %v", i, f.Photo, tt.frames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestJustifiedRowsFillWidth(t *testing.T) {
+	style := Style{Spacing: 3, Border: 2}
+	in := []stdimage.Point{{300, 200}, {200, 300}, {400, 100}, {100, 100}, {640, 480}, {480, 640}, {50, 80}}
+	canvas, frames, err := NewJustified(320, 60).Arrange(in, style)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canvas.X != 320 {
+		t.Errorf("canvas width %d", canvas.X)
+	}
+	// Every row but the last ends flush with the right spacing, and photos
+	// in a row share a height.
+	for i := 0; i < len(frames)-1; i++ {
+		cur, next := frames[i].Photo, frames[i+1].Photo
+		if next.Min.Y == cur.Min.Y {
+			if next.Min.X != cur.Max.X+3 || next.Dy() != cur.Dy() {
+				t.Errorf("frames %d and %d: %v then %v", i, i+1, cur, next)
+			}
+			continue
+		}
+		if cur.Max.X != 320-3 {
+			t.Errorf("row ending with frame %d ends at %d, want %d", i, cur.Max.X, 320-3)
+		}
+		if next.Min.Y != cur.Max.Y+3 || next.Min.X != 3 {
+			t.Errorf("row starting with frame %d at %v", i+1, next.Min)
+		}
+	}
+	if last := frames[len(frames)-1].Photo; canvas.Y != last.Max.Y+3 {
+		t.Errorf("canvas height %d, want %d", canvas.Y, last.Max.Y+3)
+	}
+}
+
+func TestFreeformArrange(t *testing.T) {
+	rects := []stdimage.Rectangle{stdimage.Rect(0, 0, 50, 40), stdimage.Rect(30, 20, 90, 70)}
+	canvas, frames, err := NewFreeform(stdimage.Point{}, rects...).Arrange(sizes(2), plainStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canvas != stdimage.Pt(94, 74) {
+		t.Errorf("canvas %v, want frames plus spacing", canvas)
+	}
+	for i, f := range frames {
+		if f.Photo != rects[i] || !f.Caption.Empty() {
+			t.Errorf("frame %d: %+v", i, f)
+		}
+	}
+
+	canvas, _, err = NewFreeform(stdimage.Pt(300, 200), rects...).Arrange(sizes(1), plainStyle())
+	if err != nil || canvas != stdimage.Pt(300, 200) {
+		t.Errorf("fixed size: %v, %v", canvas, err)
+	}
+	if _, _, err := NewFreeform(stdimage.Point{}, rects[0]).Arrange(sizes(2), plainStyle()); err == nil {
+		t.Error("more photos than frames accepted")
+	}
+}
+
+func TestComposeDrawsPhotosAndBorders(t *testing.T) {
+	g := gallery.NewGallery()
+	g.AddImage(solid("a", 60, 40, red))
+	g.AddImage(solid("b", 40, 60, black))
+	img, err := NewComposer(NewGrid(2, 40, 30), plainStyle()).Compose("sheet", g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix := img.Pixels()
+	if pix.Rect != stdimage.Rect(0, 0, 92, 38) || img.ID() != "sheet" {
+		t.Fatalf("%s: %v", img.ID(), pix.Rect)
+	}
+
+	// Each cell's interior is 38x28 inside the border: the 60x40 photo
+	// fits at 38x25 from (5, 6), the 40x60 one at 19x28 from (58, 5).
+	tests := []struct {
+		at   stdimage.Point
+		want color.NRGBA
+	}{
+		{stdimage.Pt(1, 1), white},   // outer spacing
+		{stdimage.Pt(24, 4), white},  // letterbox above the first photo
+		{stdimage.Pt(24, 5), gray},   // its top border
+		{stdimage.Pt(24, 18), red},   // its center
+		{stdimage.Pt(24, 31), gray},  // its bottom border
+		{stdimage.Pt(46, 18), white}, // spacing between frames
+		{stdimage.Pt(52, 18), white}, // pillarbox beside the second photo
+		{stdimage.Pt(57, 18), gray},  // its left border
+		{stdimage.Pt(67, 18), black}, // its center
+		{stdimage.Pt(77, 18), gray},  // its right border
+		{stdimage.Pt(67, 36), white}, // bottom spacing
+	}
+	for _, tt := range tests {
+		if got := pix.NRGBAAt(tt.at.X, tt.at.Y); got != tt.want {
+			t.Errorf("pixel %v: %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestComposeCaptions(t *testing.T) {
+	style := plainStyle()
+	style.Captions, style.CaptionColor = true, black
+	g := gallery.NewGallery()
+	g.AddImage(solid("a", 60, 40, red))
+	img, err := NewComposer(NewGrid(1, 80, 40), style).Compose("sheet", g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix := img.Pixels()
+	if want := stdimage.Rect(0, 0, 88, 4+40+style.captionHeight()+4); pix.Rect != want {
+		t.Fatalf("canvas %v, want %v", pix.Rect, want)
+	}
+	inked := 0
+	for y := 44; y < 44+style.captionHeight(); y++ {
+		for x := 4; x < 84; x++ {
+			if c := pix.NRGBAAt(x, y); c.R < 0x80 {
+				inked++
+			}
+		}
+	}
+	if inked == 0 {
+		t.Error("no caption drawn below the photo")
+	}
+}
+
+func TestComposeEmptyGallery(t *testing.T) {
+	_, err := NewComposer(NewGrid(2, 40, 30), plainStyle()).Compose("sheet", gallery.NewGallery())
+	if err == nil {
+		t.Error("empty gallery composed")
+	}
+}
+
+func TestComposeRejectsHugeCanvas(t *testing.T) {
+	images := make([]image.Image, 4)
+	for i := range images {
+		images[i] = solid("p", 2, 2, red)
+	}
+	// Each canvas is under the per-side limit but far over the area limit.
+	for _, l := range []Layout{NewGrid(2, 30000, 30000), NewJustified(60000, 30000)} {
+		if _, err := NewComposer(l, plainStyle()).ComposeImages("sheet", images); err == nil {
+			t.Errorf("%s: 60000x60000 canvas composed", l.Name())
+		}
+	}
+	if _, err := NewComposer(NewGrid(4, 20000, 10), plainStyle()).ComposeImages("sheet", images); err == nil {
+		t.Error("canvas wider than the side limit composed")
+	}
+}
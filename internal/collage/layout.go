@@ -0,0 +1,156 @@
+package collage
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+)
+
+// Grid lays photos out in equal cells, row by row, as on a contact sheet
+// (Concrete Strategy).
+type Grid struct {
+	columns    int
+	cellWidth  int
+	cellHeight int
+}
+
+// NewGrid creates a grid of the given number of columns, each cell
+// cellWidth x cellHeight pixels including the photo's border.
+func NewGrid(columns, cellWidth, cellHeight int) *Grid {
+	return &Grid{columns: columns, cellWidth: cellWidth, cellHeight: cellHeight}
+}
+
+func (l *Grid) Arrange(sizes []stdimage.Point, style Style) (stdimage.Point, []Frame, error) {
+	if l.columns < 1 {
+		return stdimage.Point{}, nil, fmt.Errorf("grid needs at least one column, got %d", l.columns)
+	}
+	if l.cellWidth <= 2*style.Border || l.cellHeight <= 2*style.Border {
+		return stdimage.Point{}, nil, fmt.Errorf("grid cell %dx%d leaves no room inside the border", l.cellWidth, l.cellHeight)
+	}
+	cols := min(l.columns, max(1, len(sizes)))
+	rows := (len(sizes) + cols - 1) / cols
+	sp, caption := style.Spacing, style.captionHeight()
+	rowHeight := l.cellHeight + caption + sp
+
+	frames := make([]Frame, len(sizes))
+	for i := range sizes {
+		x := sp + (i%cols)*(l.cellWidth+sp)
+		y := sp + (i/cols)*rowHeight
+		frames[i] = Frame{
+			Photo:   stdimage.Rect(x, y, x+l.cellWidth, y+l.cellHeight),
+			Caption: stdimage.Rect(x, y+l.cellHeight, x+l.cellWidth, y+l.cellHeight+caption),
+		}
+	}
+	return stdimage.Pt(sp+cols*(l.cellWidth+sp), sp+rows*rowHeight), frames, nil
+}
+
+func (l *Grid) Name() string {
+	return "Contact sheet"
+}
+
+// Justified packs photos into rows of equal height that exactly fill the
+// canvas width, keeping every photo's aspect ratio and scaling each row to
+// fit, so photos of any shape form a tight collage (Concrete Strategy).
+type Justified struct {
+	width     int
+	rowHeight int
+}
+
+// NewJustified creates a layout width pixels wide whose rows are about
+// rowHeight pixels tall. Only the last row, which may not fill the width,
+// keeps exactly rowHeight.
+func NewJustified(width, rowHeight int) *Justified {
+	return &Justified{width: width, rowHeight: rowHeight}
+}
+
+func (l *Justified) Arrange(sizes []stdimage.Point, style Style) (stdimage.Point, []Frame, error) {
+	if l.rowHeight < 1 {
+		return stdimage.Point{}, nil, fmt.Errorf("justified layout needs a positive row height, got %d", l.rowHeight)
+	}
+	sp, b, caption := style.Spacing, style.Border, style.captionHeight()
+	avail := l.width - 2*sp
+	if avail <= 2*b {
+		return stdimage.Point{}, nil, fmt.Errorf("justified layout %d pixels wide leaves no room for photos", l.width)
+	}
+	aspects := make([]float64, len(sizes))
+	for i, s := range sizes {
+		aspects[i] = 1
+		if s.X > 0 && s.Y > 0 {
+			aspects[i] = float64(s.X) / float64(s.Y)
+		}
+	}
+
+	frames := make([]Frame, 0, len(sizes))
+	y := sp
+	for start := 0; start < len(sizes); {
+		// Take photos until the row at rowHeight would overflow, then
+		// shrink the row to fit exactly.
+		end, sum := start, 0.0
+		natural := -sp
+		for end < len(sizes) && (end == start || natural < avail) {
+			sum += aspects[end]
+			natural += int(aspects[end]*float64(l.rowHeight)) + 2*b + sp
+			end++
+		}
+		h := float64(l.rowHeight)
+		full := natural >= avail
+		if full {
+			h = float64(avail-(end-start-1)*sp-(end-start)*2*b) / sum
+		}
+		rowHeight := max(1, int(math.Round(h)))
+
+		x := sp
+		for i := start; i < end; i++ {
+			w := max(1, int(math.Round(aspects[i]*h))) + 2*b
+			if full && i == end-1 {
+				w = sp + avail - x // absorb rounding so the row ends flush
+			}
+			frames = append(frames, Frame{
+				Photo:   stdimage.Rect(x, y, x+w, y+rowHeight+2*b),
+				Caption: stdimage.Rect(x, y+rowHeight+2*b, x+w, y+rowHeight+2*b+caption),
+			})
+			x += w + sp
+		}
+		y += rowHeight + 2*b + caption + sp
+		start = end
+	}
+	return stdimage.Pt(l.width, y), frames, nil
+}
+
+func (l *Justified) Name() string {
+	return "Collage"
+}
+
+// Freeform places photos in frames chosen by the caller, for hand-designed
+// collages; frames may overlap, later photos drawing on top. There is no
+// room for captions (Concrete Strategy).
+type Freeform struct {
+	size   stdimage.Point
+	frames []stdimage.Rectangle
+}
+
+// NewFreeform creates a layout that puts the i-th photo in frames[i]. A zero
+// size makes the canvas just large enough for the frames plus spacing.
+func NewFreeform(size stdimage.Point, frames ...stdimage.Rectangle) *Freeform {
+	return &Freeform{size: size, frames: frames}
+}
+
+func (l *Freeform) Arrange(sizes []stdimage.Point, style Style) (stdimage.Point, []Frame, error) {
+	if len(sizes) > len(l.frames) {
+		return stdimage.Point{}, nil, fmt.Errorf("freeform layout has %d frames for %d photos", len(l.frames), len(sizes))
+	}
+	size := l.size
+	frames := make([]Frame, len(sizes))
+	for i := range sizes {
+		frames[i] = Frame{Photo: l.frames[i]}
+		if l.size == (stdimage.Point{}) {
+			size.X = max(size.X, l.frames[i].Max.X+style.Spacing)
+			size.Y = max(size.Y, l.frames[i].Max.Y+style.Spacing)
+		}
+	}
+	return size, frames, nil
+}
+
+func (l *Freeform) Name() string {
+	return "Freeform collage"
+}
@@ -16,6 +16,8 @@ const (
 	EventImageProcessed EventType = "ImageProcessed"
 	EventGallerySorted  EventType = "GallerySorted"
 	EventImageEncoded   EventType = "ImageEncoded"
+	EventAnimationSaved EventType = "AnimationSaved"
+	EventCollageSaved   EventType = "CollageSaved"
 )
 
 // Event represents an event in the system
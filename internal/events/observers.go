@@ -1,8 +1,14 @@
 package events
 
-import "fmt"
+import (
+	"fmt"
+	"slices"
+	"strings"
 
-const defaultThumbnailSize = 128
+	"photoapp/internal/codec"
+	"photoapp/internal/image"
+	"photoapp/internal/storage"
+)
 
 // LoggerObserver logs events to stdout.
 type LoggerObserver struct {
@@ -30,33 +36,95 @@ func (l *LoggerObserver) Name() string {
 	return l.name
 }
 
-// ThumbnailGeneratorObserver generates image thumbnails.
+// ThumbnailGeneratorObserver renders downscaled copies of the images in
+// the events it handles and persists them to storage, one per configured
+// size.
 type ThumbnailGeneratorObserver struct {
-	name       string
-	thumbnails map[string][]byte
+	name  string
+	store storage.Storage
+	opts  ThumbnailOptions
+}
+
+// ThumbnailOptions configures thumbnail generation. A nil ThumbnailOptions
+// or zero fields select the defaults.
+type ThumbnailOptions struct {
+	Sizes      []int                // longest edge of each thumbnail in pixels; default DefaultThumbnailSizes
+	Format     string               // codec format name; default JPEG
+	Encode     *codec.EncodeOptions // encoder settings; nil for the format's defaults
+	Resampling image.Resampling     // default Lanczos
+	Events     []EventType          // events whose image is thumbnailed; default DefaultThumbnailEvents
 }
 
-// NewThumbnailGeneratorObserver creates a new thumbnail generator.
-func NewThumbnailGeneratorObserver(name string) *ThumbnailGeneratorObserver {
+// DefaultThumbnailSizes are the thumbnail edges generated when none are configured.
+var DefaultThumbnailSizes = []int{128, 512, 1024}
+
+// DefaultThumbnailEvents are the events handled when none are configured:
+// only stored photos, in their final processed form. Captures are skipped
+// because they are thumbnailed again once processed, and burst frames
+// because they are never stored.
+var DefaultThumbnailEvents = []EventType{EventImageProcessed}
+
+// NewThumbnailGeneratorObserver creates a new thumbnail generator that
+// saves thumbnails to store.
+func NewThumbnailGeneratorObserver(name string, store storage.Storage, opts *ThumbnailOptions) *ThumbnailGeneratorObserver {
+	if store == nil {
+		panic("storage cannot be nil")
+	}
 	if name == "" {
 		name = "ThumbnailGenerator"
 	}
-	return &ThumbnailGeneratorObserver{
-		name:       name,
-		thumbnails: make(map[string][]byte),
+	t := &ThumbnailGeneratorObserver{name: name, store: store}
+	if opts != nil {
+		t.opts = *opts
+	}
+	if len(t.opts.Sizes) == 0 {
+		t.opts.Sizes = DefaultThumbnailSizes
+	}
+	if t.opts.Format == "" {
+		t.opts.Format = codec.FormatJPEG
+	}
+	if len(t.opts.Events) == 0 {
+		t.opts.Events = DefaultThumbnailEvents
 	}
+	return t
 }
 
-// OnEvent handles events by generating thumbnails.
+// OnEvent handles events of the configured types by generating thumbnails
+// of the event's image. Failures are logged, since observers cannot return
+// errors.
 func (t *ThumbnailGeneratorObserver) OnEvent(event *Event) {
-	if event == nil || event.Image == nil {
+	if event == nil || event.Image == nil || !slices.Contains(t.opts.Events, event.Type) {
 		return
 	}
-	data := event.Image.Data()
-	size := min(len(data), defaultThumbnailSize)
-	thumb := make([]byte, size)
-	copy(thumb, data[:size])
-	t.thumbnails[event.Image.ID()] = thumb
+	if err := t.Generate(event.Image); err != nil {
+		fmt.Printf("[%s] %v\n", t.name, err)
+	}
+}
+
+// Generate renders and saves every configured thumbnail size of img, turned
+// upright. Thumbnails keep the aspect ratio and are never larger than img.
+func (t *ThumbnailGeneratorObserver) Generate(img image.Image) error {
+	encoder, err := codec.DefaultRegistry().Encoder(t.opts.Format)
+	if err != nil {
+		return fmt.Errorf("generate thumbnail: %w", err)
+	}
+	upright := image.Upright(img)
+	pix := upright.Pixels()
+	for _, size := range t.opts.Sizes {
+		thumb := image.NewBasicImage(img.ID(), image.Fit(pix, size, size, t.opts.Resampling), upright.Metadata())
+		w, err := t.store.Create(t.ThumbnailID(img.ID(), size))
+		if err != nil {
+			return fmt.Errorf("save thumbnail: %w", err)
+		}
+		if err := encoder.EncodeTo(w, thumb, t.opts.Encode); err != nil {
+			w.Abort()
+			return fmt.Errorf("encode thumbnail: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("save thumbnail: %w", err)
+		}
+	}
+	return nil
 }
 
 // Name returns the observer name.
@@ -64,17 +132,20 @@ func (t *ThumbnailGeneratorObserver) Name() string {
 	return t.name
 }
 
-// GetThumbnail retrieves a thumbnail by image ID.
-func (t *ThumbnailGeneratorObserver) GetThumbnail(imageID string) ([]byte, bool) {
-	thumb, ok := t.thumbnails[imageID]
-	return thumb, ok
+// Sizes returns the thumbnail edges generated for each image.
+func (t *ThumbnailGeneratorObserver) Sizes() []int {
+	return t.opts.Sizes
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
+// ThumbnailID returns the storage ID of an image's thumbnail of the given size.
+func (t *ThumbnailGeneratorObserver) ThumbnailID(imageID string, size int) string {
+	return fmt.Sprintf("%s.thumb-%d.%s", imageID, size, strings.ToLower(t.opts.Format))
+}
+
+// GetThumbnail loads the encoded thumbnail of the given size for an image.
+func (t *ThumbnailGeneratorObserver) GetThumbnail(imageID string, size int) ([]byte, bool) {
+	thumb, err := t.store.Load(t.ThumbnailID(imageID, size))
+	return thumb, err == nil
 }
 
 // StatisticsObserver tracks event statistics.
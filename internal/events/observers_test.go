@@ -0,0 +1,153 @@
+package events
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+	"testing"
+
+	"photoapp/internal/codec"
+	"photoapp/internal/exif"
+	"photoapp/internal/image"
+	"photoapp/internal/storage"
+)
+
+// gradient returns a w x h image with some texture for encoders to work on.
+func gradient(w, h int) *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := pix.PixOffset(x, y)
+			pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2], pix.Pix[i+3] = uint8(x), uint8(y), uint8(x*y>>3), 0xFF
+		}
+	}
+	return pix
+}
+
+// decodeThumbnail loads and decodes the stored thumbnail of photo at size.
+func decodeThumbnail(t *testing.T, obs *ThumbnailGeneratorObserver, size int) image.Image {
+	t.Helper()
+	data, ok := obs.GetThumbnail("photo", size)
+	if !ok {
+		t.Fatalf("no %d thumbnail stored", size)
+	}
+	thumb, err := codec.DefaultRegistry().DecodeAny(data, nil)
+	if err != nil {
+		t.Fatalf("%d thumbnail: %v", size, err)
+	}
+	return thumb
+}
+
+func TestThumbnailTriggerEvents(t *testing.T) {
+	img := image.NewBasicImage("photo", stdimage.NewNRGBA(stdimage.Rect(0, 0, 40, 30)), image.ImageMetadata{})
+	tests := []struct {
+		name   string
+		events []EventType
+		event  EventType
+		want   bool
+	}{
+		{"captured", nil, EventImageCaptured, false},
+		{"processed", nil, EventImageProcessed, true},
+		{"animation", nil, EventAnimationSaved, false},
+		{"animation opted in", []EventType{EventAnimationSaved}, EventAnimationSaved, true},
+		{"collage", nil, EventCollageSaved, false},
+		{"collage opted in", []EventType{EventCollageSaved}, EventCollageSaved, true},
+		{"processed opted out", []EventType{EventAnimationSaved}, EventImageProcessed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs := NewThumbnailGeneratorObserver("thumbs", storage.NewMapAdapter(), &ThumbnailOptions{Sizes: []int{16}, Events: tt.events})
+			obs.OnEvent(NewEvent(tt.event, img, ""))
+			if _, ok := obs.GetThumbnail("photo", 16); ok != tt.want {
+				t.Errorf("thumbnail stored = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		w, h int
+		want map[int]stdimage.Point
+	}{
+		{1600, 900, map[int]stdimage.Point{128: {128, 72}, 512: {512, 288}, 1024: {1024, 576}}},
+		{700, 1000, map[int]stdimage.Point{128: {90, 128}, 512: {358, 512}, 1024: {700, 1000}}},
+		// Never upscaled.
+		{300, 200, map[int]stdimage.Point{128: {128, 85}, 512: {300, 200}, 1024: {300, 200}}},
+	}
+	for _, tt := range tests {
+		store := storage.NewMapAdapter()
+		obs := NewThumbnailGeneratorObserver("thumbs", store, nil)
+		img := image.NewBasicImage("photo", gradient(tt.w, tt.h), image.ImageMetadata{})
+		obs.OnEvent(NewEvent(EventImageProcessed, img, ""))
+
+		for _, size := range DefaultThumbnailSizes {
+			if id := obs.ThumbnailID("photo", size); id != fmt.Sprintf("photo.thumb-%d.jpeg", size) {
+				t.Errorf("%d thumbnail ID %s", size, id)
+			} else if _, err := store.Load(id); err != nil {
+				t.Errorf("%dx%d: %d thumbnail: %v", tt.w, tt.h, size, err)
+			}
+			thumb := decodeThumbnail(t, obs, size)
+			got := thumb.Bounds().Size()
+			if got != tt.want[size] {
+				t.Errorf("%dx%d: %d thumbnail is %v, want %v", tt.w, tt.h, size, got, tt.want[size])
+			}
+			if max(got.X, got.Y) != min(size, max(tt.w, tt.h)) {
+				t.Errorf("%dx%d: %d thumbnail has longest edge %d", tt.w, tt.h, size, max(got.X, got.Y))
+			}
+			// Rounding each side to whole pixels moves the aspect ratio
+			// by at most half a pixel's worth.
+			aspect, want := float64(got.X)/float64(got.Y), float64(tt.w)/float64(tt.h)
+			if math.Abs(aspect-want) > want/float64(min(got.X, got.Y)) {
+				t.Errorf("%dx%d: %d thumbnail aspect %.3f, want %.3f", tt.w, tt.h, size, aspect, want)
+			}
+			if thumb.Metadata().Format != codec.FormatJPEG {
+				t.Errorf("%d thumbnail format %s", size, thumb.Metadata().Format)
+			}
+		}
+	}
+}
+
+func TestThumbnailUpright(t *testing.T) {
+	// Orientation 6 is stored landscape but displayed portrait.
+	img := image.NewBasicImage("photo", gradient(200, 100), image.ImageMetadata{EXIF: &exif.EXIF{Orientation: 6}})
+	obs := NewThumbnailGeneratorObserver("thumbs", storage.NewMapAdapter(), &ThumbnailOptions{Sizes: []int{64}})
+	if err := obs.Generate(img); err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeThumbnail(t, obs, 64).Bounds().Size(); got != stdimage.Pt(32, 64) {
+		t.Errorf("thumbnail is %v, want 32x64", got)
+	}
+}
+
+func TestThumbnailFormatAndEncodeOptions(t *testing.T) {
+	img := image.NewBasicImage("photo", gradient(256, 256), image.ImageMetadata{})
+
+	obs := NewThumbnailGeneratorObserver("thumbs", storage.NewMapAdapter(), &ThumbnailOptions{Sizes: []int{64}, Format: codec.FormatPNG})
+	if err := obs.Generate(img); err != nil {
+		t.Fatal(err)
+	}
+	if id := obs.ThumbnailID("photo", 64); id != "photo.thumb-64.png" {
+		t.Errorf("PNG thumbnail stored as %s", id)
+	}
+	if f := decodeThumbnail(t, obs, 64).Metadata().Format; f != codec.FormatPNG {
+		t.Errorf("thumbnail format %s, want PNG", f)
+	}
+
+	sizes := map[int]int{}
+	for _, quality := range []int{20, 95} {
+		obs := NewThumbnailGeneratorObserver("thumbs", storage.NewMapAdapter(), &ThumbnailOptions{Sizes: []int{256}, Encode: &codec.EncodeOptions{Quality: quality}})
+		if err := obs.Generate(img); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := obs.GetThumbnail("photo", 256)
+		sizes[quality] = len(data)
+	}
+	if sizes[20] >= sizes[95] {
+		t.Errorf("quality 20 thumbnail is %d bytes, quality 95 %d", sizes[20], sizes[95])
+	}
+
+	if err := NewThumbnailGeneratorObserver("thumbs", storage.NewMapAdapter(), &ThumbnailOptions{Format: "nosuch"}).Generate(img); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
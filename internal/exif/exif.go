@@ -0,0 +1,473 @@
+// Package exif reads and writes EXIF metadata. EXIF is a TIFF directory
+// structure, embedded in JPEG APP1 segments and in TIFF files themselves, so
+// this package also provides the directory reader and writer used by the
+// TIFF codec.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Tags in the primary directory (IFD0).
+const (
+	tagMake      = 271
+	tagModel     = 272
+	tagOrient    = 274
+	tagSoftware  = 305
+	tagDateTime  = 306
+	tagArtist    = 315
+	tagCopyright = 33432
+	tagExifIFD   = 34665
+	tagGPSIFD    = 34853
+)
+
+// Tags in the Exif sub-directory.
+const (
+	tagExposureTime       = 33434
+	tagFNumber            = 33437
+	tagISO                = 34855
+	tagExifVersion        = 36864
+	tagDateTimeOriginal   = 36867
+	tagOffsetTime         = 36880
+	tagOffsetTimeOriginal = 36881
+	tagFocalLength        = 37386
+	tagMakerNote          = 37500
+	tagPixelXDimension    = 40962
+	tagPixelYDimension    = 40963
+	tagInteropIFD         = 40965
+	tagLensModel          = 42036
+)
+
+// Tags in the GPS sub-directory.
+const (
+	tagGPSVersion  = 0
+	tagGPSLatRef   = 1
+	tagGPSLat      = 2
+	tagGPSLonRef   = 3
+	tagGPSLon      = 4
+	tagGPSAltRef   = 5
+	tagGPSAltitude = 6
+)
+
+const (
+	dateTimeLayout = "2006:01:02 15:04:05"
+	offsetLayout   = "-07:00"
+
+	// maxPreserveSize bounds the size of an unparsed entry kept for writing.
+	maxPreserveSize = 1 << 16
+)
+
+// Header is the prefix of an EXIF JPEG APP1 segment payload.
+const Header = "Exif\x00\x00"
+
+// Orientation is the EXIF orientation tag: how the stored pixels must be
+// transformed to display the image upright.
+type Orientation int
+
+const (
+	OrientationNormal     Orientation = 1 + iota // no transform
+	OrientationFlipH                             // mirror left-right
+	OrientationRotate180                         // rotate 180°
+	OrientationFlipV                             // mirror top-bottom
+	OrientationTranspose                         // mirror along the top-left diagonal
+	OrientationRotate90                          // rotate 90° clockwise
+	OrientationTransverse                        // mirror along the top-right diagonal
+	OrientationRotate270                         // rotate 270° clockwise
+)
+
+func (o Orientation) String() string {
+	switch o {
+	case OrientationNormal:
+		return "normal"
+	case OrientationFlipH:
+		return "flip horizontal"
+	case OrientationRotate180:
+		return "rotate 180"
+	case OrientationFlipV:
+		return "flip vertical"
+	case OrientationTranspose:
+		return "transpose"
+	case OrientationRotate90:
+		return "rotate 90 CW"
+	case OrientationTransverse:
+		return "transverse"
+	case OrientationRotate270:
+		return "rotate 270 CW"
+	default:
+		return "unknown"
+	}
+}
+
+// Rational is an unsigned EXIF fraction such as an exposure time of 1/250.
+type Rational struct {
+	Num, Den uint32
+}
+
+// Float returns the value of r, or 0 for a zero denominator.
+func (r Rational) Float() float64 {
+	if r.Den == 0 {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+func (r Rational) String() string {
+	if r.Den == 1 {
+		return fmt.Sprintf("%d", r.Num)
+	}
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// GPS is a geographic position in decimal degrees.
+type GPS struct {
+	Latitude  float64 // negative south of the equator
+	Longitude float64 // negative west of Greenwich
+	Altitude  float64 // meters; negative below sea level
+}
+
+// EXIF holds the commonly used EXIF fields. Entries of the Exif
+// sub-directory that have no field here are kept as-is and written back,
+// so re-encoding a photo does not strip them. The exception is MakerNote,
+// whose vendor formats hold offsets into the original file that re-encoding
+// would leave dangling.
+type EXIF struct {
+	Make             string
+	Model            string
+	Software         string
+	LensModel        string
+	Artist           string
+	Copyright        string
+	Orientation      Orientation // 0 when not recorded
+	DateTime         time.Time   // last modification
+	DateTimeOriginal time.Time   // when the photo was taken
+	ExposureTime     Rational    // seconds
+	FNumber          float64
+	ISO              int
+	FocalLength      float64 // millimeters
+	PixelXDimension  int     // image width; encoders record the size they write
+	PixelYDimension  int     // image height
+	GPS              *GPS
+
+	extra []Field // unparsed Exif sub-directory entries, little-endian
+}
+
+// Camera returns "Make Model", omitting the make when the model already
+// starts with it, as many manufacturers' model strings do.
+func (e *EXIF) Camera() string {
+	switch {
+	case e.Model == "":
+		return e.Make
+	case e.Make == "" || strings.HasPrefix(e.Model, e.Make):
+		return e.Model
+	default:
+		return e.Make + " " + e.Model
+	}
+}
+
+// WithoutPreserved returns a copy of e without the unparsed Exif entries
+// kept from the source, for when they make the block too large to write.
+func (e *EXIF) WithoutPreserved() *EXIF {
+	c := *e
+	c.extra = nil
+	return &c
+}
+
+// Parse decodes a TIFF-structured EXIF block, the payload of a JPEG APP1
+// segment after Header.
+func Parse(data []byte) (*EXIF, error) {
+	r, off, err := NewReader(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXIF data: %w", err)
+	}
+	ifd0, _, err := r.ReadIFD(off)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EXIF data: %w", err)
+	}
+	e, err := FromIFD(r, ifd0)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return &EXIF{}, nil
+	}
+	return e, nil
+}
+
+// FromIFD extracts EXIF fields from a primary directory and the Exif and
+// GPS sub-directories it points to. It returns nil if there are none.
+func FromIFD(r *Reader, ifd0 IFD) (*EXIF, error) {
+	e := &EXIF{
+		Make:        r.ASCII(ifd0, tagMake),
+		Model:       r.ASCII(ifd0, tagModel),
+		Software:    r.ASCII(ifd0, tagSoftware),
+		Artist:      r.ASCII(ifd0, tagArtist),
+		Copyright:   r.ASCII(ifd0, tagCopyright),
+		Orientation: Orientation(r.Uint(ifd0, tagOrient, 0)),
+	}
+	if e.Orientation < OrientationNormal || e.Orientation > OrientationRotate270 {
+		e.Orientation = 0
+	}
+	found := e.Make != "" || e.Model != "" || e.Software != "" ||
+		e.Artist != "" || e.Copyright != "" || e.Orientation != 0
+
+	var sub IFD
+	if off := r.Uint(ifd0, tagExifIFD, 0); off != 0 {
+		var err error
+		if sub, _, err = r.ReadIFD(off); err != nil {
+			return nil, fmt.Errorf("invalid EXIF data: exif directory: %w", err)
+		}
+		found = true
+	}
+	e.DateTime = parseDateTime(r.ASCII(ifd0, tagDateTime), r.ASCII(sub, tagOffsetTime))
+	e.DateTimeOriginal = parseDateTime(r.ASCII(sub, tagDateTimeOriginal), r.ASCII(sub, tagOffsetTimeOriginal))
+	e.LensModel = r.ASCII(sub, tagLensModel)
+	e.ISO = int(r.Uint(sub, tagISO, 0))
+	e.PixelXDimension = int(r.Uint(sub, tagPixelXDimension, 0))
+	e.PixelYDimension = int(r.Uint(sub, tagPixelYDimension, 0))
+	if v := r.rationals(sub, tagExposureTime); len(v) > 0 {
+		e.ExposureTime = v[0]
+	}
+	if v := r.rationals(sub, tagFNumber); len(v) > 0 {
+		e.FNumber = v[0].Float()
+	}
+	if v := r.rationals(sub, tagFocalLength); len(v) > 0 {
+		e.FocalLength = v[0].Float()
+	}
+
+	// Keep everything not written from a field above, except MakerNote.
+	skip := map[uint16]bool{
+		tagExposureTime: true, tagFNumber: true, tagISO: true, tagDateTimeOriginal: true,
+		tagOffsetTime: true, tagOffsetTimeOriginal: true, tagFocalLength: true,
+		tagLensModel: true, tagInteropIFD: true, tagMakerNote: true,
+		tagPixelXDimension: true, tagPixelYDimension: true,
+	}
+	for tag, f := range sub {
+		if !skip[tag] && len(f.Value) <= maxPreserveSize {
+			e.extra = append(e.extra, f.littleEndian(r.Order))
+		}
+	}
+
+	if off := r.Uint(ifd0, tagGPSIFD, 0); off != 0 {
+		gps, _, err := r.ReadIFD(off)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXIF data: GPS directory: %w", err)
+		}
+		e.GPS = r.gps(gps)
+		found = true
+	}
+	if !found && e.DateTime.IsZero() {
+		return nil, nil
+	}
+	return e, nil
+}
+
+// rationals returns the values of a RATIONAL field.
+func (t *Reader) rationals(d IFD, tag uint16) []Rational {
+	f, ok := d[tag]
+	if !ok || f.Type != TypeRational {
+		return nil
+	}
+	vals := make([]Rational, f.Count)
+	for i := range vals {
+		vals[i] = Rational{t.Order.Uint32(f.Value[8*i:]), t.Order.Uint32(f.Value[8*i+4:])}
+	}
+	return vals
+}
+
+func (t *Reader) gps(d IFD) *GPS {
+	lat, lon := t.rationals(d, tagGPSLat), t.rationals(d, tagGPSLon)
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil
+	}
+	g := &GPS{
+		Latitude:  lat[0].Float() + lat[1].Float()/60 + lat[2].Float()/3600,
+		Longitude: lon[0].Float() + lon[1].Float()/60 + lon[2].Float()/3600,
+	}
+	if t.ASCII(d, tagGPSLatRef) == "S" {
+		g.Latitude = -g.Latitude
+	}
+	if t.ASCII(d, tagGPSLonRef) == "W" {
+		g.Longitude = -g.Longitude
+	}
+	if alt := t.rationals(d, tagGPSAltitude); len(alt) > 0 {
+		g.Altitude = alt[0].Float()
+		if t.Uint(d, tagGPSAltRef, 0) == 1 {
+			g.Altitude = -g.Altitude
+		}
+	}
+	return g
+}
+
+// parseDateTime parses an EXIF timestamp, which has no zone of its own;
+// offset is the matching OffsetTime* value, and local time is assumed
+// without one.
+func parseDateTime(s, offset string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	loc := time.Local
+	if o, err := time.Parse(offsetLayout, offset); err == nil {
+		_, secs := o.Zone()
+		loc = time.FixedZone("", secs)
+	}
+	t, err := time.ParseInLocation(dateTimeLayout, s, loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// IFD0 returns the fields that belong in the primary directory, excluding
+// the sub-directory pointers produced by SubIFDs.
+func (e *EXIF) IFD0() []Field {
+	var fields []Field
+	for _, s := range []struct {
+		tag uint16
+		val string
+	}{
+		{tagMake, e.Make}, {tagModel, e.Model}, {tagSoftware, e.Software},
+		{tagArtist, e.Artist}, {tagCopyright, e.Copyright},
+	} {
+		if s.val != "" {
+			fields = append(fields, ASCIIField(s.tag, s.val))
+		}
+	}
+	if e.Orientation != 0 {
+		fields = append(fields, ShortField(tagOrient, uint16(e.Orientation)))
+	}
+	if !e.DateTime.IsZero() {
+		fields = append(fields, ASCIIField(tagDateTime, e.DateTime.Format(dateTimeLayout)))
+	}
+	return fields
+}
+
+// SubIFDs encodes the Exif and GPS sub-directories to be written at offset
+// off, returning them with the pointer fields to add to the primary
+// directory. The encoded size does not depend on off.
+func (e *EXIF) SubIFDs(off uint32) ([]Field, []byte) {
+	var pointers []Field
+	var data []byte
+
+	sub := e.exifFields()
+	pointers = append(pointers, LongField(tagExifIFD, off))
+	data = append(data, EncodeIFD(sub, off, 0)...)
+
+	if e.GPS != nil {
+		at := off + uint32(len(data))
+		pointers = append(pointers, LongField(tagGPSIFD, at))
+		data = append(data, EncodeIFD(e.gpsFields(), at, 0)...)
+	}
+	return pointers, data
+}
+
+func (e *EXIF) exifFields() []Field {
+	fields := append([]Field(nil), e.extra...)
+	if !hasTag(fields, tagExifVersion) {
+		fields = append(fields, UndefinedField(tagExifVersion, []byte("0232")))
+	}
+	if !e.DateTime.IsZero() {
+		fields = append(fields, ASCIIField(tagOffsetTime, e.DateTime.Format(offsetLayout)))
+	}
+	if !e.DateTimeOriginal.IsZero() {
+		fields = append(fields,
+			ASCIIField(tagDateTimeOriginal, e.DateTimeOriginal.Format(dateTimeLayout)),
+			ASCIIField(tagOffsetTimeOriginal, e.DateTimeOriginal.Format(offsetLayout)))
+	}
+	if e.ExposureTime.Den != 0 {
+		fields = append(fields, RationalField(tagExposureTime, e.ExposureTime.Num, e.ExposureTime.Den))
+	}
+	if e.FNumber > 0 {
+		r := toRational(e.FNumber, 10)
+		fields = append(fields, RationalField(tagFNumber, r.Num, r.Den))
+	}
+	if e.ISO > 0 {
+		fields = append(fields, ShortField(tagISO, uint16(min(e.ISO, math.MaxUint16))))
+	}
+	if e.FocalLength > 0 {
+		r := toRational(e.FocalLength, 10)
+		fields = append(fields, RationalField(tagFocalLength, r.Num, r.Den))
+	}
+	if e.LensModel != "" {
+		fields = append(fields, ASCIIField(tagLensModel, e.LensModel))
+	}
+	if e.PixelXDimension > 0 && e.PixelYDimension > 0 {
+		fields = append(fields,
+			LongField(tagPixelXDimension, uint32(e.PixelXDimension)),
+			LongField(tagPixelYDimension, uint32(e.PixelYDimension)))
+	}
+	return fields
+}
+
+func (e *EXIF) gpsFields() []Field {
+	latRef, lonRef := "N", "E"
+	if e.GPS.Latitude < 0 {
+		latRef = "S"
+	}
+	if e.GPS.Longitude < 0 {
+		lonRef = "W"
+	}
+	altRef := byte(0)
+	if e.GPS.Altitude < 0 {
+		altRef = 1
+	}
+	alt := toRational(math.Abs(e.GPS.Altitude), 100)
+	return []Field{
+		{Tag: tagGPSVersion, Type: TypeByte, Count: 4, Value: []byte{2, 3, 0, 0}},
+		ASCIIField(tagGPSLatRef, latRef),
+		degreesField(tagGPSLat, e.GPS.Latitude),
+		ASCIIField(tagGPSLonRef, lonRef),
+		degreesField(tagGPSLon, e.GPS.Longitude),
+		{Tag: tagGPSAltRef, Type: TypeByte, Count: 1, Value: []byte{altRef}},
+		RationalField(tagGPSAltitude, alt.Num, alt.Den),
+	}
+}
+
+// degreesField writes an angle as degrees, minutes and hundredths of seconds.
+func degreesField(tag uint16, deg float64) Field {
+	deg = math.Abs(deg)
+	d := math.Floor(deg)
+	m := math.Floor((deg - d) * 60)
+	s := (deg - d - m/60) * 3600
+	b := make([]byte, 24)
+	for i, r := range []Rational{{uint32(d), 1}, {uint32(m), 1}, toRational(s, 100)} {
+		binary.LittleEndian.PutUint32(b[8*i:], r.Num)
+		binary.LittleEndian.PutUint32(b[8*i+4:], r.Den)
+	}
+	return Field{Tag: tag, Type: TypeRational, Count: 3, Value: b}
+}
+
+func toRational(v float64, den uint32) Rational {
+	return Rational{uint32(math.Round(v * float64(den))), den}
+}
+
+func hasTag(fields []Field, tag uint16) bool {
+	for _, f := range fields {
+		if f.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal encodes e as a standalone little-endian TIFF structure, the form
+// stored in a JPEG APP1 segment after Header.
+func (e *EXIF) Marshal() []byte {
+	const first = 8
+	fields := e.IFD0()
+	pointers, _ := e.SubIFDs(0)
+	subOff := first + IFDSize(append(fields, pointers...))
+	pointers, sub := e.SubIFDs(subOff)
+	fields = append(fields, pointers...)
+
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(first))
+	buf.Write(EncodeIFD(fields, first, 0))
+	buf.Write(sub)
+	return buf.Bytes()
+}
@@ -0,0 +1,126 @@
+package exif
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// cameraEXIF builds an EXIF block as a camera would write it, with a
+// MakerNote and the pixel dimensions of the original capture.
+func cameraEXIF() []byte {
+	const first = 8
+	sub := []Field{
+		ShortField(tagISO, 400),
+		ASCIIField(tagDateTimeOriginal, "2024:06:01 12:30:00"),
+		LongField(tagPixelXDimension, 6000),
+		ShortField(tagPixelYDimension, 4000),
+		UndefinedField(tagMakerNote, []byte("Nikon\x00\x02\x10\x00\x00MM\x00*\x00\x00\x00\x08")),
+		ASCIIField(0xA420, "unique-id-1234"), // ImageUniqueID, kept as-is
+	}
+	ifd0 := []Field{ASCIIField(tagMake, "NIKON"), LongField(tagExifIFD, 0)}
+	subOff := first + IFDSize(ifd0)
+	ifd0[1] = LongField(tagExifIFD, subOff)
+
+	data := []byte("II*\x00\x08\x00\x00\x00")
+	data = append(data, EncodeIFD(ifd0, first, 0)...)
+	return append(data, EncodeIFD(sub, subOff, 0)...)
+}
+
+func subDirectory(t *testing.T, data []byte) (*Reader, IFD) {
+	t.Helper()
+	r, off, err := NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifd0, _, err := r.ReadIFD(off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, _, err := r.ReadIFD(r.Uint(ifd0, tagExifIFD, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, sub
+}
+
+func TestRewriteDropsMakerNoteAndStaleDimensions(t *testing.T) {
+	e, err := Parse(cameraEXIF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PixelXDimension != 6000 || e.PixelYDimension != 4000 {
+		t.Errorf("parsed dimensions %dx%d, want 6000x4000", e.PixelXDimension, e.PixelYDimension)
+	}
+
+	// An encoder writing a 1200x800 resize records the new size.
+	e.PixelXDimension, e.PixelYDimension = 1200, 800
+	r, sub := subDirectory(t, e.Marshal())
+	if _, ok := sub[tagMakerNote]; ok {
+		t.Error("MakerNote written back")
+	}
+	if w, h := r.Uint(sub, tagPixelXDimension, 0), r.Uint(sub, tagPixelYDimension, 0); w != 1200 || h != 800 {
+		t.Errorf("written dimensions %dx%d, want 1200x800", w, h)
+	}
+	if got := r.ASCII(sub, 0xA420); got != "unique-id-1234" {
+		t.Errorf("ImageUniqueID %q not preserved", got)
+	}
+	if iso := r.Uint(sub, tagISO, 0); iso != 400 {
+		t.Errorf("ISO %d, want 400", iso)
+	}
+}
+
+func TestUnknownDimensionsAreOmitted(t *testing.T) {
+	e := &EXIF{Make: "Acme", ISO: 100}
+	_, sub := subDirectory(t, e.Marshal())
+	for _, tag := range []uint16{tagPixelXDimension, tagPixelYDimension} {
+		if _, ok := sub[tag]; ok {
+			t.Errorf("tag %d written without a size", tag)
+		}
+	}
+}
+
+func TestParseBigEndianDimensions(t *testing.T) {
+	// A big-endian block with SHORT dimensions, as some cameras write.
+	be := binary.BigEndian
+	data := []byte("MM\x00*\x00\x00\x00\x08")
+	entry := func(tag, typ uint16, count, value uint32) []byte {
+		b := make([]byte, 12)
+		be.PutUint16(b, tag)
+		be.PutUint16(b[2:], typ)
+		be.PutUint32(b[4:], count)
+		be.PutUint32(b[8:], value)
+		return b
+	}
+	data = append(data, 0, 1)
+	data = append(data, entry(tagExifIFD, TypeLong, 1, 8+2+12+4)...)
+	data = append(data, 0, 0, 0, 0)
+	data = append(data, 0, 2)
+	data = append(data, entry(tagPixelXDimension, TypeShort, 1, 640<<16)...)
+	data = append(data, entry(tagPixelYDimension, TypeShort, 1, 480<<16)...)
+	data = append(data, 0, 0, 0, 0)
+
+	e, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PixelXDimension != 640 || e.PixelYDimension != 480 {
+		t.Errorf("parsed %dx%d, want 640x480", e.PixelXDimension, e.PixelYDimension)
+	}
+}
+
+func TestWithoutPreserved(t *testing.T) {
+	e, err := Parse(cameraEXIF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, sub := subDirectory(t, e.WithoutPreserved().Marshal())
+	if _, ok := sub[0xA420]; ok {
+		t.Error("preserved ImageUniqueID written")
+	}
+	if iso := r.Uint(sub, tagISO, 0); iso != 400 {
+		t.Errorf("ISO %d, want 400", iso)
+	}
+	if r, sub := subDirectory(t, e.Marshal()); r.ASCII(sub, 0xA420) != "unique-id-1234" {
+		t.Error("original lost its preserved entries")
+	}
+}
@@ -0,0 +1,261 @@
+package exif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// TIFF field types.
+const (
+	TypeByte      = 1
+	TypeASCII     = 2
+	TypeShort     = 3
+	TypeLong      = 4
+	TypeRational  = 5
+	TypeSByte     = 6
+	TypeUndefined = 7
+	TypeSShort    = 8
+	TypeSLong     = 9
+	TypeSRational = 10
+	TypeFloat     = 11
+	TypeDouble    = 12
+)
+
+// typeSize is the byte size of one value of each field type.
+var typeSize = [...]uint32{
+	TypeByte: 1, TypeASCII: 1, TypeShort: 2, TypeLong: 4, TypeRational: 8,
+	TypeSByte: 1, TypeUndefined: 1, TypeSShort: 2, TypeSLong: 4, TypeSRational: 8,
+	TypeFloat: 4, TypeDouble: 8,
+}
+
+// maxIFDEntries bounds the entry count accepted from a directory header.
+const maxIFDEntries = 4096
+
+// Field is one directory entry with its value bytes in file byte order.
+type Field struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Value []byte
+}
+
+// Uints returns the values of an unsigned integer field.
+func (f Field) Uints(order binary.ByteOrder) []uint32 {
+	vals := make([]uint32, 0, f.Count)
+	for i := uint32(0); i < f.Count; i++ {
+		switch f.Type {
+		case TypeByte, TypeUndefined:
+			vals = append(vals, uint32(f.Value[i]))
+		case TypeShort:
+			vals = append(vals, uint32(order.Uint16(f.Value[2*i:])))
+		case TypeLong:
+			vals = append(vals, order.Uint32(f.Value[4*i:]))
+		default:
+			return nil
+		}
+	}
+	return vals
+}
+
+// IFD is a decoded image file directory keyed by tag.
+type IFD map[uint16]Field
+
+// Reader parses directories from an in-memory TIFF structure. The same
+// layout is used by standalone TIFF files and by EXIF blocks.
+type Reader struct {
+	Data  []byte
+	Order binary.ByteOrder
+}
+
+// NewReader validates the 8-byte header and returns the reader with the
+// offset of the first directory.
+func NewReader(data []byte) (*Reader, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, fmt.Errorf("header too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return nil, 0, fmt.Errorf("bad signature %q", data[:4])
+	}
+	return &Reader{Data: data, Order: order}, order.Uint32(data[4:]), nil
+}
+
+// ReadIFD parses the directory at off and returns it with the offset of the
+// next directory (0 at the end of the chain).
+func (t *Reader) ReadIFD(off uint32) (IFD, uint32, error) {
+	if uint64(off)+2 > uint64(len(t.Data)) {
+		return nil, 0, fmt.Errorf("directory offset %d out of range", off)
+	}
+	n := uint32(t.Order.Uint16(t.Data[off:]))
+	if n > maxIFDEntries {
+		return nil, 0, fmt.Errorf("directory at %d has %d entries", off, n)
+	}
+	end := uint64(off) + 2 + 12*uint64(n)
+	if end+4 > uint64(len(t.Data)) {
+		return nil, 0, fmt.Errorf("directory at %d truncated", off)
+	}
+
+	dir := make(IFD, n)
+	for i := uint32(0); i < n; i++ {
+		e := t.Data[off+2+12*i:]
+		f := Field{
+			Tag:   t.Order.Uint16(e),
+			Type:  t.Order.Uint16(e[2:]),
+			Count: t.Order.Uint32(e[4:]),
+		}
+		if f.Type == 0 || int(f.Type) >= len(typeSize) {
+			continue // unknown types must be skipped
+		}
+		size := uint64(typeSize[f.Type]) * uint64(f.Count)
+		if size <= 4 {
+			f.Value = e[8 : 8+size]
+		} else {
+			at := uint64(t.Order.Uint32(e[8:]))
+			if at+size > uint64(len(t.Data)) {
+				return nil, 0, fmt.Errorf("tag %d value out of range", f.Tag)
+			}
+			f.Value = t.Data[at : at+size]
+		}
+		dir[f.Tag] = f
+	}
+	return dir, t.Order.Uint32(t.Data[end:]), nil
+}
+
+// Uints returns the unsigned integer values of tag, or nil if it is absent.
+func (t *Reader) Uints(d IFD, tag uint16) []uint32 {
+	f, ok := d[tag]
+	if !ok {
+		return nil
+	}
+	return f.Uints(t.Order)
+}
+
+// Uint returns the first value of tag, or def if the tag is absent.
+func (t *Reader) Uint(d IFD, tag uint16, def uint32) uint32 {
+	if vals := t.Uints(d, tag); len(vals) > 0 {
+		return vals[0]
+	}
+	return def
+}
+
+// ASCII returns the NUL-terminated string value of tag.
+func (t *Reader) ASCII(d IFD, tag uint16) string {
+	f, ok := d[tag]
+	if !ok || f.Type != TypeASCII {
+		return ""
+	}
+	v := f.Value
+	for i, c := range v {
+		if c == 0 {
+			v = v[:i]
+			break
+		}
+	}
+	return string(v)
+}
+
+// The field constructors below produce little-endian values, the only byte
+// order the writer emits.
+
+// ShortField creates a SHORT field.
+func ShortField(tag uint16, vals ...uint16) Field {
+	b := make([]byte, 2*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint16(b[2*i:], v)
+	}
+	return Field{Tag: tag, Type: TypeShort, Count: uint32(len(vals)), Value: b}
+}
+
+// LongField creates a LONG field.
+func LongField(tag uint16, vals ...uint32) Field {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return Field{Tag: tag, Type: TypeLong, Count: uint32(len(vals)), Value: b}
+}
+
+// RationalField creates a single RATIONAL field.
+func RationalField(tag uint16, num, den uint32) Field {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, num)
+	binary.LittleEndian.PutUint32(b[4:], den)
+	return Field{Tag: tag, Type: TypeRational, Count: 1, Value: b}
+}
+
+// ASCIIField creates a NUL-terminated ASCII field.
+func ASCIIField(tag uint16, s string) Field {
+	b := append([]byte(s), 0)
+	return Field{Tag: tag, Type: TypeASCII, Count: uint32(len(b)), Value: b}
+}
+
+// UndefinedField creates an UNDEFINED (opaque bytes) field.
+func UndefinedField(tag uint16, b []byte) Field {
+	return Field{Tag: tag, Type: TypeUndefined, Count: uint32(len(b)), Value: b}
+}
+
+// littleEndian returns f with its value bytes converted from order to
+// little-endian, so fields read from big-endian files can be written back.
+func (f Field) littleEndian(order binary.ByteOrder) Field {
+	if order == binary.LittleEndian {
+		return f
+	}
+	width := typeSize[f.Type]
+	if f.Type == TypeRational || f.Type == TypeSRational {
+		width = 4 // two LONGs
+	}
+	v := append([]byte(nil), f.Value...)
+	for i := 0; i+int(width) <= len(v); i += int(width) {
+		for a, b := i, i+int(width)-1; a < b; a, b = a+1, b-1 {
+			v[a], v[b] = v[b], v[a]
+		}
+	}
+	f.Value = v
+	return f
+}
+
+// IFDSize is the encoded size of a directory including out-of-line values.
+func IFDSize(fields []Field) uint32 {
+	size := 2 + 12*uint32(len(fields)) + 4
+	for _, f := range fields {
+		if n := uint32(len(f.Value)); n > 4 {
+			size += n + n&1
+		}
+	}
+	return size
+}
+
+// EncodeIFD serializes a little-endian directory that will be written at
+// offset off. Values that do not fit in an entry follow the entry table,
+// each padded to a word boundary. Entries are sorted by tag as required.
+func EncodeIFD(fields []Field, off, next uint32) []byte {
+	sorted := append([]Field(nil), fields...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tag < sorted[j].Tag })
+
+	le := binary.LittleEndian
+	buf := make([]byte, 2+12*len(sorted)+4, IFDSize(sorted))
+	le.PutUint16(buf, uint16(len(sorted)))
+	for i, f := range sorted {
+		e := buf[2+12*i:]
+		le.PutUint16(e, f.Tag)
+		le.PutUint16(e[2:], f.Type)
+		le.PutUint32(e[4:], f.Count)
+		if len(f.Value) <= 4 {
+			copy(e[8:12], f.Value)
+			continue
+		}
+		le.PutUint32(e[8:], off+uint32(len(buf)))
+		buf = append(buf, f.Value...)
+		if len(f.Value)&1 == 1 {
+			buf = append(buf, 0)
+		}
+	}
+	le.PutUint32(buf[2+12*len(sorted):], next)
+	return buf
+}
@@ -22,9 +22,10 @@ func NewGallery() *Gallery {
 	}
 }
 
-// AddImage adds an image to the gallery
+// AddImage adds an image to the gallery, turned upright according to its
+// EXIF orientation
 func (g *Gallery) AddImage(img image.Image) {
-	g.images = append(g.images, img)
+	g.images = append(g.images, image.Upright(img))
 }
 
 // Images returns all images
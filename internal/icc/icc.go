@@ -0,0 +1,299 @@
+// Package icc reads ICC color profiles and converts pixels described by
+// matrix/TRC profiles to sRGB. Profiles built from lookup tables (most
+// printer and CMYK profiles) are carried as opaque data but cannot be
+// converted.
+package icc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUnsupported is returned when converting with a profile that is not a
+// matrix/TRC RGB or gray TRC profile.
+var ErrUnsupported = errors.New("unsupported ICC profile")
+
+// errTruncated is returned for a tag too short for its declared contents.
+var errTruncated = errors.New("truncated tag")
+
+const (
+	headerSize = 128
+	magic      = "acsp"
+)
+
+// Color spaces, as stored in the profile header.
+const (
+	ColorSpaceRGB  = "RGB "
+	ColorSpaceGray = "GRAY"
+	ColorSpaceCMYK = "CMYK"
+)
+
+// Profile is an ICC color profile. Data holds the profile verbatim so that
+// it can be embedded again on encode.
+type Profile struct {
+	Data        []byte
+	Version     string // e.g. "4.3"
+	Class       string // device class, e.g. "mntr" for displays
+	ColorSpace  string // data color space, e.g. ColorSpaceRGB
+	Description string
+
+	matrix *[3][3]float64 // device RGB to PCS XYZ; nil unless matrix/TRC
+	curves []curve        // per-channel tone curves, one for gray
+}
+
+// Parse decodes the parts of an ICC profile needed to describe and convert
+// it. The profile must have a valid header and tag table.
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < headerSize+4 || string(data[36:40]) != magic {
+		return nil, fmt.Errorf("invalid ICC profile: missing header")
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint64(size) > uint64(len(data)) || size < headerSize+4 {
+		return nil, fmt.Errorf("invalid ICC profile: size %d does not match %d bytes", size, len(data))
+	}
+	data = data[:size]
+
+	p := &Profile{
+		Data:       data,
+		Version:    fmt.Sprintf("%d.%d", data[8], data[9]>>4),
+		Class:      string(data[12:16]),
+		ColorSpace: string(data[16:20]),
+	}
+	tags, err := readTags(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ICC profile: %w", err)
+	}
+	if desc, ok := tags["desc"]; ok {
+		if p.Description, err = readText(desc); err != nil {
+			return nil, fmt.Errorf("invalid ICC profile: desc: %w", err)
+		}
+	}
+
+	// Matrix/TRC profiles need XYZ colorants and a curve per channel; for
+	// anything else the conversion data is simply left unset.
+	if string(data[20:24]) != "XYZ " {
+		return p, nil
+	}
+	switch p.ColorSpace {
+	case ColorSpaceRGB:
+		var m [3][3]float64
+		for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			xyz, ok := readXYZ(tags[sig])
+			if !ok {
+				return p, nil
+			}
+			for row := range xyz {
+				m[row][i] = xyz[row]
+			}
+		}
+		var curves []curve
+		for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+			c, err := readCurve(tags[sig])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ICC profile: %s: %w", sig, err)
+			}
+			if c == nil {
+				return p, nil
+			}
+			curves = append(curves, c)
+		}
+		p.matrix, p.curves = &m, curves
+	case ColorSpaceGray:
+		c, err := readCurve(tags["kTRC"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid ICC profile: kTRC: %w", err)
+		}
+		if c != nil {
+			p.curves = []curve{c}
+		}
+	}
+	return p, nil
+}
+
+// String describes the profile for display.
+func (p *Profile) String() string {
+	if p.Description != "" {
+		return p.Description
+	}
+	return fmt.Sprintf("%s profile v%s", strings.TrimSpace(p.ColorSpace), p.Version)
+}
+
+// Convertible reports whether pixels in this profile can be converted to
+// sRGB.
+func (p *Profile) Convertible() bool {
+	return p.curves != nil
+}
+
+// readTags returns the tag table as a map from signature to tag data.
+func readTags(data []byte) (map[string][]byte, error) {
+	n := binary.BigEndian.Uint32(data[headerSize:])
+	if uint64(n)*12 > uint64(len(data)-headerSize-4) {
+		return nil, fmt.Errorf("tag table of %d entries exceeds profile", n)
+	}
+	tags := make(map[string][]byte, n)
+	for i := uint32(0); i < n; i++ {
+		e := data[headerSize+4+12*i:]
+		off, size := binary.BigEndian.Uint32(e[4:]), binary.BigEndian.Uint32(e[8:])
+		if uint64(off)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("tag %q out of bounds", e[:4])
+		}
+		tags[string(e[:4])] = data[off : off+size]
+	}
+	return tags, nil
+}
+
+// readText decodes a v2 textDescriptionType or v4 multiLocalizedUnicodeType
+// tag, preferring English. Other tag types yield an empty string.
+func readText(tag []byte) (string, error) {
+	if len(tag) < 8 {
+		return "", errTruncated
+	}
+	switch string(tag[:4]) {
+	case "desc":
+		if len(tag) < 12 {
+			return "", errTruncated
+		}
+		n := binary.BigEndian.Uint32(tag[8:])
+		if uint64(n) > uint64(len(tag)-12) {
+			return "", errTruncated
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00"), nil
+	case "mluc":
+		if len(tag) < 16 {
+			return "", errTruncated
+		}
+		count, size := binary.BigEndian.Uint32(tag[8:]), binary.BigEndian.Uint32(tag[12:])
+		if size < 12 || uint64(count)*uint64(size) > uint64(len(tag)-16) {
+			return "", errTruncated
+		}
+		text := ""
+		for i := uint32(0); i < count; i++ {
+			r := tag[16+i*size:]
+			n, off := binary.BigEndian.Uint32(r[4:]), binary.BigEndian.Uint32(r[8:])
+			if uint64(off)+uint64(n) > uint64(len(tag)) {
+				continue
+			}
+			units := make([]uint16, n/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(tag[off+2*uint32(j):])
+			}
+			if s := string(utf16.Decode(units)); text == "" || string(r[:2]) == "en" {
+				text = s
+			}
+		}
+		return strings.TrimRight(text, "\x00"), nil
+	case "text":
+		return strings.TrimRight(string(tag[8:]), "\x00"), nil
+	}
+	return "", nil
+}
+
+// readXYZ decodes an XYZType tag holding a single value.
+func readXYZ(tag []byte) ([3]float64, bool) {
+	var xyz [3]float64
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return xyz, false
+	}
+	for i := range xyz {
+		xyz[i] = s15Fixed16(tag[8+4*i:])
+	}
+	return xyz, true
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// curve maps an encoded channel value in [0, 1] to linear light.
+type curve func(x float64) float64
+
+// readCurve decodes a curveType or parametricCurveType tag. It returns a
+// nil curve for a missing tag or one of another type.
+func readCurve(tag []byte) (curve, error) {
+	if tag == nil {
+		return nil, nil
+	}
+	if len(tag) < 12 {
+		return nil, errTruncated
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := binary.BigEndian.Uint32(tag[8:])
+		if uint64(n)*2 > uint64(len(tag)-12) {
+			return nil, errTruncated
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			g := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(len(table)-1)
+			i := int(pos)
+			if i >= len(table)-1 {
+				return table[len(table)-1]
+			}
+			frac := pos - float64(i)
+			return table[i] + (table[i+1]-table[i])*frac
+		}, nil
+	case "para":
+		// Parameter counts for function types 0-4.
+		counts := []int{1, 3, 4, 5, 7}
+		fn := int(binary.BigEndian.Uint16(tag[8:]))
+		if fn >= len(counts) {
+			return nil, fmt.Errorf("unknown parametric curve type %d", fn)
+		}
+		if len(tag) < 12+4*counts[fn] {
+			return nil, errTruncated
+		}
+		var p [7]float64
+		for i := 0; i < counts[fn]; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		pow := func(x float64) float64 { return math.Pow(math.Max(a*x+b, 0), g) }
+		switch fn {
+		case 0:
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		case 1:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(x)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(x float64) float64 {
+				if x >= -b/a {
+					return pow(x) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(x)
+				}
+				return c * x
+			}, nil
+		default:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(x) + e
+				}
+				return c*x + f
+			}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,190 @@
+package icc
+
+import (
+	"encoding/binary"
+	stdimage "image"
+	"math"
+	"testing"
+	"unicode/utf16"
+)
+
+type tag struct {
+	sig  string
+	data []byte
+}
+
+// buildProfile assembles a v4 display profile with the given tags.
+func buildProfile(space string, tags ...tag) []byte {
+	data := make([]byte, headerSize+4+12*len(tags))
+	data[8], data[9] = 4, 0x30
+	copy(data[12:], "mntr")
+	copy(data[16:], space)
+	copy(data[20:], "XYZ ")
+	copy(data[36:], magic)
+	binary.BigEndian.PutUint32(data[headerSize:], uint32(len(tags)))
+	for i, t := range tags {
+		e := data[headerSize+4+12*i:]
+		copy(e, t.sig)
+		binary.BigEndian.PutUint32(e[4:], uint32(len(data)))
+		binary.BigEndian.PutUint32(e[8:], uint32(len(t.data)))
+		data = append(data, t.data...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(data, uint32(len(data)))
+	return data
+}
+
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func fixed(v float64) []byte { return u32(uint32(int32(math.Round(v * 65536)))) }
+
+func mluc(lang, s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := append([]byte("mluc\x00\x00\x00\x00"), u32(1)...)
+	b = append(b, u32(12)...)
+	b = append(b, lang+"US"...)
+	b = append(b, u32(uint32(2*len(units)))...)
+	b = append(b, u32(28)...)
+	for _, u := range units {
+		b = binary.BigEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+func xyz(x, y, z float64) []byte {
+	b := []byte("XYZ \x00\x00\x00\x00")
+	for _, v := range []float64{x, y, z} {
+		b = append(b, fixed(v)...)
+	}
+	return b
+}
+
+// para encodes a parametricCurveType tag of function type fn.
+func para(fn uint16, params ...float64) []byte {
+	b := []byte("para\x00\x00\x00\x00")
+	b = binary.BigEndian.AppendUint16(b, fn)
+	b = append(b, 0, 0)
+	for _, v := range params {
+		b = append(b, fixed(v)...)
+	}
+	return b
+}
+
+// displayP3 builds a profile equivalent to Apple's Display P3: P3
+// primaries adapted to D50 with the sRGB transfer curve.
+func displayP3(trc []byte) []byte {
+	return buildProfile(ColorSpaceRGB,
+		tag{"desc", mluc("en", "Display P3")},
+		tag{"rXYZ", xyz(0.515121, 0.241196, -0.001053)},
+		tag{"gXYZ", xyz(0.291977, 0.692245, 0.041885)},
+		tag{"bXYZ", xyz(0.157104, 0.066574, 0.784073)},
+		tag{"rTRC", trc},
+		tag{"gTRC", trc},
+		tag{"bTRC", trc},
+	)
+}
+
+var srgbTRC = para(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+func TestParseDisplayP3(t *testing.T) {
+	p, err := Parse(displayP3(srgbTRC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Description != "Display P3" || p.String() != "Display P3" {
+		t.Errorf("description %q", p.Description)
+	}
+	if p.Version != "4.3" || p.Class != "mntr" || p.ColorSpace != ColorSpaceRGB {
+		t.Errorf("header v%s %q %q", p.Version, p.Class, p.ColorSpace)
+	}
+	if !p.Convertible() {
+		t.Error("matrix/TRC profile not convertible")
+	}
+}
+
+func TestDisplayP3ToSRGB(t *testing.T) {
+	p, err := Parse(displayP3(srgbTRC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Display P3 values of the sRGB primaries, white and mid gray.
+	tests := []struct{ p3, srgb [3]uint8 }{
+		{[3]uint8{234, 51, 35}, [3]uint8{255, 0, 0}},
+		{[3]uint8{117, 251, 76}, [3]uint8{0, 255, 0}},
+		{[3]uint8{0, 0, 245}, [3]uint8{0, 0, 255}},
+		{[3]uint8{255, 255, 255}, [3]uint8{255, 255, 255}},
+		{[3]uint8{128, 128, 128}, [3]uint8{128, 128, 128}},
+	}
+	src := stdimage.NewNRGBA(stdimage.Rect(0, 0, len(tests), 1))
+	for i, tt := range tests {
+		copy(src.Pix[4*i:], tt.p3[:])
+		src.Pix[4*i+3] = uint8(100 + i)
+	}
+	dst, err := p.ToSRGB(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		got := dst.Pix[4*i : 4*i+4]
+		for c := range tt.srgb {
+			if d := int(got[c]) - int(tt.srgb[c]); d < -3 || d > 3 {
+				t.Errorf("P3 %v: got sRGB %v, want %v", tt.p3, got[:3], tt.srgb)
+				break
+			}
+		}
+		if got[3] != uint8(100+i) {
+			t.Errorf("P3 %v: alpha %d, want %d", tt.p3, got[3], 100+i)
+		}
+	}
+}
+
+func TestParseMalformedTags(t *testing.T) {
+	valid := xyz(1, 1, 1)
+	tests := []struct {
+		name string
+		tag  tag
+	}{
+		{"short desc", tag{"desc", []byte("desc\x00\x00\x00\x00\x00\x00")}},
+		{"desc overrun", tag{"desc", append([]byte("desc\x00\x00\x00\x00"), u32(100)...)}},
+		{"mluc header only", tag{"desc", []byte("mluc\x00\x00\x00\x00\x00\x00\x00\x01")}},
+		{"mluc 14 bytes", tag{"desc", []byte("mluc\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00")}},
+		{"mluc too many records", tag{"desc", mluc("en", "P3")[:20]}},
+		{"curv overrun", tag{"rTRC", append([]byte("curv\x00\x00\x00\x00"), u32(1000)...)}},
+		{"curv short", tag{"rTRC", []byte("curv\x00\x00")}},
+		{"para truncated", tag{"rTRC", para(3, 2.4, 1)}},
+		{"para unknown type", tag{"rTRC", para(9, 1, 1, 1, 1, 1, 1, 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := []tag{{"rXYZ", valid}, {"gXYZ", valid}, {"bXYZ", valid},
+				{"rTRC", srgbTRC}, {"gTRC", srgbTRC}, {"bTRC", srgbTRC}}
+			for i := range tags {
+				if tags[i].sig == tt.tag.sig {
+					tags[i] = tt.tag
+				}
+			}
+			if tt.tag.sig == "desc" {
+				tags = append(tags, tt.tag)
+			}
+			if _, err := Parse(buildProfile(ColorSpaceRGB, tags...)); err == nil {
+				t.Error("malformed tag accepted")
+			}
+		})
+	}
+}
+
+func TestToSRGBNonFinite(t *testing.T) {
+	// A negative gamma sends black to +Inf, and the matrix turns that into
+	// NaN; the conversion must still produce in-range pixels.
+	p, err := Parse(displayP3(para(0, -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := stdimage.NewNRGBA(stdimage.Rect(0, 0, 2, 1))
+	src.Pix[3], src.Pix[4], src.Pix[7] = 0xFF, 0x80, 0xFF
+	if _, err := p.ToSRGB(src); err != nil {
+		t.Fatal(err)
+	}
+}
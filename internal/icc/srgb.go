@@ -0,0 +1,114 @@
+package icc
+
+import (
+	stdimage "image"
+	"math"
+)
+
+// srgbToXYZ holds the sRGB colorants adapted to the D50 illuminant of the
+// profile connection space, as found in the standard sRGB profile.
+var srgbToXYZ = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// xyzToSRGB is the inverse of srgbToXYZ.
+var xyzToSRGB = invert(srgbToXYZ)
+
+// encodeSteps is the resolution of the table mapping linear light back to
+// 8-bit sRGB values.
+const encodeSteps = 4096
+
+// srgbEncode maps linear light, quantized to encodeSteps, to sRGB values.
+var srgbEncode = func() []uint8 {
+	t := make([]uint8, encodeSteps+1)
+	for i := range t {
+		x := float64(i) / encodeSteps
+		if x <= 0.0031308 {
+			x *= 12.92
+		} else {
+			x = 1.055*math.Pow(x, 1/2.4) - 0.055
+		}
+		t[i] = uint8(math.Round(x * 255))
+	}
+	return t
+}()
+
+// ToSRGB converts src, whose pixels are described by p, to a new sRGB
+// image. Alpha is copied unchanged. It returns ErrUnsupported for profiles
+// that are not matrix/TRC RGB or gray TRC profiles.
+func (p *Profile) ToSRGB(src *stdimage.NRGBA) (*stdimage.NRGBA, error) {
+	if !p.Convertible() {
+		return nil, ErrUnsupported
+	}
+
+	// Linearize every possible 8-bit value up front; per-pixel work is
+	// then three table lookups and a matrix product.
+	var linear [3][256]float64
+	for c := range linear {
+		curve := p.curves[min(c, len(p.curves)-1)]
+		for v := range linear[c] {
+			linear[c][v] = curve(float64(v) / 255)
+		}
+	}
+	// Gray maps to equal sRGB channels, since both share the D50 white.
+	m := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	if p.matrix != nil {
+		m = multiply(xyzToSRGB, *p.matrix)
+	}
+
+	b := src.Rect
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		s := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y):]
+		d := dst.Pix[y*dst.Stride:]
+		for x := 0; x < b.Dx(); x++ {
+			i := x * 4
+			r, g, bl := linear[0][s[i]], linear[1][s[i+1]], linear[2][s[i+2]]
+			for c := 0; c < 3; c++ {
+				v := m[c][0]*r + m[c][1]*g + m[c][2]*bl
+				d[i+c] = encode(v)
+			}
+			d[i+3] = s[i+3]
+		}
+	}
+	return dst, nil
+}
+
+// encode maps linear light to an sRGB value, clamping to [0, 1]. NaN,
+// which a degenerate curve or matrix can produce, maps to black.
+func encode(v float64) uint8 {
+	if !(v > 0) {
+		return 0
+	}
+	return srgbEncode[int(math.Round(math.Min(1, v)*encodeSteps))]
+}
+
+func multiply(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+func invert(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// Cofactor of m[j][i], using cyclic indices for the sign.
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv
+}
@@ -0,0 +1,18 @@
+package image
+
+// ToSRGB returns img with its pixels converted from its ICC profile to
+// sRGB and the profile dropped, so that filters see the colors they
+// expect. Images without a profile are returned as is. It fails with
+// icc.ErrUnsupported for profiles that cannot be converted.
+func ToSRGB(img Image) (Image, error) {
+	meta := img.Metadata()
+	if meta.ICC == nil {
+		return img, nil
+	}
+	pix, err := meta.ICC.ToSRGB(img.Pixels())
+	if err != nil {
+		return nil, err
+	}
+	meta.ICC = nil
+	return NewBasicImage(img.ID(), pix, meta), nil
+}
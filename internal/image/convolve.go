@@ -0,0 +1,437 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	FilterSharpen  = "sharpen"
+	FilterEdges    = "edges"
+	FilterEmboss   = "emboss"
+	FilterConvolve = "convolve"
+)
+
+// parallelMinRows is the image height below which convolution runs on the
+// calling goroutine; splitting smaller images costs more than it saves.
+const parallelMinRows = 64
+
+// EdgeMode selects how a convolution reads pixels beyond the image border.
+type EdgeMode int
+
+const (
+	EdgeClamp  EdgeMode = iota // repeat the border pixel
+	EdgeWrap                   // continue from the opposite side, as a tile
+	EdgeMirror                 // reflect about the border pixel
+)
+
+func (m EdgeMode) String() string {
+	switch m {
+	case EdgeWrap:
+		return "wrap"
+	case EdgeMirror:
+		return "mirror"
+	default:
+		return "clamp"
+	}
+}
+
+// ParseEdgeMode parses an edge mode name as accepted by the convolution filters.
+func ParseEdgeMode(s string) (EdgeMode, error) {
+	switch strings.ToLower(s) {
+	case "", "clamp":
+		return EdgeClamp, nil
+	case "wrap":
+		return EdgeWrap, nil
+	case "mirror":
+		return EdgeMirror, nil
+	}
+	return 0, fmt.Errorf("unknown edge mode %q", s)
+}
+
+// index maps a possibly out-of-range coordinate onto [0, n).
+func (m EdgeMode) index(i, n int) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch m {
+	case EdgeWrap:
+		return (i%n + n) % n
+	case EdgeMirror:
+		if n == 1 {
+			return 0
+		}
+		period := 2 * (n - 1)
+		i = (i%period + period) % period
+		if i >= n {
+			i = period - i
+		}
+		return i
+	default:
+		return clampInt(i, 0, n-1)
+	}
+}
+
+// Kernel is a convolution kernel with odd width and height, centered on
+// the output pixel.
+type Kernel struct {
+	Width, Height int
+	Weights       []float64 // row-major, Width*Height entries
+	Bias          float64   // added to each color channel afterwards, in 0-255 units
+}
+
+// NewKernel creates a kernel from rows of weights, which must all have the
+// same odd length and come in an odd number.
+func NewKernel(rows ...[]float64) (Kernel, error) {
+	if len(rows)%2 == 0 {
+		return Kernel{}, fmt.Errorf("kernel needs an odd number of rows, got %d", len(rows))
+	}
+	k := Kernel{Width: len(rows[0]), Height: len(rows)}
+	if k.Width%2 == 0 {
+		return Kernel{}, fmt.Errorf("kernel needs an odd number of columns, got %d", k.Width)
+	}
+	for _, row := range rows {
+		if len(row) != k.Width {
+			return Kernel{}, fmt.Errorf("kernel rows differ in length: %d and %d", k.Width, len(row))
+		}
+		k.Weights = append(k.Weights, row...)
+	}
+	return k, nil
+}
+
+// ParseKernel parses a kernel written as rows separated by semicolons, with
+// weights separated by spaces or commas, e.g. "0 -1 0; -1 5 -1; 0 -1 0".
+func ParseKernel(s string) (Kernel, error) {
+	var rows [][]float64
+	for _, line := range strings.Split(s, ";") {
+		var row []float64
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+			w, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return Kernel{}, fmt.Errorf("%q is not a number", field)
+			}
+			row = append(row, w)
+		}
+		rows = append(rows, row)
+	}
+	return NewKernel(rows...)
+}
+
+// Normalized returns k scaled so that its weights sum to 1, which keeps
+// overall brightness. Kernels summing to zero are returned unchanged.
+func (k Kernel) Normalized() Kernel {
+	var sum float64
+	for _, w := range k.Weights {
+		sum += w
+	}
+	if sum == 0 || sum == 1 {
+		return k
+	}
+	n := k
+	n.Weights = make([]float64, len(k.Weights))
+	for i, w := range k.Weights {
+		n.Weights[i] = w / sum
+	}
+	return n
+}
+
+// smoothing reports whether every weight is non-negative.
+func (k Kernel) smoothing() bool {
+	for _, w := range k.Weights {
+		if w < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SeparableKernel is a kernel that is the outer product of a horizontal and
+// a vertical pass, such as a Gaussian. Both must have odd length.
+type SeparableKernel struct {
+	X, Y []float64
+}
+
+// Convolve applies k to src. Colors are convolved premultiplied by alpha,
+// so transparent pixels do not bleed color. Alpha is convolved too when
+// every weight is non-negative, as for blurs; otherwise it is kept from
+// src, since sharpening or edge kernels would cancel it out.
+func Convolve(src *stdimage.NRGBA, k Kernel, edge EdgeMode) *stdimage.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	buf := premultiplied(src)
+	out := convolve2D(buf, w, h, 4, k, edge)
+	if !k.smoothing() {
+		copyAlpha(out, buf)
+	}
+	return unpremultiplied(out, w, h, k.Bias)
+}
+
+// ConvolveSeparable applies a separable kernel in two one-dimensional
+// passes, which is far cheaper than the equivalent full kernel. Alpha is
+// handled as in Convolve.
+func ConvolveSeparable(src *stdimage.NRGBA, k SeparableKernel, edge EdgeMode) *stdimage.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	buf := premultiplied(src)
+	out := convolve2D(buf, w, h, 4, Kernel{Width: len(k.X), Height: 1, Weights: k.X}, edge)
+	out = convolve2D(out, w, h, 4, Kernel{Width: 1, Height: len(k.Y), Weights: k.Y}, edge)
+	smoothing := Kernel{Weights: k.X}.smoothing() && Kernel{Weights: k.Y}.smoothing()
+	if !smoothing {
+		copyAlpha(out, buf)
+	}
+	return unpremultiplied(out, w, h, 0)
+}
+
+// premultiplied returns the pixels of src as float RGBA with colors scaled
+// by alpha / 255.
+func premultiplied(src *stdimage.NRGBA) []float64 {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	buf := make([]float64, w*h*4)
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for i := 0; i < len(row); i += 4 {
+			a := float64(row[i+3])
+			p := buf[y*w*4+i:]
+			p[0] = float64(row[i]) * a / 255
+			p[1] = float64(row[i+1]) * a / 255
+			p[2] = float64(row[i+2]) * a / 255
+			p[3] = a
+		}
+	}
+	return buf
+}
+
+// unpremultiplied converts a premultiplied float buffer back to NRGBA,
+// adding bias to the colors.
+func unpremultiplied(buf []float64, w, h int, bias float64) *stdimage.NRGBA {
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		d := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+		for i := 0; i < len(d); i += 4 {
+			p := buf[y*w*4+i:]
+			if a := p[3]; a > 0 {
+				d[i] = clamp8(p[0]*255/a + bias)
+				d[i+1] = clamp8(p[1]*255/a + bias)
+				d[i+2] = clamp8(p[2]*255/a + bias)
+			}
+			d[i+3] = clamp8(p[3])
+		}
+	}
+	return dst
+}
+
+func copyAlpha(dst, src []float64) {
+	for i := 3; i < len(dst); i += 4 {
+		dst[i] = src[i]
+	}
+}
+
+// convolve2D convolves a w x h buffer of ch interleaved channels with k,
+// splitting the rows across goroutines.
+func convolve2D(buf []float64, w, h, ch int, k Kernel, edge EdgeMode) []float64 {
+	out := make([]float64, len(buf))
+	cx, cy := k.Width/2, k.Height/2
+	parallelRows(h, func(y0, y1 int) {
+		acc := make([]float64, ch)
+		for y := y0; y < y1; y++ {
+			for x := 0; x < w; x++ {
+				clear(acc)
+				for ky := 0; ky < k.Height; ky++ {
+					sy := edge.index(y+ky-cy, h)
+					for kx := 0; kx < k.Width; kx++ {
+						weight := k.Weights[ky*k.Width+kx]
+						if weight == 0 {
+							continue
+						}
+						sx := edge.index(x+kx-cx, w)
+						p := buf[(sy*w+sx)*ch:]
+						for c := range acc {
+							acc[c] += p[c] * weight
+						}
+					}
+				}
+				copy(out[(y*w+x)*ch:], acc)
+			}
+		}
+	})
+	return out
+}
+
+// parallelRows calls fn over consecutive row ranges covering [0, h), one
+// range per CPU, and waits for all of them.
+func parallelRows(h int, fn func(y0, y1 int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if h < parallelMinRows || workers == 1 {
+		fn(0, h)
+		return
+	}
+	step := (h + workers - 1) / workers
+	var wg sync.WaitGroup
+	for y := 0; y < h; y += step {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			fn(y0, y1)
+		}(y, min(y+step, h))
+	}
+	wg.Wait()
+}
+
+// UnsharpMaskFilter sharpens by adding back the difference between the
+// image and a blurred copy of it.
+type UnsharpMaskFilter struct {
+	amount    float64
+	sigma     float64
+	threshold float64
+}
+
+// NewUnsharpMaskFilter creates a sharpen filter. Amount scales the added
+// detail, sigma sets the size of the detail enhanced, and differences
+// smaller than threshold (0-255) are left alone to avoid amplifying noise.
+func NewUnsharpMaskFilter(amount, sigma, threshold float64) *UnsharpMaskFilter {
+	return &UnsharpMaskFilter{amount: amount, sigma: sigma, threshold: threshold}
+}
+
+func (f *UnsharpMaskFilter) Name() string {
+	return FilterSharpen
+}
+
+func (f *UnsharpMaskFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	if f.sigma <= 0 || f.amount == 0 {
+		return clonePixels(src)
+	}
+	kernel := gaussianKernel(f.sigma)
+	blurred := ConvolveSeparable(src, SeparableKernel{X: kernel, Y: kernel}, EdgeClamp)
+	dst := clonePixels(src)
+	for i := range dst.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		diff := float64(dst.Pix[i]) - float64(blurred.Pix[i])
+		if math.Abs(diff) < f.threshold {
+			continue
+		}
+		dst.Pix[i] = clamp8(float64(dst.Pix[i]) + f.amount*diff)
+	}
+	return dst
+}
+
+// EdgeOperator selects the edge detection kernel.
+type EdgeOperator int
+
+const (
+	EdgeSobel     EdgeOperator = iota // gradient magnitude; thick, directional edges
+	EdgeLaplacian                     // second derivative; thin edges, more noise
+)
+
+func (o EdgeOperator) String() string {
+	if o == EdgeLaplacian {
+		return "laplacian"
+	}
+	return "sobel"
+}
+
+// ParseEdgeOperator parses an edge detector name.
+func ParseEdgeOperator(s string) (EdgeOperator, error) {
+	switch strings.ToLower(s) {
+	case "", "sobel":
+		return EdgeSobel, nil
+	case "laplacian", "laplace":
+		return EdgeLaplacian, nil
+	}
+	return 0, fmt.Errorf("unknown edge operator %q", s)
+}
+
+var (
+	sobelX    = Kernel{Width: 3, Height: 3, Weights: []float64{-1, 0, 1, -2, 0, 2, -1, 0, 1}}
+	sobelY    = Kernel{Width: 3, Height: 3, Weights: []float64{-1, -2, -1, 0, 0, 0, 1, 2, 1}}
+	laplacian = Kernel{Width: 3, Height: 3, Weights: []float64{0, 1, 0, 1, -4, 1, 0, 1, 0}}
+	emboss    = Kernel{Width: 3, Height: 3, Weights: []float64{-2, -1, 0, -1, 1, 1, 0, 1, 2}}
+)
+
+// EdgeDetectFilter renders the strength of the edges in an image as
+// grayscale: white on strong edges, black on flat areas.
+type EdgeDetectFilter struct {
+	operator EdgeOperator
+	edge     EdgeMode
+}
+
+// NewEdgeDetectFilter creates a new edge detection filter.
+func NewEdgeDetectFilter(operator EdgeOperator, edge EdgeMode) *EdgeDetectFilter {
+	return &EdgeDetectFilter{operator: operator, edge: edge}
+}
+
+func (f *EdgeDetectFilter) Name() string {
+	return FilterEdges
+}
+
+func (f *EdgeDetectFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	// Edges are found in the luma of each pixel composited over black, so
+	// transparent areas read as flat.
+	lum := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < w; x++ {
+			p := row[x*4:]
+			lum[y*w+x] = luma(float64(p[0]), float64(p[1]), float64(p[2])) * float64(p[3]) / 255
+		}
+	}
+
+	var mag []float64
+	if f.operator == EdgeLaplacian {
+		mag = convolve2D(lum, w, h, 1, laplacian, f.edge)
+		for i, v := range mag {
+			mag[i] = math.Abs(v)
+		}
+	} else {
+		gx := convolve2D(lum, w, h, 1, sobelX, f.edge)
+		gy := convolve2D(lum, w, h, 1, sobelY, f.edge)
+		mag = gx
+		for i := range mag {
+			// Scale so that a step from black to white maps to white.
+			mag[i] = math.Hypot(gx[i], gy[i]) / 4
+		}
+	}
+
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := clamp8(mag[y*w+x])
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2] = v, v, v
+			d[3] = src.Pix[y*src.Stride+x*4+3]
+		}
+	}
+	return dst
+}
+
+// KernelFilter convolves an image with a fixed kernel. The emboss and
+// custom convolution filters are kernel filters.
+type KernelFilter struct {
+	name   string
+	kernel Kernel
+	edge   EdgeMode
+}
+
+// NewKernelFilter creates a filter that convolves with kernel.
+func NewKernelFilter(kernel Kernel, edge EdgeMode) *KernelFilter {
+	return &KernelFilter{name: FilterConvolve, kernel: kernel, edge: edge}
+}
+
+// NewEmbossFilter creates a filter that renders the image as if raised
+// from the surface, lit from the top left.
+func NewEmbossFilter(edge EdgeMode) *KernelFilter {
+	return &KernelFilter{name: FilterEmboss, kernel: emboss, edge: edge}
+}
+
+func (f *KernelFilter) Name() string {
+	return f.name
+}
+
+func (f *KernelFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	return Convolve(src, f.kernel, f.edge)
+}
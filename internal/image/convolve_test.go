@@ -0,0 +1,129 @@
+package image
+
+import (
+	stdimage "image"
+	"runtime"
+	"testing"
+)
+
+func TestEdgeModeIndex(t *testing.T) {
+	tests := []struct {
+		mode EdgeMode
+		n    int
+		in   []int
+		want []int
+	}{
+		{EdgeClamp, 4, []int{-3, -1, 0, 3, 4, 9}, []int{0, 0, 0, 3, 3, 3}},
+		{EdgeWrap, 4, []int{-5, -1, 0, 3, 4, 9}, []int{3, 3, 0, 3, 0, 1}},
+		// Mirror reflects about the border pixel without repeating it:
+		// ... 2 1 | 0 1 2 3 | 2 1 0 1 ...
+		{EdgeMirror, 4, []int{-7, -3, -1, 0, 3, 4, 6, 7, 9}, []int{1, 3, 1, 0, 3, 2, 0, 1, 3}},
+		{EdgeClamp, 1, []int{-2, 0, 5}, []int{0, 0, 0}},
+		{EdgeWrap, 1, []int{-2, 0, 5}, []int{0, 0, 0}},
+		{EdgeMirror, 1, []int{-2, 0, 5}, []int{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		for i, in := range tt.in {
+			if got := tt.mode.index(in, tt.n); got != tt.want[i] {
+				t.Errorf("%s.index(%d, %d) = %d, want %d", tt.mode, in, tt.n, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestParseKernel(t *testing.T) {
+	k, err := ParseKernel("0 -1 0; -1,5,-1; 0 -1 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Width != 3 || k.Height != 3 || k.Weights[4] != 5 || k.Weights[3] != -1 {
+		t.Errorf("parsed %+v", k)
+	}
+	if k, err := ParseKernel("1 2 1"); err != nil || k.Width != 3 || k.Height != 1 {
+		t.Errorf("single row: %+v, %v", k, err)
+	}
+
+	for _, s := range []string{
+		"",
+		"1 1",                   // even width
+		"1 1 1; 1 1 1",          // even height
+		"1 2 3; 4 5; 6 7 8",     // ragged
+		"1 2 3; 4 5 6 7; 8 9 1", // ragged, longer row
+		"1 x 1",
+	} {
+		if _, err := ParseKernel(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestConvolveIdentity(t *testing.T) {
+	src := fixture()
+	k, err := NewKernel([]float64{0, 0, 0}, []float64{0, 1, 0}, []float64{0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edge := range []EdgeMode{EdgeClamp, EdgeWrap, EdgeMirror} {
+		got := Convolve(src, k, edge)
+		for y := 0; y < src.Rect.Dy(); y++ {
+			for x := 0; x < src.Rect.Dx(); x++ {
+				want := src.NRGBAAt(x, y)
+				if want.A == 0 {
+					// Fully transparent pixels have no color to keep.
+					want.R, want.G, want.B = 0, 0, 0
+				}
+				if c := got.NRGBAAt(x, y); c != want {
+					t.Fatalf("%s: pixel (%d, %d) %v, want %v", edge, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+func TestConvolveParallelMatchesSerial(t *testing.T) {
+	k, err := ParseKernel("1 2 -1 0 1; 0 -3 4 1 2; 1 1 1 1 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, h := range []int{parallelMinRows - 1, parallelMinRows, 150} {
+		src := Resize(fixture(), 40, h, ResampleBilinear)
+		for _, edge := range []EdgeMode{EdgeClamp, EdgeWrap, EdgeMirror} {
+			runtime.GOMAXPROCS(1)
+			serial := Convolve(src, k, edge)
+			runtime.GOMAXPROCS(4)
+			parallel := Convolve(src, k, edge)
+			if diff := changed(serial, parallel); !diff.Empty() {
+				t.Errorf("height %d, %s: parallel output differs in %v", h, edge, diff)
+			}
+		}
+	}
+
+	// Rows convolved in separate ranges match those of a single pass.
+	buf := premultiplied(Resize(fixture(), 40, 150, ResampleBilinear))
+	runtime.GOMAXPROCS(1)
+	whole := convolve2D(buf, 40, 150, 4, k, EdgeMirror)
+	runtime.GOMAXPROCS(7)
+	split := convolve2D(buf, 40, 150, 4, k, EdgeMirror)
+	for i := range whole {
+		if whole[i] != split[i] {
+			t.Fatalf("sample %d: %v, want %v", i, split[i], whole[i])
+		}
+	}
+}
+
+func TestConvolveSeparableMatchesFull(t *testing.T) {
+	src := fixture()
+	x, y := []float64{1, 2, 1}, []float64{1, 0, -1}
+	full, err := NewKernel([]float64{1, 2, 1}, []float64{0, 0, 0}, []float64{-1, -2, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := ConvolveSeparable(src, SeparableKernel{X: x, Y: y}, EdgeClamp)
+	b := Convolve(src, full, EdgeClamp)
+	for i := range a.Pix {
+		if d := int(a.Pix[i]) - int(b.Pix[i]); d < -1 || d > 1 {
+			t.Fatalf("byte %d at %v: separable %d, full %d", i, stdimage.Pt(i/4%src.Rect.Dx(), i/4/src.Rect.Dx()), a.Pix[i], b.Pix[i])
+		}
+	}
+}
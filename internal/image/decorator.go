@@ -1,19 +1,30 @@
 // Package image implements the Decorator pattern.
 package image
 
-// FilterDecorator wraps an Image and adds filter metadata.
+import (
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"sync"
+)
+
+// FilterDecorator wraps an Image and applies a Filter to its pixels.
+// Rendering is lazy: the filter runs the first time pixels are read and the
+// result is cached, so a stack of decorators renders each step exactly once.
 type FilterDecorator struct {
-	wrapped Image
-	filter  string
+	wrapped  Image
+	filter   Filter
+	mu       sync.Mutex
+	rendered *stdimage.NRGBA
 }
 
 // NewFilterDecorator creates a new filter decorator.
-func NewFilterDecorator(img Image, filter string) *FilterDecorator {
+func NewFilterDecorator(img Image, filter Filter) *FilterDecorator {
 	if img == nil {
 		panic("image cannot be nil")
 	}
-	if filter == "" {
-		panic("filter cannot be empty")
+	if filter == nil {
+		panic("filter cannot be nil")
 	}
 	return &FilterDecorator{wrapped: img, filter: filter}
 }
@@ -23,19 +34,75 @@ func (d *FilterDecorator) ID() string {
 }
 
 func (d *FilterDecorator) Data() []byte {
-	return d.wrapped.Data()
+	return d.Pixels().Pix
 }
 
+func (d *FilterDecorator) Pixels() *stdimage.NRGBA {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rendered == nil {
+		d.rendered = d.filter.Apply(d.wrapped.Pixels())
+	}
+	return d.rendered
+}
+
+func (d *FilterDecorator) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+// Bounds returns the bounds of the filtered pixels without rendering them.
+func (d *FilterDecorator) Bounds() stdimage.Rectangle {
+	b := d.wrapped.Bounds()
+	w, h := d.size(b.Dx(), b.Dy())
+	return stdimage.Rect(0, 0, w, h)
+}
+
+func (d *FilterDecorator) At(x, y int) color.Color {
+	return d.Pixels().At(x, y)
+}
+
+// Metadata returns the wrapped image's metadata with this filter appended to
+// Filters and the dimensions after filtering, since transforms such as
+// resize and crop change them. It does not render the image.
 func (d *FilterDecorator) Metadata() ImageMetadata {
 	meta := d.wrapped.Metadata()
-	meta.Filters = append(meta.Filters, d.filter)
+	meta.Width, meta.Height = d.size(meta.Width, meta.Height)
+	filters := make([]string, 0, len(meta.Filters)+1)
+	meta.Filters = append(append(filters, meta.Filters...), filterLabel(d.filter))
 	return meta
 }
 
-func (d *FilterDecorator) SetData(data []byte) {
-	d.wrapped.SetData(data)
+// size returns the filtered size of a width x height input: the rendered
+// size once pixels have been read, otherwise as the filter reports it.
+func (d *FilterDecorator) size(width, height int) (int, int) {
+	d.mu.Lock()
+	rendered := d.rendered
+	d.mu.Unlock()
+	if rendered != nil {
+		return rendered.Rect.Dx(), rendered.Rect.Dy()
+	}
+	if s, ok := d.filter.(OutputSizer); ok {
+		return s.OutputSize(width, height)
+	}
+	return width, height
+}
+
+// SetPixels replaces the pixels of the wrapped image and discards the cached render.
+func (d *FilterDecorator) SetPixels(pix *stdimage.NRGBA) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.wrapped.SetPixels(pix)
+	d.rendered = nil
 }
 
 func (d *FilterDecorator) SetMetadata(meta ImageMetadata) {
 	d.wrapped.SetMetadata(meta)
 }
+
+// filterLabel names a filter for metadata, preferring its configured form.
+func filterLabel(f Filter) string {
+	if s, ok := f.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return f.Name()
+}
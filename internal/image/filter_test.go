@@ -0,0 +1,162 @@
+package image
+
+import (
+	"bytes"
+	"flag"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// fixture returns a small raster with gradients in every channel, a hard
+// edge and a partly transparent corner, so that filters have something to
+// work on everywhere.
+func fixture() *stdimage.NRGBA {
+	const w, h = 24, 16
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := pix.PixOffset(x, y)
+			pix.Pix[i] = uint8(x * 255 / (w - 1))
+			pix.Pix[i+1] = uint8(y * 255 / (h - 1))
+			pix.Pix[i+2] = uint8((x + y) * 255 / (w + h - 2))
+			pix.Pix[i+3] = 0xFF
+			if x >= w/2 && y < h/2 {
+				pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2] = 0xF0, 0xF0, 0x20
+			}
+			if x < 4 && y >= h-4 {
+				pix.Pix[i+3] = uint8(64 * x)
+			}
+		}
+	}
+	return pix
+}
+
+// solid returns a w x h image filled with c.
+func solid(w, h int, c color.NRGBA) *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for i := 0; i < len(pix.Pix); i += 4 {
+		pix.Pix[i], pix.Pix[i+1], pix.Pix[i+2], pix.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return pix
+}
+
+// changed returns the bounding box of the pixels that differ between a and
+// b, which must be the same size.
+func changed(a, b *stdimage.NRGBA) stdimage.Rectangle {
+	var r stdimage.Rectangle
+	for y := 0; y < a.Rect.Dy(); y++ {
+		for x := 0; x < a.Rect.Dx(); x++ {
+			if a.NRGBAAt(x, y) != b.NRGBAAt(x, y) {
+				r = r.Union(stdimage.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// checkGolden compares got bit for bit with testdata/name, or rewrites the
+// golden file when the test runs with -update.
+func checkGolden(t *testing.T, name string, got *stdimage.NRGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, got); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open golden (run with -update to create it): %v", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode golden %s: %v", path, err)
+	}
+	want := ToNRGBA(decoded)
+	if got.Rect != want.Rect {
+		t.Fatalf("%s: bounds %v, want %v", name, got.Rect, want.Rect)
+	}
+	for y := 0; y < want.Rect.Dy(); y++ {
+		for x := 0; x < want.Rect.Dx(); x++ {
+			g, w := got.NRGBAAt(x, y), want.NRGBAAt(x, y)
+			if g != w {
+				t.Fatalf("%s: pixel (%d, %d) is %v, want %v", name, x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestFilterGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		filter Filter
+	}{
+		{"grayscale.png", NewGrayscaleFilter()},
+		{"sepia.png", NewSepiaFilter(defaultSepiaStrength)},
+		{"sepia-half.png", NewSepiaFilter(0.5)},
+		{"blur.png", NewGaussianBlurFilter(1.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			src := fixture()
+			orig := clonePixels(src)
+			got := tt.filter.Apply(src)
+			if !bytes.Equal(src.Pix, orig.Pix) {
+				t.Fatal("Apply modified its source")
+			}
+			checkGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestFilterIdentities(t *testing.T) {
+	src := fixture()
+	for _, f := range []Filter{NewSepiaFilter(0), NewGaussianBlurFilter(0)} {
+		if got := f.Apply(src); !bytes.Equal(got.Pix, src.Pix) {
+			t.Errorf("%s: zero strength changed pixels", f.Name())
+		}
+	}
+
+	gray := NewGrayscaleFilter().Apply(src)
+	for i := 0; i < len(gray.Pix); i += 4 {
+		if p := gray.Pix[i : i+4]; p[0] != p[1] || p[1] != p[2] || p[3] != src.Pix[i+3] {
+			t.Fatalf("grayscale pixel %d is %v", i/4, p)
+		}
+	}
+}
+
+func TestFilterDecoratorRendersOnce(t *testing.T) {
+	counter := &countingFilter{Filter: NewGrayscaleFilter()}
+	var img Image = NewBasicImage("fixture", fixture(), ImageMetadata{})
+	img = NewFilterDecorator(img, counter)
+	img = NewFilterDecorator(img, NewSepiaFilter(1))
+	img.Pixels()
+	img.Data()
+	img.At(0, 0)
+	if counter.calls != 1 {
+		t.Errorf("inner filter ran %d times, want 1", counter.calls)
+	}
+	checkGolden(t, "grayscale-sepia.png", img.Pixels())
+}
+
+type countingFilter struct {
+	Filter
+	calls int
+}
+
+func (f *countingFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	f.calls++
+	return f.Filter.Apply(src)
+}
@@ -0,0 +1,256 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// The bundled font is a 5x7 pixel face covering printable ASCII and the
+// copyright sign. Each glyph row holds its pixels in the low five bits,
+// leftmost pixel first; characters without a glyph render as '?'.
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphAdvance = glyphWidth + 1
+	glyphLeading = glyphHeight + 2
+
+	// shadowOpacity is how dark a text drop shadow is.
+	shadowOpacity = 0.6
+)
+
+var font5x7 = map[rune][glyphHeight]uint8{
+	' ':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	'!':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x00, 0x04},
+	'"':  {0x0a, 0x0a, 0x0a, 0x00, 0x00, 0x00, 0x00},
+	'#':  {0x0a, 0x0a, 0x1f, 0x0a, 0x1f, 0x0a, 0x0a},
+	'$':  {0x04, 0x0f, 0x14, 0x0e, 0x05, 0x1e, 0x04},
+	'%':  {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'&':  {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d},
+	'\'': {0x04, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'*':  {0x00, 0x04, 0x15, 0x0e, 0x15, 0x04, 0x00},
+	'+':  {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	';':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x04, 0x08},
+	'<':  {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02},
+	'=':  {0x00, 0x00, 0x1f, 0x00, 0x1f, 0x00, 0x00},
+	'>':  {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+	'@':  {0x0e, 0x11, 0x01, 0x0d, 0x15, 0x15, 0x0e},
+	'A':  {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'[':  {0x0e, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0e},
+	'\\': {0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00},
+	']':  {0x0e, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0e},
+	'^':  {0x04, 0x0a, 0x11, 0x00, 0x00, 0x00, 0x00},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+	'`':  {0x08, 0x04, 0x02, 0x00, 0x00, 0x00, 0x00},
+	'a':  {0x00, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f},
+	'b':  {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x1e},
+	'c':  {0x00, 0x00, 0x0e, 0x10, 0x10, 0x11, 0x0e},
+	'd':  {0x01, 0x01, 0x0d, 0x13, 0x11, 0x11, 0x0f},
+	'e':  {0x00, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e},
+	'f':  {0x06, 0x09, 0x08, 0x1c, 0x08, 0x08, 0x08},
+	'g':  {0x00, 0x0f, 0x11, 0x11, 0x0f, 0x01, 0x0e},
+	'h':  {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'i':  {0x04, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e},
+	'j':  {0x02, 0x00, 0x06, 0x02, 0x02, 0x12, 0x0c},
+	'k':  {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12},
+	'l':  {0x0c, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'm':  {0x00, 0x00, 0x1a, 0x15, 0x15, 0x11, 0x11},
+	'n':  {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x11},
+	'o':  {0x00, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e},
+	'p':  {0x00, 0x00, 0x1e, 0x11, 0x1e, 0x10, 0x10},
+	'q':  {0x00, 0x00, 0x0d, 0x13, 0x0f, 0x01, 0x01},
+	'r':  {0x00, 0x00, 0x16, 0x19, 0x10, 0x10, 0x10},
+	's':  {0x00, 0x00, 0x0e, 0x10, 0x0e, 0x01, 0x1e},
+	't':  {0x08, 0x08, 0x1c, 0x08, 0x08, 0x09, 0x06},
+	'u':  {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d},
+	'v':  {0x00, 0x00, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'w':  {0x00, 0x00, 0x11, 0x11, 0x15, 0x15, 0x0a},
+	'x':  {0x00, 0x00, 0x11, 0x0a, 0x04, 0x0a, 0x11},
+	'y':  {0x00, 0x00, 0x11, 0x11, 0x0f, 0x01, 0x0e},
+	'z':  {0x00, 0x00, 0x1f, 0x02, 0x04, 0x08, 0x1f},
+	'{':  {0x02, 0x04, 0x04, 0x08, 0x04, 0x04, 0x02},
+	'|':  {0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'}':  {0x08, 0x04, 0x04, 0x02, 0x04, 0x04, 0x08},
+	'~':  {0x00, 0x00, 0x08, 0x15, 0x02, 0x00, 0x00},
+	'©':  {0x0e, 0x11, 0x1d, 0x19, 0x1d, 0x11, 0x0e},
+}
+
+// TextStyle controls how RenderText draws a caption.
+type TextStyle struct {
+	Color      color.NRGBA
+	Background color.NRGBA // box behind the text; a zero alpha draws none
+	Shadow     bool        // drop shadow that keeps text readable on busy photos
+}
+
+// MeasureText returns the size of text as RenderText draws it with
+// capitals height pixels tall, before any shadow or background box.
+func MeasureText(text string, height int) stdimage.Point {
+	lines, cols := textGrid(text)
+	return gridSize(len(lines), cols, fitHeight(len(lines), cols, height))
+}
+
+// textGrid splits text into lines and returns them with the length of the
+// longest in runes.
+func textGrid(text string) ([]string, int) {
+	lines := strings.Split(text, "\n")
+	cols := 0
+	for _, line := range lines {
+		cols = max(cols, len([]rune(line)))
+	}
+	return lines, cols
+}
+
+// fitHeight returns height, or the largest smaller one at which rows lines
+// of cols glyphs fit in maxPixels.
+func fitHeight(rows, cols, height int) int {
+	size := gridSize(rows, cols, height)
+	if area := float64(size.X) * float64(size.Y); area > maxPixels {
+		return max(1, int(float64(height)*math.Sqrt(maxPixels/area)))
+	}
+	return height
+}
+
+// gridSize returns the size of rows lines of cols glyphs with capitals
+// height pixels tall, or zero if that is empty.
+func gridSize(rows, cols, height int) stdimage.Point {
+	if cols == 0 || height < 1 {
+		return stdimage.Point{}
+	}
+	w := float64((cols*glyphAdvance - 1) * height)
+	h := (rows*glyphLeading - (glyphLeading - glyphHeight)) * height
+	return stdimage.Pt(max(1, int(math.Round(w/glyphHeight))), max(1, h/glyphHeight))
+}
+
+// RenderText draws text with the bundled bitmap font onto a transparent
+// raster just large enough to hold it, with capitals height pixels tall.
+// Lines are separated by "\n". Text that would need a raster of more than
+// maxPixels is drawn at the largest height that fits.
+func RenderText(text string, height int, style TextStyle) *stdimage.NRGBA {
+	lines, cols := textGrid(text)
+	height = fitHeight(len(lines), cols, height)
+	size := gridSize(len(lines), cols, height)
+	if size == (stdimage.Point{}) {
+		return stdimage.NewNRGBA(stdimage.Rectangle{})
+	}
+
+	// Draw each font pixel straight at the target size as a square
+	// height/7 pixels wide. Pixels its edges cross get partial coverage,
+	// so text of any height stays smooth without drawing it larger first.
+	mask := stdimage.NewNRGBA(stdimage.Rectangle{Max: size})
+	step := float64(height) / glyphHeight
+	for row, line := range lines {
+		for col, r := range []rune(line) {
+			glyph, ok := font5x7[r]
+			if !ok {
+				glyph = font5x7['?']
+			}
+			for gy, bits := range glyph {
+				for gx := 0; gx < glyphWidth; gx++ {
+					if bits&(1<<(glyphWidth-1-gx)) != 0 {
+						x0 := float64(col*glyphAdvance+gx) * step
+						y0 := float64(row*glyphLeading+gy) * step
+						coverBox(mask, x0, y0, x0+step, y0+step)
+					}
+				}
+			}
+		}
+	}
+	for i := 0; i < len(mask.Pix); i += 4 {
+		if a := mask.Pix[i+3]; a > 0 {
+			mask.Pix[i], mask.Pix[i+1], mask.Pix[i+2] = style.Color.R, style.Color.G, style.Color.B
+			mask.Pix[i+3] = uint8((int(a)*int(style.Color.A) + 127) / 255)
+		}
+	}
+	if !style.Shadow && style.Background.A == 0 {
+		return mask
+	}
+
+	// Shadow offset and background padding grow with the text.
+	offset := 0
+	if style.Shadow {
+		offset = max(1, height/10)
+	}
+	pad := 0
+	if style.Background.A > 0 {
+		pad = max(2, height/3)
+	}
+	w, h := mask.Rect.Dx(), mask.Rect.Dy()
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, w+offset+2*pad, h+offset+2*pad))
+	fillRect(dst, dst.Rect, style.Background)
+	if style.Shadow {
+		shadow := mapPixels(mask, func(_, _, _ float64) (float64, float64, float64) { return 0, 0, 0 })
+		DrawOver(dst, shadow, stdimage.Pt(pad+offset, pad+offset), shadowOpacity)
+	}
+	DrawOver(dst, mask, stdimage.Pt(pad, pad), 1)
+	return dst
+}
+
+// coverBox adds to the alpha of dst's pixels the share of each that the
+// box from (x0, y0) to (x1, y1) covers, saturating at opaque.
+func coverBox(dst *stdimage.NRGBA, x0, y0, x1, y1 float64) {
+	r := stdimage.Rect(int(x0), int(y0), int(math.Ceil(x1)), int(math.Ceil(y1))).Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		cy := math.Min(y1, float64(y+1)) - math.Max(y0, float64(y))
+		row := dst.Pix[y*dst.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cx := math.Min(x1, float64(x+1)) - math.Max(x0, float64(x))
+			a := &row[x*4+3]
+			*a = uint8(min(255, int(*a)+int(math.Round(cx*cy*255))))
+		}
+	}
+}
+
+func fillRect(dst *stdimage.NRGBA, r stdimage.Rectangle, c color.NRGBA) {
+	r = r.Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := dst.Pix[y*dst.Stride:]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			p := row[x*4 : x*4+4]
+			p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+		}
+	}
+}
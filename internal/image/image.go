@@ -1,43 +1,102 @@
 package image
 
 import (
+	stdimage "image"
+	"image/color"
+	"image/draw"
 	"time"
+
+	"photoapp/internal/exif"
+	"photoapp/internal/icc"
+	"photoapp/internal/xmp"
 )
 
 // ImageMetadata holds metadata about an image
 type ImageMetadata struct {
 	ID          string
-	Width       int
-	Height      int
+	Width       int // derived from the pixel bounds
+	Height      int // derived from the pixel bounds
 	CapturedAt  time.Time
-	Rating      int // 1-5
+	Rating      int // 1-5; 0 unrated, -1 rejected
 	Filters     []string
 	Format      string // "JPEG", "PNG", etc.
 	Description string
+	Tags        []string        // keywords
+	Frames      int             // frame count for animations; 0 for stills
+	FrameDelays []time.Duration // display time of each animation frame
+	LoopCount   int             // animation repeats: 0 forever, -1 play once
+	Page        int             // zero-based page index within a multi-page document
+	Pages       int             // page count for multi-page documents; 0 for single images
+	EXIF        *exif.EXIF      // camera metadata; nil when the source had none
+	XMP         *xmp.Metadata   // XMP as read from the source; nil when it had none
+	ICC         *icc.Profile    // embedded color profile; nil means sRGB
+}
+
+// XMPMetadata returns the XMP to write for m: a copy of m.XMP, so that
+// properties set by other tools survive, updated with Rating, Description,
+// Tags and Filters. It returns nil when there is nothing to write.
+func (m ImageMetadata) XMPMetadata() *xmp.Metadata {
+	if m.XMP == nil && m.Rating == 0 && m.Description == "" && len(m.Tags) == 0 && len(m.Filters) == 0 {
+		return nil
+	}
+	var x xmp.Metadata
+	if m.XMP != nil {
+		x = *m.XMP
+	}
+	x.Rating = m.Rating
+	x.Description = m.Description
+	x.Subject = m.Tags
+	x.Filters = m.Filters
+	return &x
+}
+
+// ApplyXMP takes Rating, Description, Tags and Filters from x where it
+// sets them, and keeps x so that it is written back on encode.
+func (m *ImageMetadata) ApplyXMP(x *xmp.Metadata) {
+	m.XMP = x
+	if x.Rating != 0 {
+		m.Rating = x.Rating
+	}
+	if x.Description != "" {
+		m.Description = x.Description
+	}
+	if len(x.Subject) > 0 {
+		m.Tags = x.Subject
+	}
+	if len(x.Filters) > 0 {
+		m.Filters = x.Filters
+	}
 }
 
-// Image represents a photo with its data and metadata
+// Image represents a photo with its pixels and metadata.
+// It embeds the standard library image.Image, so any Image can be handed
+// directly to image/draw, image/png and friends.
 type Image interface {
+	stdimage.Image
 	ID() string
 	Data() []byte
+	Pixels() *stdimage.NRGBA
 	Metadata() ImageMetadata
-	SetData([]byte)
+	SetPixels(*stdimage.NRGBA)
 	SetMetadata(ImageMetadata)
 }
 
-// BasicImage is a concrete implementation of Image
+// BasicImage is a concrete implementation of Image backed by an NRGBA raster
 type BasicImage struct {
 	id       string
-	data     []byte
+	pix      *stdimage.NRGBA
 	metadata ImageMetadata
 }
 
 // NewBasicImage creates a new BasicImage
-func NewBasicImage(id string, data []byte, metadata ImageMetadata) *BasicImage {
+func NewBasicImage(id string, pix *stdimage.NRGBA, metadata ImageMetadata) *BasicImage {
+	if pix == nil {
+		pix = stdimage.NewNRGBA(stdimage.Rect(0, 0, 0, 0))
+	}
 	metadata.ID = id
 	return &BasicImage{
 		id:       id,
-		data:     data,
+		pix:      pix,
 		metadata: metadata,
 	}
 }
@@ -47,22 +106,60 @@ func (b *BasicImage) ID() string {
 	return b.id
 }
 
-// Data returns the image data
+// Data returns the raw pixel bytes in NRGBA order
 func (b *BasicImage) Data() []byte {
-	return b.data
+	return b.pix.Pix
 }
 
-// Metadata returns the image metadata
+// Pixels returns the underlying raster
+func (b *BasicImage) Pixels() *stdimage.NRGBA {
+	return b.pix
+}
+
+// ColorModel returns the color model of the raster
+func (b *BasicImage) ColorModel() color.Model {
+	return b.pix.ColorModel()
+}
+
+// Bounds returns the pixel bounds of the raster
+func (b *BasicImage) Bounds() stdimage.Rectangle {
+	return b.pix.Bounds()
+}
+
+// At returns the color of the pixel at (x, y)
+func (b *BasicImage) At(x, y int) color.Color {
+	return b.pix.At(x, y)
+}
+
+// Metadata returns the image metadata with dimensions taken from the raster
 func (b *BasicImage) Metadata() ImageMetadata {
-	return b.metadata
+	meta := b.metadata
+	meta.Width = b.pix.Bounds().Dx()
+	meta.Height = b.pix.Bounds().Dy()
+	return meta
 }
 
-// SetData updates the image data
-func (b *BasicImage) SetData(data []byte) {
-	b.data = data
+// SetPixels replaces the underlying raster
+func (b *BasicImage) SetPixels(pix *stdimage.NRGBA) {
+	if pix == nil {
+		pix = stdimage.NewNRGBA(stdimage.Rect(0, 0, 0, 0))
+	}
+	b.pix = pix
 }
 
 // SetMetadata updates the image metadata
 func (b *BasicImage) SetMetadata(metadata ImageMetadata) {
 	b.metadata = metadata
 }
+
+// ToNRGBA converts any standard library image to an NRGBA raster whose
+// bounds start at the origin. NRGBA inputs already at the origin are returned as is.
+func ToNRGBA(src stdimage.Image) *stdimage.NRGBA {
+	if n, ok := src.(*stdimage.NRGBA); ok && n.Rect.Min == (stdimage.Point{}) {
+		return n
+	}
+	b := src.Bounds()
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
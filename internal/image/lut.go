@@ -0,0 +1,312 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdimage "image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const FilterLUT = "lut"
+
+const (
+	maxLUT1DSize = 65536
+	maxLUT3DSize = 256
+
+	// lutHashLen is the number of hex digits of a LUT file's SHA-256 that
+	// are recorded in filter metadata.
+	lutHashLen = 16
+)
+
+// LUTInterpolation selects how a 3D LUT is sampled between grid points.
+type LUTInterpolation int
+
+const (
+	LUTTetrahedral LUTInterpolation = iota // smoother along the gray axis; the default
+	LUTTrilinear
+)
+
+func (i LUTInterpolation) String() string {
+	if i == LUTTrilinear {
+		return "trilinear"
+	}
+	return "tetrahedral"
+}
+
+// ParseLUTInterpolation parses an interpolation name as accepted by the lut filter.
+func ParseLUTInterpolation(s string) (LUTInterpolation, error) {
+	switch strings.ToLower(s) {
+	case "", "tetrahedral":
+		return LUTTetrahedral, nil
+	case "trilinear":
+		return LUTTrilinear, nil
+	}
+	return 0, fmt.Errorf("unknown LUT interpolation %q", s)
+}
+
+// CubeLUT is a color lookup table in the Adobe/Resolve .cube format. A file
+// holds a 1D LUT, a 3D LUT, or both, in which case the 1D LUT shapes the
+// input of the 3D one.
+type CubeLUT struct {
+	Title string
+	Hash  string // hex SHA-256 of the file contents
+
+	size1D   int
+	table1D  [][3]float64
+	domain1D [2][3]float64 // min and max input per channel
+
+	size3D   int
+	table3D  [][3]float64 // red varies fastest, then green, then blue
+	domain3D [2][3]float64
+}
+
+// LoadCube reads a .cube file.
+func LoadCube(path string) (*CubeLUT, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load LUT: %w", err)
+	}
+	lut, err := ParseCube(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("load LUT %s: %w", path, err)
+	}
+	return lut, nil
+}
+
+// ParseCube decodes a LUT in the .cube format.
+func ParseCube(r io.Reader) (*CubeLUT, error) {
+	h := sha256.New()
+	sc := bufio.NewScanner(io.TeeReader(r, h))
+	lut := &CubeLUT{
+		domain1D: [2][3]float64{{0, 0, 0}, {1, 1, 1}},
+		domain3D: [2][3]float64{{0, 0, 0}, {1, 1, 1}},
+	}
+	var data [][3]float64
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		var err error
+		switch key := fields[0]; key {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, "TITLE")), `"`)
+		case "LUT_1D_SIZE":
+			lut.size1D, err = cubeSize(fields, maxLUT1DSize)
+		case "LUT_3D_SIZE":
+			lut.size3D, err = cubeSize(fields, maxLUT3DSize)
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			var v [3]float64
+			if v, err = cubeTriple(fields[1:]); err == nil {
+				i := 0
+				if key == "DOMAIN_MAX" {
+					i = 1
+				}
+				lut.domain1D[i], lut.domain3D[i] = v, v
+			}
+		case "LUT_1D_INPUT_RANGE", "LUT_3D_INPUT_RANGE":
+			var lo, hi float64
+			if lo, hi, err = cubeRange(fields[1:]); err == nil {
+				domain := [2][3]float64{{lo, lo, lo}, {hi, hi, hi}}
+				if key == "LUT_1D_INPUT_RANGE" {
+					lut.domain1D = domain
+				} else {
+					lut.domain3D = domain
+				}
+			}
+		default:
+			var v [3]float64
+			if v, err = cubeTriple(fields); err != nil {
+				err = fmt.Errorf("unknown keyword %q", key)
+			}
+			data = append(data, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid .cube data: line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read .cube data: %w", err)
+	}
+
+	want := lut.size1D + lut.size3D*lut.size3D*lut.size3D
+	switch {
+	case lut.size1D == 0 && lut.size3D == 0:
+		return nil, fmt.Errorf("invalid .cube data: no LUT_1D_SIZE or LUT_3D_SIZE")
+	case len(data) != want:
+		return nil, fmt.Errorf("invalid .cube data: %d entries, want %d", len(data), want)
+	}
+	for c := 0; c < 3; c++ {
+		if lut.domain1D[0][c] >= lut.domain1D[1][c] || lut.domain3D[0][c] >= lut.domain3D[1][c] {
+			return nil, fmt.Errorf("invalid .cube data: empty domain")
+		}
+	}
+	lut.table1D, lut.table3D = data[:lut.size1D], data[lut.size1D:]
+	lut.Hash = hex.EncodeToString(h.Sum(nil))
+	return lut, nil
+}
+
+func cubeSize(fields []string, limit int) (int, error) {
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("%s takes one value", fields[0])
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 2 || n > limit {
+		return 0, fmt.Errorf("%s %q out of range [2, %d]", fields[0], fields[1], limit)
+	}
+	return n, nil
+}
+
+func cubeTriple(fields []string) ([3]float64, error) {
+	var v [3]float64
+	if len(fields) != 3 {
+		return v, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	for i, f := range fields {
+		x, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return v, fmt.Errorf("%q is not a number", f)
+		}
+		v[i] = x
+	}
+	return v, nil
+}
+
+func cubeRange(fields []string) (float64, float64, error) {
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("expected 2 values, got %d", len(fields))
+	}
+	lo, err1 := strconv.ParseFloat(fields[0], 64)
+	hi, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("invalid input range %q", strings.Join(fields, " "))
+	}
+	return lo, hi, nil
+}
+
+// Lookup maps a color with channels in [0, 1] through the LUT.
+func (l *CubeLUT) Lookup(c [3]float64, interp LUTInterpolation) [3]float64 {
+	if l.size1D > 0 {
+		c = l.lookup1D(c)
+	}
+	if l.size3D > 0 {
+		c = l.lookup3D(c, interp)
+	}
+	return c
+}
+
+// gridPos maps v onto the grid coordinates of a LUT with n points per
+// axis covering [lo, hi], returning the lower grid index and the fraction
+// towards the next one.
+func gridPos(v, lo, hi float64, n int) (int, float64) {
+	t := (v - lo) / (hi - lo) * float64(n-1)
+	if t <= 0 {
+		return 0, 0
+	}
+	if t >= float64(n-1) {
+		return n - 2, 1
+	}
+	i := int(t)
+	return i, t - float64(i)
+}
+
+func (l *CubeLUT) lookup1D(c [3]float64) [3]float64 {
+	var out [3]float64
+	for ch := range out {
+		i, f := gridPos(c[ch], l.domain1D[0][ch], l.domain1D[1][ch], l.size1D)
+		out[ch] = l.table1D[i][ch] + (l.table1D[i+1][ch]-l.table1D[i][ch])*f
+	}
+	return out
+}
+
+func (l *CubeLUT) lookup3D(c [3]float64, interp LUTInterpolation) [3]float64 {
+	n := l.size3D
+	ri, fr := gridPos(c[0], l.domain3D[0][0], l.domain3D[1][0], n)
+	gi, fg := gridPos(c[1], l.domain3D[0][1], l.domain3D[1][1], n)
+	bi, fb := gridPos(c[2], l.domain3D[0][2], l.domain3D[1][2], n)
+	at := func(dr, dg, db int) [3]float64 {
+		return l.table3D[(ri+dr)+(gi+dg)*n+(bi+db)*n*n]
+	}
+	c000, c111 := at(0, 0, 0), at(1, 1, 1)
+
+	var out [3]float64
+	if interp == LUTTrilinear {
+		c100, c010, c001 := at(1, 0, 0), at(0, 1, 0), at(0, 0, 1)
+		c110, c101, c011 := at(1, 1, 0), at(1, 0, 1), at(0, 1, 1)
+		for ch := range out {
+			c00 := c000[ch] + (c100[ch]-c000[ch])*fr
+			c10 := c010[ch] + (c110[ch]-c010[ch])*fr
+			c01 := c001[ch] + (c101[ch]-c001[ch])*fr
+			c11 := c011[ch] + (c111[ch]-c011[ch])*fr
+			c0 := c00 + (c10-c00)*fg
+			c1 := c01 + (c11-c01)*fg
+			out[ch] = c0 + (c1-c0)*fb
+		}
+		return out
+	}
+
+	// Tetrahedral: split the cell into six tetrahedra along its gray
+	// diagonal and interpolate within the one containing the point, walking
+	// from c000 to c111 through the two corners in between.
+	var a, b [3]float64
+	var fa, fb2, fc float64
+	switch {
+	case fr >= fg && fg >= fb:
+		a, b, fa, fb2, fc = at(1, 0, 0), at(1, 1, 0), fr, fg, fb
+	case fr >= fb && fb >= fg:
+		a, b, fa, fb2, fc = at(1, 0, 0), at(1, 0, 1), fr, fb, fg
+	case fb >= fr && fr >= fg:
+		a, b, fa, fb2, fc = at(0, 0, 1), at(1, 0, 1), fb, fr, fg
+	case fg >= fr && fr >= fb:
+		a, b, fa, fb2, fc = at(0, 1, 0), at(1, 1, 0), fg, fr, fb
+	case fg >= fb && fb >= fr:
+		a, b, fa, fb2, fc = at(0, 1, 0), at(0, 1, 1), fg, fb, fr
+	default: // fb >= fg >= fr
+		a, b, fa, fb2, fc = at(0, 0, 1), at(0, 1, 1), fb, fg, fr
+	}
+	for ch := range out {
+		out[ch] = c000[ch] + (a[ch]-c000[ch])*fa + (b[ch]-a[ch])*fb2 + (c111[ch]-b[ch])*fc
+	}
+	return out
+}
+
+// LUTFilter grades an image through a CubeLUT, blended with the original
+// by strength (0 leaves the image untouched, 1 is the full look).
+type LUTFilter struct {
+	lut      *CubeLUT
+	interp   LUTInterpolation
+	strength float64
+}
+
+// NewLUTFilter creates a new LUT filter.
+func NewLUTFilter(lut *CubeLUT, interp LUTInterpolation, strength float64) *LUTFilter {
+	return &LUTFilter{lut: lut, interp: interp, strength: strength}
+}
+
+func (f *LUTFilter) Name() string {
+	return FilterLUT
+}
+
+func (f *LUTFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	s := f.strength
+	return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+		out := f.lut.Lookup([3]float64{r / 255, g / 255, b / 255}, f.interp)
+		return r + (out[0]*255-r)*s, g + (out[1]*255-g)*s, b + (out[2]*255-b)*s
+	})
+}
+
+// verifyLUTHash checks a recorded hash prefix against a loaded LUT, so that
+// replaying a pipeline fails if the file has changed since.
+func verifyLUTHash(lut *CubeLUT, want string) error {
+	if want == "" || strings.HasPrefix(lut.Hash, strings.ToLower(want)) {
+		return nil
+	}
+	return fmt.Errorf("LUT file changed: sha256 %s does not match %s", lut.Hash[:lutHashLen], want)
+}
@@ -0,0 +1,160 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cubeText writes a 3D .cube LUT of size n whose entries are f of the
+// lattice point, after the given header lines.
+func cubeText(n int, f func(r, g, b float64) [3]float64, header ...string) string {
+	var sb strings.Builder
+	sb.WriteString("# generated\n")
+	for _, h := range header {
+		sb.WriteString(h + "\n")
+	}
+	fmt.Fprintf(&sb, "LUT_3D_SIZE %d\n", n)
+	step := 1 / float64(n-1)
+	for b := 0; b < n; b++ {
+		for g := 0; g < n; g++ {
+			for r := 0; r < n; r++ {
+				v := f(float64(r)*step, float64(g)*step, float64(b)*step)
+				fmt.Fprintf(&sb, "%.6f %.6f %.6f\n", v[0], v[1], v[2])
+			}
+		}
+	}
+	return sb.String()
+}
+
+func identity(r, g, b float64) [3]float64 { return [3]float64{r, g, b} }
+
+func parseCube(t *testing.T, text string) *CubeLUT {
+	t.Helper()
+	lut, err := ParseCube(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lut
+}
+
+func TestIdentityLUT(t *testing.T) {
+	src := fixture()
+	luts := map[string]string{
+		"3D": cubeText(17, identity, `TITLE "identity"`),
+		"1D": "LUT_1D_SIZE 2\n0 0 0\n1 1 1\n",
+	}
+	for name, text := range luts {
+		lut := parseCube(t, text)
+		for _, interp := range []LUTInterpolation{LUTTetrahedral, LUTTrilinear} {
+			if diff := changed(src, NewLUTFilter(lut, interp, 1).Apply(src)); !diff.Empty() {
+				t.Errorf("%s %s identity changed %v", name, interp, diff)
+			}
+		}
+	}
+	if lut := parseCube(t, luts["3D"]); lut.Title != "identity" || len(lut.Hash) != 64 {
+		t.Errorf("title %q, hash %q", lut.Title, lut.Hash)
+	}
+}
+
+func TestLUTInterpolationsAgreeOnLattice(t *testing.T) {
+	// A LUT far from linear, so that the interpolations differ between
+	// lattice points but must both return the table entries on them.
+	curve := func(r, g, b float64) [3]float64 { return [3]float64{r * r, g * b, math.Sqrt(b)} }
+	const n = 5
+	lut := parseCube(t, cubeText(n, curve))
+	differ := false
+	for b := 0; b < n; b++ {
+		for g := 0; g < n; g++ {
+			for r := 0; r < n; r++ {
+				c := [3]float64{float64(r) / (n - 1), float64(g) / (n - 1), float64(b) / (n - 1)}
+				want := curve(c[0], c[1], c[2])
+				tetra, tri := lut.Lookup(c, LUTTetrahedral), lut.Lookup(c, LUTTrilinear)
+				for ch := range want {
+					if math.Abs(tetra[ch]-want[ch]) > 1e-6 || math.Abs(tri[ch]-want[ch]) > 1e-6 {
+						t.Fatalf("lattice point %v: tetrahedral %v, trilinear %v, want %v", c, tetra, tri, want)
+					}
+				}
+
+				mid := [3]float64{c[0] + 0.1, c[1] + 0.05, c[2] + 0.02}
+				if lut.Lookup(mid, LUTTetrahedral) != lut.Lookup(mid, LUTTrilinear) {
+					differ = true
+				}
+			}
+		}
+	}
+	if !differ {
+		t.Error("tetrahedral and trilinear agree everywhere")
+	}
+}
+
+func TestLUTDomain(t *testing.T) {
+	// A 2-point LUT over [0, 2] that doubles its input is the identity on
+	// [0, 1] inputs scaled into that domain.
+	double := func(r, g, b float64) [3]float64 { return [3]float64{2 * r, 2 * g, 2 * b} }
+	lut := parseCube(t, cubeText(2, double, "DOMAIN_MIN 0 0 0", "DOMAIN_MAX 2 2 2"))
+	got := lut.Lookup([3]float64{0.5, 1, 0.25}, LUTTrilinear)
+	for ch, want := range []float64{0.5, 1, 0.25} {
+		if math.Abs(got[ch]-want) > 1e-6 {
+			t.Errorf("channel %d: %v, want %v", ch, got[ch], want)
+		}
+	}
+}
+
+func TestParseCubeErrors(t *testing.T) {
+	tests := map[string]string{
+		"no size":        "0 0 0\n1 1 1\n",
+		"too few":        "LUT_3D_SIZE 2\n0 0 0\n1 1 1\n",
+		"too many":       cubeText(2, identity) + "0 0 0\n",
+		"3D size 1":      "LUT_3D_SIZE 1\n0 0 0\n",
+		"3D size 257":    "LUT_3D_SIZE 257\n",
+		"1D size 65537":  "LUT_1D_SIZE 65537\n",
+		"size not int":   "LUT_3D_SIZE two\n",
+		"short entry":    "LUT_1D_SIZE 2\n0 0\n1 1 1\n",
+		"bad number":     "LUT_1D_SIZE 2\n0 0 x\n1 1 1\n",
+		"unknown key":    "LUT_1D_SIZE 2\nGAMMA 2\n0 0 0\n1 1 1\n",
+		"empty domain":   "DOMAIN_MAX 0 1 1\nLUT_1D_SIZE 2\n0 0 0\n1 1 1\n",
+		"inverted range": "LUT_3D_INPUT_RANGE 1 0\n" + cubeText(2, identity),
+	}
+	for name, text := range tests {
+		if _, err := ParseCube(strings.NewReader(text)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestLUTFilterHashCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "look.cube")
+	if err := os.WriteFile(path, []byte(cubeText(2, identity)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lut, err := LoadCube(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := lut.Hash[:lutHashLen]
+
+	f, err := DefaultRegistry().New(FilterLUT, Arg{Name: "path", Value: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := fmt.Sprint(f); !strings.Contains(label, prefix) {
+		t.Errorf("label %s does not record hash %s", label, prefix)
+	}
+	if _, err := DefaultRegistry().New(FilterLUT, Arg{Name: "path", Value: path}, Arg{Name: "sha256", Value: strings.ToUpper(prefix[:8])}); err != nil {
+		t.Errorf("matching prefix rejected: %v", err)
+	}
+
+	// Replaying the recorded label fails once the file has changed.
+	if err := os.WriteFile(path, []byte(cubeText(3, identity)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = DefaultRegistry().New(FilterLUT, Arg{Name: "path", Value: path}, Arg{Name: "sha256", Value: prefix})
+	if err == nil || errors.Is(err, ErrInvalidParam) || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("changed file: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"sort"
+)
+
+// octreeDepth is the number of levels below the root; at 8 every leaf
+// holds a single 24-bit color.
+const octreeDepth = 8
+
+// octreeLeafBound caps the leaves kept while pixels are inserted, so that
+// memory and the final reduction depend on the palette size rather than on
+// the number of distinct colors in the image.
+const octreeLeafBound = 1024
+
+// octreeNode is a cube of the RGB color space. Leaves accumulate the
+// pixels that fall into them; inner nodes split their cube into eight.
+type octreeNode struct {
+	children [8]*octreeNode
+	leaf     bool
+	count    int     // pixels in this subtree
+	r, g, b  float64 // channel sums, kept on leaves
+}
+
+type octree struct {
+	root   *octreeNode
+	levels [octreeDepth][]*octreeNode // inner nodes by depth
+	leaves int
+}
+
+// OctreePalette returns up to n colors that represent the opaque pixels of
+// src, chosen by building an octree of their colors and merging the least
+// used branches, deepest first, until at most n leaves remain. Branches are
+// already merged during insertion whenever the tree grows past
+// octreeLeafBound leaves, or n if that is larger.
+func OctreePalette(src *stdimage.NRGBA, n int) color.Palette {
+	return swatchPalette(octreeSwatches(src, n))
+}
+
+func octreeSwatches(src *stdimage.NRGBA, n int) []Swatch {
+	if n < 1 {
+		return nil
+	}
+	t := &octree{root: &octreeNode{}}
+	t.levels[0] = []*octreeNode{t.root}
+	bound := max(n, octreeLeafBound)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for i := 0; i < len(row); i += 4 {
+			if row[i+3] < alphaThreshold {
+				continue
+			}
+			t.insert(row[i], row[i+1], row[i+2])
+			for t.leaves > bound {
+				t.foldDeepest()
+			}
+		}
+	}
+	if t.root.count == 0 {
+		return []Swatch{}
+	}
+	t.reduce(n)
+
+	total := float64(t.root.count)
+	var swatches []Swatch
+	var walk func(node *octreeNode)
+	walk = func(node *octreeNode) {
+		if node.leaf {
+			c := float64(node.count)
+			swatches = append(swatches, Swatch{
+				Color:  color.NRGBA{R: clamp8(node.r / c), G: clamp8(node.g / c), B: clamp8(node.b / c), A: 0xFF},
+				Weight: c / total,
+			})
+			return
+		}
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(t.root)
+	return swatches
+}
+
+func (t *octree) insert(r, g, b uint8) {
+	node := t.root
+	for depth := 0; !node.leaf; depth++ {
+		node.count++
+		shift := 7 - depth
+		i := (r>>shift&1)<<2 | (g>>shift&1)<<1 | b>>shift&1
+		child := node.children[i]
+		if child == nil {
+			child = &octreeNode{leaf: depth+1 == octreeDepth}
+			if child.leaf {
+				t.leaves++
+			} else {
+				t.levels[depth+1] = append(t.levels[depth+1], child)
+			}
+			node.children[i] = child
+		}
+		node = child
+	}
+	node.count++
+	node.r += float64(r)
+	node.g += float64(g)
+	node.b += float64(b)
+}
+
+// reduce folds inner nodes into leaves until at most n leaves remain. Only
+// the deepest level's nodes have nothing but leaves below them, so levels
+// are emptied bottom-up, least populated nodes first.
+func (t *octree) reduce(n int) {
+	for depth := octreeDepth - 1; depth >= 0 && t.leaves > n; depth-- {
+		level := t.levels[depth]
+		sort.SliceStable(level, func(i, j int) bool { return level[i].count < level[j].count })
+		for len(level) > 0 && t.leaves > n {
+			node := level[0]
+			var children []*octreeNode
+			for _, child := range node.children {
+				if child != nil {
+					children = append(children, child)
+				}
+			}
+			if excess := t.leaves - n; excess < len(children)-1 {
+				// Folding the whole node would leave fewer than n colors;
+				// merge just enough of its smallest children instead.
+				sort.SliceStable(children, func(i, j int) bool { return children[i].count < children[j].count })
+				into := children[excess]
+				for _, child := range children[:excess] {
+					into.merge(child)
+					node.remove(child)
+				}
+				t.leaves -= excess
+				break
+			}
+			t.fold(node)
+			level = level[1:]
+		}
+		t.levels[depth] = level
+	}
+}
+
+// foldDeepest turns the least populated node of the deepest level into a
+// leaf. Every inner node is listed in levels, so the children of nodes on
+// the deepest non-empty level are all leaves.
+func (t *octree) foldDeepest() {
+	depth := octreeDepth - 1
+	for len(t.levels[depth]) == 0 {
+		depth--
+	}
+	level := t.levels[depth]
+	least := 0
+	for i, node := range level {
+		if node.count < level[least].count {
+			least = i
+		}
+	}
+	t.fold(level[least])
+	t.levels[depth] = append(level[:least], level[least+1:]...)
+}
+
+// fold merges all children of node, which must be leaves, into node and
+// makes it a leaf itself.
+func (t *octree) fold(node *octreeNode) {
+	for _, child := range node.children {
+		if child != nil {
+			node.merge(child)
+			node.remove(child)
+			t.leaves--
+		}
+	}
+	node.leaf = true
+	t.leaves++
+}
+
+// merge folds the pixels of leaf other into n. An inner node already
+// counts the pixels below it, so only its sums change.
+func (n *octreeNode) merge(other *octreeNode) {
+	if n.leaf {
+		n.count += other.count
+	}
+	n.r += other.r
+	n.g += other.g
+	n.b += other.b
+}
+
+func (n *octreeNode) remove(child *octreeNode) {
+	for i, c := range n.children {
+		if c == child {
+			n.children[i] = nil
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestOctreeKeepsFewColorsExact(t *testing.T) {
+	pix := labeled("abc/abc")
+	got := OctreePalette(pix, 8)
+	if len(got) != 3 {
+		t.Fatalf("%d colors, want 3", len(got))
+	}
+	for i, want := range []uint8{'a', 'b', 'c'} {
+		if c := got[i].(color.NRGBA); c != (color.NRGBA{R: want, A: 0xFF}) {
+			t.Errorf("color %d: %v", i, c)
+		}
+	}
+}
+
+func TestOctreeManyColors(t *testing.T) {
+	// Every 16-bit red/green combination, far more colors than the tree
+	// keeps while inserting.
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			copy(pix.Pix[pix.PixOffset(x, y):], []uint8{uint8(x), uint8(y), 0x80, 0xFF})
+		}
+	}
+	for _, n := range []int{1, 16, 256} {
+		swatches := octreeSwatches(pix, n)
+		if len(swatches) == 0 || len(swatches) > n {
+			t.Errorf("n=%d: %d swatches", n, len(swatches))
+		}
+		var total float64
+		for _, s := range swatches {
+			total += s.Weight
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("n=%d: weights sum to %g", n, total)
+		}
+	}
+	if c := OctreePalette(pix, 1)[0].(color.NRGBA); c.R < 126 || c.R > 129 || c.G < 126 || c.G > 129 || c.B != 0x80 {
+		t.Errorf("single color %v, want the mean", c)
+	}
+}
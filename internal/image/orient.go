@@ -0,0 +1,67 @@
+package image
+
+import (
+	stdimage "image"
+
+	"photoapp/internal/exif"
+)
+
+// Orient transforms src so that an image stored with orientation o
+// displays upright. The result has swapped dimensions for the four
+// orientations that involve a quarter turn. src is returned unchanged for
+// OrientationNormal and unknown values.
+func Orient(src *stdimage.NRGBA, o exif.Orientation) *stdimage.NRGBA {
+	if o <= exif.OrientationNormal || o > exif.OrientationRotate270 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o >= exif.OrientationTranspose {
+		dw, dh = h, w
+	}
+
+	// source maps a destination pixel back to the pixel it comes from.
+	var source func(x, y int) (int, int)
+	switch o {
+	case exif.OrientationFlipH:
+		source = func(x, y int) (int, int) { return w - 1 - x, y }
+	case exif.OrientationRotate180:
+		source = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case exif.OrientationFlipV:
+		source = func(x, y int) (int, int) { return x, h - 1 - y }
+	case exif.OrientationTranspose:
+		source = func(x, y int) (int, int) { return y, x }
+	case exif.OrientationRotate90:
+		source = func(x, y int) (int, int) { return y, h - 1 - x }
+	case exif.OrientationTransverse:
+		source = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case exif.OrientationRotate270:
+		source = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			sx, sy := source(x, y)
+			s := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+sy)
+			copy(row[x*4:x*4+4], src.Pix[s:s+4])
+		}
+	}
+	return dst
+}
+
+// Upright returns img with its pixels turned upright according to its EXIF
+// orientation and the orientation reset to normal. Images that need no
+// transform are returned as is.
+func Upright(img Image) Image {
+	meta := img.Metadata()
+	if meta.EXIF == nil || meta.EXIF.Orientation <= exif.OrientationNormal {
+		return img
+	}
+	orientation := meta.EXIF.Orientation
+	x := *meta.EXIF
+	x.Orientation = exif.OrientationNormal
+	meta.EXIF = &x
+	return NewBasicImage(img.ID(), Orient(img.Pixels(), orientation), meta)
+}
@@ -0,0 +1,122 @@
+package image
+
+import (
+	stdimage "image"
+	"strings"
+	"testing"
+
+	"photoapp/internal/exif"
+)
+
+// labeled builds a raster from rows of letters separated by "/", each
+// letter's code in the red channel, so that tests can spell out layouts.
+func labeled(layout string) *stdimage.NRGBA {
+	rows := strings.Split(layout, "/")
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x := range row {
+			i := pix.PixOffset(x, y)
+			pix.Pix[i], pix.Pix[i+3] = row[x], 0xFF
+		}
+	}
+	return pix
+}
+
+// layout is the inverse of labeled.
+func layout(pix *stdimage.NRGBA) string {
+	rows := make([]string, pix.Rect.Dy())
+	for y := range rows {
+		row := make([]byte, pix.Rect.Dx())
+		for x := range row {
+			row[x] = pix.Pix[pix.PixOffset(x, y)]
+		}
+		rows[y] = string(row)
+	}
+	return strings.Join(rows, "/")
+}
+
+// uprightLayout is how every stored layout below must display.
+const uprightLayout = "abc/def"
+
+// storedLayouts are the pixels a camera stores, with each orientation tag,
+// for a scene that displays as uprightLayout.
+var storedLayouts = []struct {
+	orientation exif.Orientation
+	stored      string
+}{
+	{exif.OrientationNormal, "abc/def"},
+	{exif.OrientationFlipH, "cba/fed"},
+	{exif.OrientationRotate180, "fed/cba"},
+	{exif.OrientationFlipV, "def/abc"},
+	{exif.OrientationTranspose, "ad/be/cf"},
+	{exif.OrientationRotate90, "cf/be/ad"},
+	{exif.OrientationTransverse, "fc/eb/da"},
+	{exif.OrientationRotate270, "da/eb/fc"},
+}
+
+func TestOrient(t *testing.T) {
+	for _, tt := range storedLayouts {
+		t.Run(tt.orientation.String(), func(t *testing.T) {
+			got := Orient(labeled(tt.stored), tt.orientation)
+			if got.Rect != stdimage.Rect(0, 0, 3, 2) {
+				t.Fatalf("bounds %v, want 3x2", got.Rect)
+			}
+			if l := layout(got); l != uprightLayout {
+				t.Errorf("pixels %s, want %s", l, uprightLayout)
+			}
+		})
+	}
+}
+
+func TestOrientSubImage(t *testing.T) {
+	// A stored raster that does not start at the origin.
+	big := labeled("xxxx/xcfx/xbex/xadx/xxxx")
+	sub := big.SubImage(stdimage.Rect(1, 1, 3, 4)).(*stdimage.NRGBA)
+	if l := layout(Orient(sub, exif.OrientationRotate90)); l != uprightLayout {
+		t.Errorf("pixels %s, want %s", l, uprightLayout)
+	}
+}
+
+func TestOrientUnknownValues(t *testing.T) {
+	src := labeled("abc/def")
+	for _, o := range []exif.Orientation{0, 9, -1} {
+		if got := Orient(src, o); got != src {
+			t.Errorf("orientation %d: source not returned unchanged", o)
+		}
+	}
+}
+
+func TestUpright(t *testing.T) {
+	for _, tt := range storedLayouts {
+		t.Run(tt.orientation.String(), func(t *testing.T) {
+			x := &exif.EXIF{Make: "Acme", Orientation: tt.orientation}
+			img := NewBasicImage("photo", labeled(tt.stored), ImageMetadata{EXIF: x, Rating: 4})
+			up := Upright(img)
+
+			meta := up.Metadata()
+			if meta.Width != 3 || meta.Height != 2 {
+				t.Errorf("metadata size %dx%d, want 3x2", meta.Width, meta.Height)
+			}
+			if l := layout(up.Pixels()); l != uprightLayout {
+				t.Errorf("pixels %s, want %s", l, uprightLayout)
+			}
+			if meta.EXIF.Orientation != exif.OrientationNormal {
+				t.Errorf("orientation %v, want normal", meta.EXIF.Orientation)
+			}
+			if meta.EXIF.Make != "Acme" || meta.Rating != 4 || up.ID() != "photo" {
+				t.Errorf("metadata not carried over: %+v", meta)
+			}
+			if x.Orientation != tt.orientation {
+				t.Error("Upright modified the source EXIF")
+			}
+			if tt.orientation == exif.OrientationNormal && up != img {
+				t.Error("upright image not returned as is")
+			}
+		})
+	}
+
+	plain := NewBasicImage("plain", labeled("abc/def"), ImageMetadata{})
+	if Upright(plain) != plain {
+		t.Error("image without EXIF not returned as is")
+	}
+}
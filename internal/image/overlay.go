@@ -0,0 +1,251 @@
+package image
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	_ "image/gif" // logo formats for LoadLogo
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	FilterWatermark = "watermark"
+	FilterText      = "text"
+)
+
+// Anchor is the corner, edge or center an overlay is placed against.
+type Anchor int
+
+const (
+	AnchorBottomRight Anchor = iota // the default
+	AnchorBottom
+	AnchorBottomLeft
+	AnchorLeft
+	AnchorTopLeft
+	AnchorTop
+	AnchorTopRight
+	AnchorRight
+	AnchorCenter
+)
+
+var anchorNames = [...]string{"bottom-right", "bottom", "bottom-left", "left", "top-left", "top", "top-right", "right", "center"}
+
+func (a Anchor) String() string {
+	if a < 0 || int(a) >= len(anchorNames) {
+		return anchorNames[0]
+	}
+	return anchorNames[a]
+}
+
+// ParseAnchor parses an anchor name such as "top-left" or "center".
+func ParseAnchor(s string) (Anchor, error) {
+	s = strings.ToLower(strings.ReplaceAll(s, "_", "-"))
+	if s == "" {
+		return AnchorBottomRight, nil
+	}
+	for i, name := range anchorNames {
+		if s == name || s == strings.ReplaceAll(name, "-", "") {
+			return Anchor(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown anchor %q", s)
+}
+
+// position returns where an overlay of size o goes inside an image of
+// size img, inset by margin pixels from the anchored edges.
+func (a Anchor) position(img, o stdimage.Point, margin int) stdimage.Point {
+	x := (img.X - o.X) / 2
+	switch a {
+	case AnchorBottomLeft, AnchorLeft, AnchorTopLeft:
+		x = margin
+	case AnchorBottomRight, AnchorRight, AnchorTopRight:
+		x = img.X - o.X - margin
+	}
+	y := (img.Y - o.Y) / 2
+	switch a {
+	case AnchorTopLeft, AnchorTop, AnchorTopRight:
+		y = margin
+	case AnchorBottomLeft, AnchorBottom, AnchorBottomRight:
+		y = img.Y - o.Y - margin
+	}
+	return stdimage.Pt(x, y)
+}
+
+// Placement says where and how strongly an overlay is stamped.
+type Placement struct {
+	Anchor  Anchor
+	Margin  float64 // inset from the anchored edges, or the gap between tiles, as a fraction of image width
+	Opacity float64 // 0 is invisible, 1 fully opaque
+	Tiled   bool    // repeat across the whole image instead of anchoring once
+	Angle   float64 // clockwise rotation of tiles in degrees
+}
+
+// OverlayFilter stamps a logo or caption onto an image. The stamp is built
+// for each image so that it can scale with the image's size.
+type OverlayFilter struct {
+	name      string
+	stamp     func(width, height int) *stdimage.NRGBA
+	placement Placement
+}
+
+// NewWatermarkFilter creates a filter that stamps logo scaled to scale
+// times the image width, keeping its aspect ratio.
+func NewWatermarkFilter(logo *stdimage.NRGBA, scale float64, placement Placement) *OverlayFilter {
+	return &OverlayFilter{
+		name:      FilterWatermark,
+		placement: placement,
+		stamp: func(width, _ int) *stdimage.NRGBA {
+			lw, lh := logo.Rect.Dx(), logo.Rect.Dy()
+			w := max(1, int(math.Round(float64(width)*scale)))
+			h := max(1, int(math.Round(float64(lh)*float64(w)/float64(lw))))
+			if w == lw && h == lh {
+				return logo
+			}
+			return Resize(logo, w, h, ResampleLanczos)
+		},
+	}
+}
+
+// NewTextFilter creates a filter that stamps text in the bundled font, with
+// capitals size times the image height tall but never under the font's
+// native 7 pixels.
+func NewTextFilter(text string, size float64, style TextStyle, placement Placement) *OverlayFilter {
+	return &OverlayFilter{
+		name:      FilterText,
+		placement: placement,
+		stamp: func(_, height int) *stdimage.NRGBA {
+			return RenderText(text, max(glyphHeight, int(math.Round(float64(height)*size))), style)
+		},
+	}
+}
+
+func (f *OverlayFilter) Name() string {
+	return f.name
+}
+
+func (f *OverlayFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	dst := clonePixels(src)
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	if w == 0 || h == 0 || len(src.Pix) == 0 {
+		return dst
+	}
+	stamp := f.stamp(w, h)
+	if stamp.Rect.Empty() {
+		return dst
+	}
+	p := f.placement
+	margin := int(math.Round(p.Margin * float64(w)))
+	if !p.Tiled {
+		at := p.Anchor.position(stdimage.Pt(w, h), stamp.Rect.Size(), margin)
+		DrawOver(dst, stamp, at, p.Opacity)
+		return dst
+	}
+
+	// Lay the tiles out on a brick grid in the rotated frame, every other
+	// row offset by half a tile, so they form bands along the angle.
+	sw, sh := stamp.Rect.Dx(), stamp.Rect.Dy()
+	stepX, stepY := float64(sw+max(1, margin)), float64(sh+max(1, margin))
+	if math.Mod(p.Angle, 360) != 0 {
+		stamp = NewRotateFilter(p.Angle).Apply(stamp)
+	}
+	sin, cos := math.Sincos(p.Angle * math.Pi / 180)
+	reach := math.Hypot(float64(w), float64(h))/2 + math.Max(stepX, stepY)
+	rows, cols := int(reach/stepY)+1, int(reach/stepX)+1
+	for j := -rows; j <= rows; j++ {
+		v := float64(j) * stepY
+		for i := -cols; i <= cols; i++ {
+			u := float64(i) * stepX
+			if j%2 != 0 {
+				u += stepX / 2
+			}
+			cx := float64(w)/2 + u*cos - v*sin
+			cy := float64(h)/2 + u*sin + v*cos
+			at := stdimage.Pt(int(math.Round(cx))-stamp.Rect.Dx()/2, int(math.Round(cy))-stamp.Rect.Dy()/2)
+			DrawOver(dst, stamp, at, p.Opacity)
+		}
+	}
+	return dst
+}
+
+// DrawOver blends src onto dst with its top-left corner at at, using the
+// Porter-Duff over operator with src's alpha scaled by opacity. Parts of
+// src falling outside dst are clipped.
+func DrawOver(dst, src *stdimage.NRGBA, at stdimage.Point, opacity float64) {
+	r := stdimage.Rectangle{Min: at, Max: at.Add(src.Rect.Size())}.Intersect(dst.Rect)
+	if r.Empty() || opacity <= 0 {
+		return
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		s := src.Pix[(y-at.Y)*src.Stride+(r.Min.X-at.X)*4:]
+		d := dst.Pix[y*dst.Stride+r.Min.X*4:]
+		for i := 0; i < r.Dx()*4; i += 4 {
+			sa := float64(s[i+3]) / 255 * opacity
+			if sa == 0 {
+				continue
+			}
+			da := float64(d[i+3]) / 255 * (1 - sa)
+			oa := sa + da
+			for c := 0; c < 3; c++ {
+				d[i+c] = clamp8((float64(s[i+c])*sa + float64(d[i+c])*da) / oa)
+			}
+			d[i+3] = clamp8(oa * 255)
+		}
+	}
+}
+
+// ParseColor parses a hex color: "#rgb" or "#rrggbb", or "#rgba" or
+// "#rrggbbaa" with alpha. The leading "#" is optional.
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		long := make([]byte, 0, 2*len(hex))
+		for i := 0; i < len(hex); i++ {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// LoadLogo decodes a PNG, JPEG or GIF file for use as a watermark and
+// returns it with the hex SHA-256 of the file.
+func LoadLogo(path string) (*stdimage.NRGBA, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("load logo: %w", err)
+	}
+	img, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("load logo %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return ToNRGBA(img), hex.EncodeToString(sum[:]), nil
+}
+
+// logoHashLen is the number of hex digits of a logo file's SHA-256 that are
+// recorded in filter metadata, as for LUT files.
+const logoHashLen = lutHashLen
+
+// verifyLogoHash checks a recorded hash prefix against the hash LoadLogo
+// returned, so that replaying a pipeline fails if the file has changed.
+func verifyLogoHash(hash, want string) error {
+	if want == "" || strings.HasPrefix(hash, strings.ToLower(want)) {
+		return nil
+	}
+	return fmt.Errorf("logo file changed: sha256 %s does not match %s", hash[:logoHashLen], want)
+}
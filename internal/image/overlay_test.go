@@ -0,0 +1,153 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestWatermarkPlacement(t *testing.T) {
+	black := color.NRGBA{A: 0xFF}
+	src := solid(200, 100, black)
+	logo := solid(20, 10, color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF})
+	tests := []struct {
+		anchor Anchor
+		scale  float64
+		margin float64
+		want   stdimage.Rectangle
+	}{
+		{AnchorBottomRight, 0.1, 0.05, stdimage.Rect(170, 80, 190, 90)},
+		{AnchorTopLeft, 0.1, 0.05, stdimage.Rect(10, 10, 30, 20)},
+		{AnchorTop, 0.1, 0.05, stdimage.Rect(90, 10, 110, 20)},
+		{AnchorRight, 0.1, 0, stdimage.Rect(180, 45, 200, 55)},
+		{AnchorCenter, 0.1, 0.05, stdimage.Rect(90, 45, 110, 55)},
+		// Scale is relative to the image width: 0.2 of 200 doubles the logo.
+		{AnchorBottomRight, 0.2, 0.05, stdimage.Rect(150, 70, 190, 90)},
+		{AnchorBottomLeft, 0.2, 0.02, stdimage.Rect(4, 76, 44, 96)},
+	}
+	for _, tt := range tests {
+		f := NewWatermarkFilter(logo, tt.scale, Placement{Anchor: tt.anchor, Margin: tt.margin, Opacity: 0.5})
+		dst := f.Apply(src)
+		if got := changed(src, dst); got != tt.want {
+			t.Errorf("%s scale %v margin %v: logo at %v, want %v", tt.anchor, tt.scale, tt.margin, got, tt.want)
+			continue
+		}
+		// Half-opaque white over black.
+		if c := dst.NRGBAAt(tt.want.Min.X+tt.want.Dx()/2, tt.want.Min.Y+tt.want.Dy()/2); c != (color.NRGBA{R: 128, G: 128, B: 128, A: 0xFF}) {
+			t.Errorf("%s: blended %v", tt.anchor, c)
+		}
+	}
+
+	if got := changed(src, NewWatermarkFilter(logo, 0.1, Placement{Opacity: 0}).Apply(src)); !got.Empty() {
+		t.Errorf("invisible logo changed %v", got)
+	}
+}
+
+func TestTextRendersGlyphs(t *testing.T) {
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	src := solid(200, 100, color.NRGBA{A: 0xFF})
+
+	// Capitals 10 pixels tall make "HI" 16x10, placed 10 pixels in.
+	f := NewTextFilter("HI", 0.1, TextStyle{Color: white}, Placement{Anchor: AnchorTopLeft, Margin: 0.05, Opacity: 1})
+	dst := f.Apply(src)
+	box := stdimage.Rect(10, 10, 26, 20)
+	if got := changed(src, dst); got.Empty() || !got.In(box) {
+		t.Fatalf("text drawn in %v, want inside %v", got, box)
+	}
+	lit := 0
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if dst.NRGBAAt(x, y).R > 0x80 {
+				lit++
+			}
+		}
+	}
+	if lit < box.Dx()*box.Dy()/5 {
+		t.Errorf("only %d of %d pixels lit", lit, box.Dx()*box.Dy())
+	}
+}
+
+func TestRenderTextNativeSize(t *testing.T) {
+	// At the font's own height each font pixel is one image pixel: the
+	// left column of 'H' is lit top to bottom and its middle is dark.
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	pix := RenderText("H", glyphHeight, TextStyle{Color: white})
+	if size := MeasureText("H", glyphHeight); pix.Rect.Size() != size || size != stdimage.Pt(glyphWidth, glyphHeight) {
+		t.Fatalf("rendered %v, measured %v", pix.Rect.Size(), size)
+	}
+	for y := 0; y < glyphHeight; y++ {
+		if pix.NRGBAAt(0, y) != white {
+			t.Errorf("row %d: left stem %v", y, pix.NRGBAAt(0, y))
+		}
+	}
+	if c := pix.NRGBAAt(2, 0); c.A != 0 {
+		t.Errorf("gap in H drawn: %v", c)
+	}
+
+	two := MeasureText("ab\nc", 14)
+	if two != stdimage.Pt(22, 32) {
+		t.Errorf("two lines measure %v", two)
+	}
+	if got := RenderText("", 14, TextStyle{Color: white}); !got.Rect.Empty() {
+		t.Errorf("empty text rendered %v", got.Rect)
+	}
+	boxed := RenderText("H", glyphHeight, TextStyle{Color: white, Background: color.NRGBA{A: 0x80}, Shadow: true})
+	if boxed.Rect.Size() != stdimage.Pt(glyphWidth+1+2*2, glyphHeight+1+2*2) {
+		t.Errorf("boxed text %v", boxed.Rect.Size())
+	}
+}
+
+func TestRenderTextScaled(t *testing.T) {
+	// At 10/7 image pixels per font pixel, the left stem of 'H' covers
+	// the first column and under half of the second.
+	white := color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	pix := RenderText("H", 10, TextStyle{Color: white})
+	if size := MeasureText("H", 10); pix.Rect.Size() != size || size != stdimage.Pt(7, 10) {
+		t.Fatalf("rendered %v, measured %v", pix.Rect.Size(), size)
+	}
+	if c := pix.NRGBAAt(0, 8); c != white {
+		t.Errorf("stem %v", c)
+	}
+	if c := pix.NRGBAAt(1, 8); c.A < 0x60 || c.A > 0x80 {
+		t.Errorf("stem edge alpha %#x, want about 3/7", c.A)
+	}
+}
+
+func TestMeasureTextBounded(t *testing.T) {
+	// A long caption at a full-height size on a tall image would need
+	// gigabytes; it is drawn smaller instead.
+	text := strings.Repeat("caption ", 250)
+	size := MeasureText(text, 40000)
+	if area := size.X * size.Y; area > maxPixels || area < maxPixels/2 {
+		t.Errorf("measured %v (%d pixels), want just under %d", size, area, maxPixels)
+	}
+	if size.Y >= 40000 {
+		t.Errorf("height %d not reduced", size.Y)
+	}
+	if got := MeasureText("HI", 4000); got.Y != 4000 {
+		t.Errorf("short text measured %v, want full height", got)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.NRGBA
+	}{
+		{"#fff", color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}},
+		{"e03c28", color.NRGBA{R: 0xE0, G: 0x3C, B: 0x28, A: 0xFF}},
+		{"#0008", color.NRGBA{A: 0x88}},
+		{"#00000080", color.NRGBA{A: 0x80}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseColor(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "#12", "#ggg", "#12345"} {
+		if _, err := ParseColor(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
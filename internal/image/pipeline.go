@@ -0,0 +1,324 @@
+package image
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError reports a malformed pipeline expression.
+// Pos is the 1-based character column where the problem was found.
+type SyntaxError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Step is one parsed stage of a pipeline, before validation.
+type Step struct {
+	Name string
+	Args []Arg
+	Pos  int
+}
+
+// Pipeline is a parsed and validated chain of filters, written as
+//
+//	resize(800, 600) | sharpen(amount=0.5) | sepia(0.3)
+//
+// Each step names a registered filter and may pass positional or named
+// arguments; parentheses are optional when there are none. Values are
+// numbers, bare words, or single- or double-quoted strings with Go escape
+// sequences, so that labels written with strconv.Quote read back unchanged.
+// A Pipeline holds no per-image state and can be reused across images.
+type Pipeline struct {
+	steps   []Step
+	filters []Filter
+}
+
+// ParsePipeline parses expr and validates it against the default registry.
+func ParsePipeline(expr string) (*Pipeline, error) {
+	return defaultRegistry.ParsePipeline(expr)
+}
+
+// ParsePipeline parses expr and validates every step against the registry.
+// An empty expression yields an empty pipeline.
+func (r *Registry) ParsePipeline(expr string) (*Pipeline, error) {
+	steps, err := parseSteps(expr)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]Filter, 0, len(steps))
+	for _, step := range steps {
+		filter, err := r.New(step.Name, step.Args...)
+		if err != nil {
+			return nil, fmt.Errorf("position %d: %w", step.Pos, err)
+		}
+		filters = append(filters, filter)
+	}
+	return &Pipeline{steps: steps, filters: filters}, nil
+}
+
+// Apply wraps img in one FilterDecorator per step.
+func (p *Pipeline) Apply(img Image) Image {
+	for _, filter := range p.filters {
+		img = NewFilterDecorator(img, filter)
+	}
+	return img
+}
+
+// Steps returns the parsed steps.
+func (p *Pipeline) Steps() []Step {
+	return p.steps
+}
+
+// Len returns the number of steps.
+func (p *Pipeline) Len() int {
+	return len(p.steps)
+}
+
+// String returns the pipeline in canonical form, suitable for storing in config.
+func (p *Pipeline) String() string {
+	labels := make([]string, len(p.filters))
+	for i, filter := range p.filters {
+		labels[i] = filterLabel(filter)
+	}
+	return strings.Join(labels, " | ")
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p *Pipeline) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using the default registry.
+func (p *Pipeline) UnmarshalText(text []byte) error {
+	parsed, err := ParsePipeline(string(text))
+	if err != nil {
+		return err
+	}
+	*p = *parsed
+	return nil
+}
+
+// pipelineParser is a small recursive-descent parser over the expression runes.
+type pipelineParser struct {
+	expr  string
+	runes []rune
+	pos   int
+}
+
+func parseSteps(expr string) ([]Step, error) {
+	p := &pipelineParser{expr: expr, runes: []rune(expr)}
+	p.skipSpace()
+	if p.eof() {
+		return nil, nil
+	}
+
+	var steps []Step
+	for {
+		step, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+
+		p.skipSpace()
+		if p.eof() {
+			return steps, nil
+		}
+		if p.peek() != '|' {
+			return nil, p.errorf("expected '|' between steps, found %q", p.peek())
+		}
+		p.pos++
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("expected filter name after '|'")
+		}
+	}
+}
+
+func (p *pipelineParser) parseStep() (Step, error) {
+	step := Step{Pos: p.pos + 1}
+	name, ok := p.ident()
+	if !ok {
+		return step, p.errorf("expected filter name")
+	}
+	step.Name = name
+
+	p.skipSpace()
+	if p.eof() || p.peek() != '(' {
+		return step, nil
+	}
+	p.pos++
+	p.skipSpace()
+	if !p.eof() && p.peek() == ')' {
+		p.pos++
+		return step, nil
+	}
+
+	for {
+		arg, err := p.parseArg()
+		if err != nil {
+			return step, err
+		}
+		step.Args = append(step.Args, arg)
+
+		p.skipSpace()
+		if p.eof() {
+			return step, p.errorf("unterminated argument list, expected ')'")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+			p.skipSpace()
+		case ')':
+			p.pos++
+			return step, nil
+		default:
+			return step, p.errorf("expected ',' or ')', found %q", p.peek())
+		}
+	}
+}
+
+func (p *pipelineParser) parseArg() (Arg, error) {
+	start := p.pos
+	if word, ok := p.ident(); ok {
+		p.skipSpace()
+		if !p.eof() && p.peek() == '=' {
+			p.pos++
+			p.skipSpace()
+			value, err := p.parseValue()
+			if err != nil {
+				return Arg{}, err
+			}
+			return Arg{Name: word, Value: value}, nil
+		}
+		// A bare word is a positional value, not a name.
+		p.pos = start
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return Arg{}, err
+	}
+	return Arg{Value: value}, nil
+}
+
+func (p *pipelineParser) parseValue() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected value")
+	}
+	switch r := p.peek(); {
+	case r == '"' || r == '\'':
+		return p.quoted(r)
+	case r == '-' || r == '+' || r == '.' || unicode.IsDigit(r):
+		return p.number()
+	default:
+		if word, ok := p.ident(); ok {
+			return word, nil
+		}
+		return "", p.errorf("expected value, found %q", r)
+	}
+}
+
+func (p *pipelineParser) quoted(quote rune) (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for !p.eof() {
+		r := p.peek()
+		p.pos++
+		switch r {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// escape decodes the escape sequence following a backslash, as in a Go
+// string literal. Either quote may be escaped in either kind of string.
+func (p *pipelineParser) escape(b *strings.Builder) error {
+	if p.eof() {
+		return nil // reported by quoted
+	}
+	if r := p.peek(); r == '"' || r == '\'' {
+		b.WriteRune(r)
+		p.pos++
+		return nil
+	}
+	rest := string(p.runes[p.pos:])
+	value, multibyte, tail, err := strconv.UnquoteChar("\\"+rest, 0)
+	if err != nil {
+		p.pos--
+		return p.errorf("invalid escape sequence")
+	}
+	if value < utf8.RuneSelf || multibyte {
+		b.WriteRune(value)
+	} else {
+		b.WriteByte(byte(value))
+	}
+	p.pos += utf8.RuneCountInString(rest) - utf8.RuneCountInString(tail)
+	return nil
+}
+
+func (p *pipelineParser) number() (string, error) {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if unicode.IsDigit(r) || strings.ContainsRune("+-.eE", r) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	text := string(p.runes[start:p.pos])
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		p.pos = start
+		return "", p.errorf("malformed number %q", text)
+	}
+	return text, nil
+}
+
+func (p *pipelineParser) ident() (string, bool) {
+	start := p.pos
+	for !p.eof() {
+		r := p.peek()
+		if unicode.IsLetter(r) || r == '_' || (p.pos > start && (unicode.IsDigit(r) || r == '-')) {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return string(p.runes[start:p.pos]), p.pos > start
+}
+
+func (p *pipelineParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *pipelineParser) peek() rune {
+	return p.runes[p.pos]
+}
+
+func (p *pipelineParser) eof() bool {
+	return p.pos >= len(p.runes)
+}
+
+func (p *pipelineParser) errorf(format string, args ...any) error {
+	return &SyntaxError{Expr: p.expr, Pos: p.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
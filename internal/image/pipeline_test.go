@@ -0,0 +1,93 @@
+package image
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPipelineStringRoundTrip(t *testing.T) {
+	reg := NewRegistry()
+	err := reg.Register(FilterSpec{
+		Name:   "text",
+		Params: []ParamSpec{{Name: "text", Type: ParamString}},
+		New:    func(Params) (Filter, error) { return NewGrayscaleFilter(), nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{
+		"plain",
+		"two\nlines",
+		`say "cheese"`,
+		`C:\photos\logo`,
+		"tab\there",
+		"naïve café ©",
+		"bell\a and nul\x00",
+		"\xff invalid utf-8",
+	}
+	for _, text := range texts {
+		step := `text(text=` + formatParam(text) + `)`
+		p, err := reg.ParsePipeline(step)
+		if err != nil {
+			t.Fatalf("parse %s: %v", step, err)
+		}
+		if got := p.Steps()[0].Args[0].Value; got != text {
+			t.Errorf("parse %s: text %q, want %q", step, got, text)
+		}
+		again, err := reg.ParsePipeline(p.String())
+		if err != nil {
+			t.Fatalf("reparse %s: %v", p.String(), err)
+		}
+		if again.String() != p.String() {
+			t.Errorf("String() not stable: %s, then %s", p.String(), again.String())
+		}
+	}
+}
+
+func TestPipelineQuotes(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`text('it\'s')`, "it's"},
+		{`text("it's")`, "it's"},
+		{`text('say \"hi\"')`, `say "hi"`},
+		{`text("a\nb")`, "a\nb"},
+		{`text('\u00e9\x41\101')`, "éAA"},
+	}
+	for _, tt := range tests {
+		steps, err := parseSteps(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := steps[0].Args[0].Value; got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestPipelineSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{`sepia(`, 7},
+		{`sepia(0.3) blur`, 12},
+		{`text("abc`, 6},
+		{`text("a\qb")`, 8},
+		{`text("a\`, 6},
+		{`blur | | sepia`, 8},
+		{`blur(1..2)`, 6},
+	}
+	for _, tt := range tests {
+		_, err := parseSteps(tt.expr)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: got %v, want a syntax error", tt.expr, err)
+			continue
+		}
+		if se.Pos != tt.pos {
+			t.Errorf("%s: error at %d (%v), want %d", tt.expr, se.Pos, se, tt.pos)
+		}
+	}
+}
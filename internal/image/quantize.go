@@ -0,0 +1,489 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const FilterQuantize = "quantize"
+
+// alphaThreshold is the alpha below which a pixel is treated as transparent
+// when mapping onto a palette.
+const alphaThreshold = 128
+
+// histogram bins colors at 5 bits per channel.
+const (
+	histBits = 5
+	histSize = 1 << (3 * histBits)
+)
+
+type colorBin struct {
+	key        int
+	count      int
+	r, g, b    float64 // channel sums
+	rq, gq, bq int     // quantized channel values, used for splitting
+}
+
+// Quantizer selects the algorithm that picks a palette for an image.
+type Quantizer int
+
+const (
+	QuantizeMedianCut Quantizer = iota // split the color space at population medians; the default
+	QuantizeOctree                     // merge the least used branches of a color octree
+)
+
+func (q Quantizer) String() string {
+	if q == QuantizeOctree {
+		return "octree"
+	}
+	return "mediancut"
+}
+
+// ParseQuantizer parses a quantizer name as accepted by the quantize filter.
+func ParseQuantizer(s string) (Quantizer, error) {
+	switch strings.ToLower(s) {
+	case "", "mediancut", "median-cut":
+		return QuantizeMedianCut, nil
+	case "octree":
+		return QuantizeOctree, nil
+	}
+	return 0, fmt.Errorf("unknown quantizer %q", s)
+}
+
+// Swatch is a palette color together with the share of the image's opaque
+// pixels it stands for.
+type Swatch struct {
+	Color  color.NRGBA
+	Weight float64
+}
+
+// Palette returns up to n colors that represent the opaque pixels of src.
+func Palette(src *stdimage.NRGBA, n int, q Quantizer) color.Palette {
+	if q == QuantizeOctree {
+		return OctreePalette(src, n)
+	}
+	return MedianCutPalette(src, n)
+}
+
+// DominantColors returns up to n colors that represent the opaque pixels of
+// src, most common first.
+func DominantColors(src *stdimage.NRGBA, n int, q Quantizer) []Swatch {
+	var swatches []Swatch
+	if q == QuantizeOctree {
+		swatches = octreeSwatches(src, n)
+	} else {
+		swatches = medianCutSwatches(src, n)
+	}
+	sort.SliceStable(swatches, func(i, j int) bool { return swatches[i].Weight > swatches[j].Weight })
+	return swatches
+}
+
+// MedianCutPalette returns up to n colors that represent the opaque pixels
+// of src, chosen by recursively splitting the color box with the widest range
+// at its population median.
+func MedianCutPalette(src *stdimage.NRGBA, n int) color.Palette {
+	return swatchPalette(medianCutSwatches(src, n))
+}
+
+func medianCutSwatches(src *stdimage.NRGBA, n int) []Swatch {
+	if n < 1 {
+		return nil
+	}
+	bins := buildHistogram(src)
+	if len(bins) == 0 {
+		return []Swatch{}
+	}
+
+	boxes := [][]colorBin{bins}
+	for len(boxes) < n {
+		// Split the box with the largest population-weighted range.
+		best, bestScore := -1, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			_, span := widestChannel(box)
+			score := span * boxCount(box)
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+		lo, hi := splitBox(boxes[best])
+		boxes[best] = lo
+		boxes = append(boxes, hi)
+	}
+
+	total := float64(boxCount(bins))
+	swatches := make([]Swatch, 0, len(boxes))
+	for _, box := range boxes {
+		swatches = append(swatches, Swatch{Color: averageColor(box), Weight: float64(boxCount(box)) / total})
+	}
+	return swatches
+}
+
+func swatchPalette(swatches []Swatch) color.Palette {
+	if swatches == nil {
+		return nil
+	}
+	palette := make(color.Palette, 0, len(swatches))
+	for _, s := range swatches {
+		palette = append(palette, s.Color)
+	}
+	return palette
+}
+
+func buildHistogram(src *stdimage.NRGBA) []colorBin {
+	hist := make([]colorBin, histSize)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for i := 0; i < len(row); i += 4 {
+			if row[i+3] < alphaThreshold {
+				continue
+			}
+			rq, gq, bq := int(row[i])>>(8-histBits), int(row[i+1])>>(8-histBits), int(row[i+2])>>(8-histBits)
+			bin := &hist[rq<<(2*histBits)|gq<<histBits|bq]
+			bin.count++
+			bin.r += float64(row[i])
+			bin.g += float64(row[i+1])
+			bin.b += float64(row[i+2])
+			bin.rq, bin.gq, bin.bq = rq, gq, bq
+		}
+	}
+	bins := make([]colorBin, 0, 4096)
+	for key, bin := range hist {
+		if bin.count > 0 {
+			bin.key = key
+			bins = append(bins, bin)
+		}
+	}
+	return bins
+}
+
+// widestChannel returns the channel (0=R, 1=G, 2=B) with the largest range and that range.
+func widestChannel(box []colorBin) (int, int) {
+	lo := [3]int{255, 255, 255}
+	hi := [3]int{}
+	for _, bin := range box {
+		for c, v := range [3]int{bin.rq, bin.gq, bin.bq} {
+			lo[c] = min(lo[c], v)
+			hi[c] = max(hi[c], v)
+		}
+	}
+	channel := 0
+	for c := 1; c < 3; c++ {
+		if hi[c]-lo[c] > hi[channel]-lo[channel] {
+			channel = c
+		}
+	}
+	return channel, hi[channel] - lo[channel] + 1
+}
+
+func splitBox(box []colorBin) ([]colorBin, []colorBin) {
+	channel, _ := widestChannel(box)
+	sort.Slice(box, func(i, j int) bool {
+		return binChannel(box[i], channel) < binChannel(box[j], channel)
+	})
+	half := boxCount(box) / 2
+	acc := 0
+	for i, bin := range box {
+		acc += bin.count
+		if acc >= half {
+			cut := min(max(i+1, 1), len(box)-1)
+			return box[:cut:cut], box[cut:]
+		}
+	}
+	cut := len(box) / 2
+	return box[:cut:cut], box[cut:]
+}
+
+func binChannel(bin colorBin, channel int) int {
+	switch channel {
+	case 0:
+		return bin.rq
+	case 1:
+		return bin.gq
+	default:
+		return bin.bq
+	}
+}
+
+func boxCount(box []colorBin) int {
+	n := 0
+	for _, bin := range box {
+		n += bin.count
+	}
+	return n
+}
+
+func averageColor(box []colorBin) color.NRGBA {
+	var r, g, b float64
+	n := float64(boxCount(box))
+	for _, bin := range box {
+		r += bin.r
+		g += bin.g
+		b += bin.b
+	}
+	return color.NRGBA{R: clamp8(r / n), G: clamp8(g / n), B: clamp8(b / n), A: 0xFF}
+}
+
+// Dither selects how Remap hides the banding of a small palette.
+type Dither int
+
+const (
+	DitherFloydSteinberg Dither = iota // diffuse all quantization error; the default
+	DitherAtkinson                     // diffuse 3/4 of the error, keeping more contrast
+	DitherBayer                        // ordered 8x8 threshold pattern, stable between frames
+	DitherNone                         // map each pixel to its nearest color
+)
+
+func (d Dither) String() string {
+	switch d {
+	case DitherAtkinson:
+		return "atkinson"
+	case DitherBayer:
+		return "bayer"
+	case DitherNone:
+		return "none"
+	default:
+		return "floyd-steinberg"
+	}
+}
+
+// ParseDither parses a dither name as accepted by the quantize filter.
+func ParseDither(s string) (Dither, error) {
+	switch strings.ToLower(s) {
+	case "", "floyd-steinberg", "floydsteinberg", "fs":
+		return DitherFloydSteinberg, nil
+	case "atkinson":
+		return DitherAtkinson, nil
+	case "bayer", "ordered":
+		return DitherBayer, nil
+	case "none":
+		return DitherNone, nil
+	}
+	return 0, fmt.Errorf("unknown dither %q", s)
+}
+
+// diffusion is one neighbor's share of a pixel's quantization error.
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+var (
+	floydSteinberg = []diffusion{{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16}}
+	atkinson       = []diffusion{{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8}}
+)
+
+// bayer8 is the 8x8 Bayer threshold matrix.
+var bayer8 = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Remap maps src onto palette. Pixels with alpha below 128 use the first
+// fully transparent palette entry when there is one.
+func Remap(src *stdimage.NRGBA, palette color.Palette, dither Dither) *stdimage.Paletted {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := stdimage.NewPaletted(stdimage.Rect(0, 0, w, h), palette)
+	if len(palette) == 0 {
+		return dst
+	}
+	m := newPaletteMatcher(palette)
+
+	var kernel []diffusion
+	switch dither {
+	case DitherFloydSteinberg:
+		kernel = floydSteinberg
+	case DitherAtkinson:
+		kernel = atkinson
+	}
+	// The ordered pattern spans roughly one step between palette colors,
+	// treating the palette as an evenly spaced color cube.
+	spread := math.Min(255, 255/math.Max(1, math.Cbrt(float64(len(m.opaque)))-1))
+
+	// Error rows hold RGB error for the current row and the two below,
+	// padded by two pixels on each side so neighbors never need bounds
+	// checks.
+	var rows [3][]float64
+	for i := range rows {
+		rows[i] = make([]float64, (w+4)*3)
+	}
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x := 0; x < w; x++ {
+			p := row[x*4 : x*4+4]
+			if p[3] < alphaThreshold && m.transparent >= 0 {
+				dst.Pix[y*dst.Stride+x] = uint8(m.transparent)
+				continue
+			}
+			e := rows[0][(x+2)*3 : (x+2)*3+3]
+			if dither == DitherBayer {
+				t := ((bayer8[y%8][x%8]+0.5)/64 - 0.5) * spread
+				e[0], e[1], e[2] = t, t, t
+			}
+			r := clamp8(float64(p[0]) + e[0])
+			g := clamp8(float64(p[1]) + e[1])
+			b := clamp8(float64(p[2]) + e[2])
+			idx := m.index(r, g, b)
+			dst.Pix[y*dst.Stride+x] = uint8(idx)
+			if kernel == nil {
+				continue
+			}
+
+			c := m.colors[idx]
+			er, eg, eb := float64(r)-c[0], float64(g)-c[1], float64(b)-c[2]
+			for _, d := range kernel {
+				o := (x + 2 + d.dx) * 3
+				buf := rows[d.dy]
+				buf[o] += er * d.weight
+				buf[o+1] += eg * d.weight
+				buf[o+2] += eb * d.weight
+			}
+		}
+		rows[0], rows[1], rows[2] = rows[1], rows[2], rows[0]
+		clear(rows[2])
+	}
+	return dst
+}
+
+// paletteMatcher finds nearest palette entries, caching results per
+// 5-bit-per-channel color so large images stay fast.
+type paletteMatcher struct {
+	colors      [][3]float64
+	opaque      []int
+	transparent int
+	cache       []int32
+}
+
+func newPaletteMatcher(palette color.Palette) *paletteMatcher {
+	m := &paletteMatcher{transparent: -1, cache: make([]int32, histSize)}
+	for i := range m.cache {
+		m.cache[i] = -1
+	}
+	for i, c := range palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		m.colors = append(m.colors, [3]float64{float64(n.R), float64(n.G), float64(n.B)})
+		if n.A == 0 {
+			if m.transparent < 0 {
+				m.transparent = i
+			}
+			continue
+		}
+		m.opaque = append(m.opaque, i)
+	}
+	if len(m.opaque) == 0 {
+		m.opaque = []int{0}
+	}
+	return m
+}
+
+func (m *paletteMatcher) index(r, g, b uint8) int {
+	key := int(r)>>(8-histBits)<<(2*histBits) | int(g)>>(8-histBits)<<histBits | int(b)>>(8-histBits)
+	if idx := m.cache[key]; idx >= 0 {
+		return int(idx)
+	}
+	best, bestDist := m.opaque[0], -1.0
+	for _, i := range m.opaque {
+		c := m.colors[i]
+		dr, dg, db := float64(r)-c[0], float64(g)-c[1], float64(b)-c[2]
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	m.cache[key] = int32(best)
+	return best
+}
+
+// ParsePalette parses hex colors such as "#000 #fff #e03c28" or
+// "000000,ffffff", separated by spaces, commas or semicolons.
+func ParsePalette(s string) (color.Palette, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' || r == ';' })
+	palette := make(color.Palette, 0, len(fields))
+	for _, field := range fields {
+		hex := strings.TrimPrefix(field, "#")
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return nil, fmt.Errorf("invalid color %q", field)
+		}
+		palette = append(palette, color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF})
+	}
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("palette has no colors")
+	}
+	if len(palette) > 256 {
+		return nil, fmt.Errorf("palette has %d colors, at most 256 are allowed", len(palette))
+	}
+	return palette, nil
+}
+
+// QuantizeFilter reduces an image to a small palette, either one chosen
+// for each image or a fixed one such as an e-ink display's. Alpha is kept
+// as is.
+type QuantizeFilter struct {
+	colors    int
+	quantizer Quantizer
+	palette   color.Palette
+	dither    Dither
+}
+
+// NewQuantizeFilter creates a filter that reduces each image to the n colors
+// the quantizer picks for it.
+func NewQuantizeFilter(n int, quantizer Quantizer, dither Dither) *QuantizeFilter {
+	return &QuantizeFilter{colors: n, quantizer: quantizer, dither: dither}
+}
+
+// NewFixedPaletteFilter creates a filter that maps images onto palette.
+func NewFixedPaletteFilter(palette color.Palette, dither Dither) *QuantizeFilter {
+	return &QuantizeFilter{palette: palette, dither: dither}
+}
+
+func (f *QuantizeFilter) Name() string {
+	return FilterQuantize
+}
+
+func (f *QuantizeFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	palette := f.palette
+	if palette == nil {
+		palette = Palette(src, f.colors, f.quantizer)
+	}
+	if len(palette) == 0 {
+		return clonePixels(src)
+	}
+	opaque := make(color.Palette, len(palette))
+	for i, c := range palette {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		n.A = 0xFF
+		opaque[i] = n
+	}
+
+	indexed := Remap(src, opaque, f.dither)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := opaque[indexed.Pix[y*indexed.Stride+x]].(color.NRGBA)
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = c.R, c.G, c.B, src.Pix[y*src.Stride+x*4+3]
+		}
+	}
+	return dst
+}
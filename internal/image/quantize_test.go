@@ -0,0 +1,190 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// gradientImage returns a smooth w x h color ramp.
+func gradientImage(w, h int) *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pix.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / (w - 1)), G: uint8(y * 255 / (h - 1)), B: uint8(200 - x*150/(w-1)), A: 0xFF})
+		}
+	}
+	return pix
+}
+
+// meanColor returns the average of each color channel of pix.
+func meanColor(pix stdimage.Image) [3]float64 {
+	var sum [3]float64
+	b := pix.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(pix.At(x, y)).(color.NRGBA)
+			sum[0] += float64(c.R)
+			sum[1] += float64(c.G)
+			sum[2] += float64(c.B)
+		}
+	}
+	n := float64(b.Dx() * b.Dy())
+	return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+}
+
+func TestParsePalette(t *testing.T) {
+	got, err := ParsePalette("#000 ffffff;#e03c28")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := color.Palette{
+		color.NRGBA{A: 0xFF},
+		color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+		color.NRGBA{R: 0xE0, G: 0x3C, B: 0x28, A: 0xFF},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d colors, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("color %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// Palettes are opaque, so alpha digits are rejected.
+	for _, s := range []string{"#0008", "#00000080", "#12", "#ggg", ""} {
+		if _, err := ParsePalette(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestMedianCutPalette(t *testing.T) {
+	src := gradientImage(64, 48)
+	for _, n := range []int{1, 2, 5, 16, 64, 256} {
+		if got := MedianCutPalette(src, n); len(got) < 1 || len(got) > n {
+			t.Errorf("%d colors requested, got %d", n, len(got))
+		}
+	}
+
+	// An image with fewer colors than asked for keeps them all exactly.
+	few := []color.NRGBA{
+		{R: 0xE0, G: 0x3C, B: 0x28, A: 0xFF},
+		{R: 0x20, G: 0x80, B: 0x40, A: 0xFF},
+		{R: 0x10, G: 0x10, B: 0x10, A: 0xFF},
+		{R: 0xF0, G: 0xF0, B: 0xE0, A: 0xFF},
+		{R: 0x30, G: 0x50, B: 0xC0, A: 0xFF},
+	}
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, 20, 10))
+	for i := 0; i < 200; i++ {
+		pix.SetNRGBA(i%20, i/20, few[(i*3+i/20)%len(few)])
+	}
+	for _, n := range []int{5, 16} {
+		palette := MedianCutPalette(pix, n)
+		if len(palette) != len(few) {
+			t.Errorf("n=%d: %d colors for a %d-color image", n, len(palette), len(few))
+		}
+		for _, c := range few {
+			if palette[palette.Index(c)] != c {
+				t.Errorf("n=%d: %v not kept", n, c)
+			}
+		}
+	}
+}
+
+func TestDominantColors(t *testing.T) {
+	// Three quarters red, one quarter blue.
+	split := solid(40, 40, color.NRGBA{R: 0xFF, A: 0xFF})
+	draw.Draw(split, stdimage.Rect(0, 0, 40, 10), stdimage.NewUniform(color.NRGBA{B: 0xFF, A: 0xFF}), stdimage.Point{}, draw.Src)
+
+	for _, q := range []Quantizer{QuantizeMedianCut, QuantizeOctree} {
+		for _, src := range []*stdimage.NRGBA{gradientImage(64, 48), fixture(), split} {
+			swatches := DominantColors(src, 8, q)
+			if len(swatches) == 0 || len(swatches) > 8 {
+				t.Fatalf("%s: %d swatches", q, len(swatches))
+			}
+			sum := 0.0
+			for i, s := range swatches {
+				sum += s.Weight
+				if i > 0 && s.Weight > swatches[i-1].Weight {
+					t.Errorf("%s: swatch %d weighs %v, more than %v before it", q, i, s.Weight, swatches[i-1].Weight)
+				}
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("%s: weights sum to %v", q, sum)
+			}
+		}
+
+		swatches := DominantColors(split, 2, q)
+		if len(swatches) != 2 || swatches[0].Color.R != 0xFF || math.Abs(swatches[0].Weight-0.75) > 1e-9 {
+			t.Errorf("%s: red/blue split gave %+v", q, swatches)
+		}
+	}
+}
+
+func TestRemapDithers(t *testing.T) {
+	// The corners of the color cube.
+	var palette color.Palette
+	for i := 0; i < 8; i++ {
+		palette = append(palette, color.NRGBA{R: uint8(i & 1 * 0xFF), G: uint8(i >> 1 & 1 * 0xFF), B: uint8(i >> 2 * 0xFF), A: 0xFF})
+	}
+	src := gradientImage(96, 64)
+	for _, dither := range []Dither{DitherFloydSteinberg, DitherAtkinson, DitherBayer} {
+		dst := Remap(src, palette, dither)
+		for i, idx := range dst.Pix {
+			if int(idx) >= len(palette) {
+				t.Fatalf("%s: pixel %d uses index %d", dither, i, idx)
+			}
+		}
+		// Dithering trades exact colors for the right local average; each
+		// pixel on its own is up to 127 off. Atkinson drops a quarter of
+		// the error, so it drifts further.
+		for y := 0; y < 64; y += 16 {
+			for x := 0; x < 96; x += 16 {
+				block := stdimage.Rect(x, y, x+16, y+16)
+				got, want := meanColor(dst.SubImage(block)), meanColor(src.SubImage(block))
+				for ch := range got {
+					if math.Abs(got[ch]-want[ch]) > 24 {
+						t.Errorf("%s: block %v channel %d mean %.1f, want %.1f", dither, block.Min, ch, got[ch], want[ch])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestQuantizeFilterKeepsAlpha(t *testing.T) {
+	src := fixture()
+	palette, err := ParsePalette("#000 #fff #e03c28 #2040c0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := []*QuantizeFilter{
+		NewQuantizeFilter(4, QuantizeMedianCut, DitherFloydSteinberg),
+		NewQuantizeFilter(4, QuantizeOctree, DitherBayer),
+		NewFixedPaletteFilter(palette, DitherAtkinson),
+	}
+	for i, f := range filters {
+		dst := f.Apply(src)
+		colors := make(map[color.NRGBA]bool)
+		for p := 0; p < len(dst.Pix); p += 4 {
+			if dst.Pix[p+3] != src.Pix[p+3] {
+				t.Fatalf("filter %d: alpha %d at byte %d, want %d", i, dst.Pix[p+3], p, src.Pix[p+3])
+			}
+			colors[color.NRGBA{R: dst.Pix[p], G: dst.Pix[p+1], B: dst.Pix[p+2], A: 0xFF}] = true
+		}
+		if len(colors) > 4 {
+			t.Errorf("filter %d: %d colors", i, len(colors))
+		}
+		if i == 2 {
+			for c := range colors {
+				if palette[palette.Index(c)] != c {
+					t.Errorf("filter %d: %v not in the palette", i, c)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,751 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	stdimage "image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownFilter = errors.New("unknown filter")
+	ErrInvalidParam  = errors.New("invalid filter parameter")
+)
+
+// maxDimension bounds the pixel sizes accepted by transform parameters.
+const maxDimension = 1 << 16
+
+// maxPixels bounds the area of an image a transform may produce, which
+// keeps a single raster allocation to 1 GiB.
+const maxPixels = 1 << 28
+
+// ParamType identifies the value type of a filter parameter.
+type ParamType int
+
+const (
+	ParamFloat ParamType = iota
+	ParamInt
+	ParamBool
+	ParamString
+)
+
+func (t ParamType) String() string {
+	switch t {
+	case ParamFloat:
+		return "float"
+	case ParamInt:
+		return "int"
+	case ParamBool:
+		return "bool"
+	default:
+		return "string"
+	}
+}
+
+// ParamSpec declares one filter parameter.
+// Min and Max bound numeric values; leaving both zero means unbounded.
+// A nil Default makes the parameter required.
+type ParamSpec struct {
+	Name        string
+	Type        ParamType
+	Min         float64
+	Max         float64
+	Default     any
+	Description string
+}
+
+// FilterSpec declares a filter, its parameters and how to build it.
+// New may store values it resolves, such as a file's content hash, back
+// into p so that they are recorded in the filter's label.
+type FilterSpec struct {
+	Name        string
+	Description string
+	Params      []ParamSpec
+	New         func(p Params) (Filter, error)
+}
+
+// Arg is a raw, unvalidated filter argument.
+// Positional arguments have an empty Name and bind to Params in declaration order.
+type Arg struct {
+	Name  string
+	Value string
+}
+
+// Params holds validated parameter values keyed by parameter name.
+type Params map[string]any
+
+// Float returns a float parameter.
+func (p Params) Float(name string) float64 {
+	v, _ := p[name].(float64)
+	return v
+}
+
+// Int returns an int parameter.
+func (p Params) Int(name string) int {
+	v, _ := p[name].(int)
+	return v
+}
+
+// Bool returns a bool parameter.
+func (p Params) Bool(name string) bool {
+	v, _ := p[name].(bool)
+	return v
+}
+
+// String returns a string parameter.
+func (p Params) String(name string) string {
+	v, _ := p[name].(string)
+	return v
+}
+
+// Registry maps filter names to their specs.
+type Registry struct {
+	mu    sync.RWMutex
+	specs map[string]FilterSpec
+}
+
+// NewRegistry creates an empty filter registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		specs: make(map[string]FilterSpec),
+	}
+}
+
+var defaultRegistry = newBuiltinRegistry()
+
+// DefaultRegistry returns the registry holding all built-in filters.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register adds a filter spec. Names are case-insensitive and must be unique.
+func (r *Registry) Register(spec FilterSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("filter name cannot be empty")
+	}
+	if spec.New == nil {
+		return fmt.Errorf("filter %s has no constructor", spec.Name)
+	}
+	key := strings.ToLower(spec.Name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.specs[key]; ok {
+		return fmt.Errorf("filter %s already registered", spec.Name)
+	}
+	r.specs[key] = spec
+	return nil
+}
+
+// Lookup returns the spec registered under name.
+func (r *Registry) Lookup(name string) (FilterSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.specs[strings.ToLower(name)]
+	return spec, ok
+}
+
+// Names returns the registered filter names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.specs))
+	for _, spec := range r.specs {
+		names = append(names, spec.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New validates args against the named filter's spec and builds the filter.
+func (r *Registry) New(name string, args ...Arg) (Filter, error) {
+	spec, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFilter, name)
+	}
+	params, err := spec.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := spec.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec.Name, err)
+	}
+	return &configuredFilter{Filter: filter, label: spec.label(params)}, nil
+}
+
+// bind resolves positional and named args into typed, range-checked params.
+func (s FilterSpec) bind(args []Arg) (Params, error) {
+	params := make(Params, len(s.Params))
+	next := 0
+	for _, arg := range args {
+		var ps *ParamSpec
+		if arg.Name == "" {
+			if next >= len(s.Params) {
+				return nil, fmt.Errorf("%w: %s takes at most %d arguments", ErrInvalidParam, s.Name, len(s.Params))
+			}
+			ps = &s.Params[next]
+			next++
+		} else {
+			ps = s.param(arg.Name)
+			if ps == nil {
+				return nil, fmt.Errorf("%w: %s has no parameter %q", ErrInvalidParam, s.Name, arg.Name)
+			}
+		}
+		if _, dup := params[ps.Name]; dup {
+			return nil, fmt.Errorf("%w: %s.%s given more than once", ErrInvalidParam, s.Name, ps.Name)
+		}
+		v, err := ps.parse(arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s.%s: %v", ErrInvalidParam, s.Name, ps.Name, err)
+		}
+		params[ps.Name] = v
+	}
+
+	for _, ps := range s.Params {
+		if _, ok := params[ps.Name]; ok {
+			continue
+		}
+		if ps.Default == nil {
+			return nil, fmt.Errorf("%w: %s.%s is required", ErrInvalidParam, s.Name, ps.Name)
+		}
+		params[ps.Name] = ps.Default
+	}
+	return params, nil
+}
+
+func (s FilterSpec) param(name string) *ParamSpec {
+	for i := range s.Params {
+		if strings.EqualFold(s.Params[i].Name, name) {
+			return &s.Params[i]
+		}
+	}
+	return nil
+}
+
+// label renders the filter in pipeline syntax, listing only non-default params.
+func (s FilterSpec) label(params Params) string {
+	var parts []string
+	for _, ps := range s.Params {
+		v := params[ps.Name]
+		if ps.Default != nil && v == ps.Default {
+			continue
+		}
+		parts = append(parts, ps.Name+"="+formatParam(v))
+	}
+	if len(parts) == 0 {
+		return s.Name
+	}
+	return s.Name + "(" + strings.Join(parts, ", ") + ")"
+}
+
+func (ps ParamSpec) parse(raw string) (any, error) {
+	var v any
+	var num float64
+	switch ps.Type {
+	case ParamFloat:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%q is not a finite number", raw)
+		}
+		v, num = f, f
+	case ParamInt:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		v, num = i, float64(i)
+	case ParamBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return b, nil
+	default:
+		return raw, nil
+	}
+	if (ps.Min != 0 || ps.Max != 0) && (num < ps.Min || num > ps.Max) {
+		return nil, fmt.Errorf("%v out of range [%v, %v]", v, ps.Min, ps.Max)
+	}
+	return v, nil
+}
+
+func formatParam(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// configuredFilter remembers the arguments a registry filter was built with
+// so the decorator can record a reproducible label in metadata.
+type configuredFilter struct {
+	Filter
+	label string
+}
+
+func (f *configuredFilter) String() string {
+	return f.label
+}
+
+func (f *configuredFilter) OutputSize(width, height int) (int, int) {
+	if s, ok := f.Filter.(OutputSizer); ok {
+		return s.OutputSize(width, height)
+	}
+	return width, height
+}
+
+func newBuiltinRegistry() *Registry {
+	r := NewRegistry()
+	for _, spec := range builtinFilters() {
+		if err := r.Register(spec); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// channelParam is the channel selector shared by the tone filters.
+var channelParam = ParamSpec{Name: "channel", Type: ParamString, Default: ToneRGB.String(), Description: "rgb, luminance, red, green or blue"}
+
+// edgeParam is the border handling shared by the convolution filters.
+var edgeParam = ParamSpec{Name: "edge", Type: ParamString, Default: EdgeClamp.String(), Description: "clamp, wrap or mirror"}
+
+func edgeMode(p Params) (EdgeMode, error) {
+	edge, err := ParseEdgeMode(p.String("edge"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	return edge, nil
+}
+
+// placementParams declares the parameters shared by overlay filters.
+func placementParams(opacity float64) []ParamSpec {
+	return []ParamSpec{
+		{Name: "anchor", Type: ParamString, Default: AnchorBottomRight.String(), Description: "top-left, top, ..., bottom-right or center"},
+		{Name: "margin", Type: ParamFloat, Min: 0, Max: 0.5, Default: 0.02, Description: "inset, or gap between tiles, as a fraction of image width"},
+		{Name: "opacity", Type: ParamFloat, Min: 0, Max: 1, Default: opacity, Description: "0 invisible, 1 opaque"},
+		{Name: "tile", Type: ParamBool, Default: false, Description: "repeat across the whole image"},
+		{Name: "angle", Type: ParamFloat, Min: -360, Max: 360, Default: -45.0, Description: "clockwise rotation of tiles in degrees"},
+	}
+}
+
+func placement(p Params) (Placement, error) {
+	anchor, err := ParseAnchor(p.String("anchor"))
+	if err != nil {
+		return Placement{}, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	return Placement{
+		Anchor:  anchor,
+		Margin:  p.Float("margin"),
+		Opacity: p.Float("opacity"),
+		Tiled:   p.Bool("tile"),
+		Angle:   p.Float("angle"),
+	}, nil
+}
+
+func toneChannel(p Params) (ToneChannel, error) {
+	channel, err := ParseToneChannel(p.String("channel"))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	return channel, nil
+}
+
+func builtinFilters() []FilterSpec {
+	return []FilterSpec{
+		{
+			Name:        FilterGrayscale,
+			Description: "Convert to Rec. 601 luma",
+			New: func(p Params) (Filter, error) {
+				return NewGrayscaleFilter(), nil
+			},
+		},
+		{
+			Name:        FilterSepia,
+			Description: "Warm brown sepia tone",
+			Params: []ParamSpec{
+				{Name: "strength", Type: ParamFloat, Min: 0, Max: 1, Default: defaultSepiaStrength, Description: "blend with the original"},
+			},
+			New: func(p Params) (Filter, error) {
+				return NewSepiaFilter(p.Float("strength")), nil
+			},
+		},
+		{
+			Name:        FilterBlur,
+			Description: "Gaussian blur",
+			Params: []ParamSpec{
+				{Name: "radius", Type: ParamFloat, Min: 0, Max: 100, Default: defaultBlurRadius, Description: "kernel radius in pixels"},
+			},
+			New: func(p Params) (Filter, error) {
+				return NewGaussianBlurFilter(p.Float("radius") / 3), nil
+			},
+		},
+		{
+			Name:        FilterSharpen,
+			Description: "Unsharp mask sharpening",
+			Params: []ParamSpec{
+				{Name: "amount", Type: ParamFloat, Min: 0, Max: 5, Default: 1.0, Description: "strength of the added detail"},
+				{Name: "radius", Type: ParamFloat, Min: 0, Max: 100, Default: 2.0, Description: "size of the detail enhanced, in pixels"},
+				{Name: "threshold", Type: ParamFloat, Min: 0, Max: 255, Default: 0.0, Description: "smallest difference sharpened"},
+			},
+			New: func(p Params) (Filter, error) {
+				return NewUnsharpMaskFilter(p.Float("amount"), p.Float("radius")/3, p.Float("threshold")), nil
+			},
+		},
+		{
+			Name:        FilterEdges,
+			Description: "Grayscale map of edge strength",
+			Params: []ParamSpec{
+				{Name: "method", Type: ParamString, Default: EdgeSobel.String(), Description: "sobel or laplacian"},
+				edgeParam,
+			},
+			New: func(p Params) (Filter, error) {
+				operator, err := ParseEdgeOperator(p.String("method"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				edge, err := edgeMode(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewEdgeDetectFilter(operator, edge), nil
+			},
+		},
+		{
+			Name:        FilterEmboss,
+			Description: "Raised relief lit from the top left",
+			Params:      []ParamSpec{edgeParam},
+			New: func(p Params) (Filter, error) {
+				edge, err := edgeMode(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewEmbossFilter(edge), nil
+			},
+		},
+		{
+			Name:        FilterConvolve,
+			Description: "Convolve with a custom kernel",
+			Params: []ParamSpec{
+				{Name: "kernel", Type: ParamString, Description: `rows separated by ";", e.g. "0 -1 0; -1 5 -1; 0 -1 0"`},
+				{Name: "normalize", Type: ParamBool, Default: true, Description: "scale weights to sum to 1"},
+				{Name: "bias", Type: ParamFloat, Min: -255, Max: 255, Default: 0.0, Description: "added to the result"},
+				edgeParam,
+			},
+			New: func(p Params) (Filter, error) {
+				kernel, err := ParseKernel(p.String("kernel"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				if p.Bool("normalize") {
+					kernel = kernel.Normalized()
+				}
+				kernel.Bias = p.Float("bias")
+				edge, err := edgeMode(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewKernelFilter(kernel, edge), nil
+			},
+		},
+		{
+			Name:        FilterExposure,
+			Description: "Brighten or darken in photographic stops",
+			Params: []ParamSpec{
+				{Name: "stops", Type: ParamFloat, Min: -10, Max: 10, Default: 0.0, Description: "exposure change; +1 doubles the light"},
+				channelParam,
+			},
+			New: func(p Params) (Filter, error) {
+				channel, err := toneChannel(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewExposureFilter(p.Float("stops"), channel), nil
+			},
+		},
+		{
+			Name:        FilterBrightness,
+			Description: "Shift all values up or down",
+			Params: []ParamSpec{
+				{Name: "amount", Type: ParamFloat, Min: -1, Max: 1, Default: 0.0, Description: "fraction of full scale to add"},
+				channelParam,
+			},
+			New: func(p Params) (Filter, error) {
+				channel, err := toneChannel(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewBrightnessFilter(p.Float("amount"), channel), nil
+			},
+		},
+		{
+			Name:        FilterContrast,
+			Description: "Increase or reduce contrast around mid-gray",
+			Params: []ParamSpec{
+				{Name: "amount", Type: ParamFloat, Min: -1, Max: 1, Default: 0.0, Description: "-1 flat gray, 1 threshold"},
+				channelParam,
+			},
+			New: func(p Params) (Filter, error) {
+				channel, err := toneChannel(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewContrastFilter(p.Float("amount"), channel), nil
+			},
+		},
+		{
+			Name:        FilterLevels,
+			Description: "Set the black and white points and midtone gamma",
+			Params: []ParamSpec{
+				{Name: "black", Type: ParamFloat, Min: 0, Max: 255, Default: 0.0, Description: "input value mapped to black"},
+				{Name: "white", Type: ParamFloat, Min: 0, Max: 255, Default: 255.0, Description: "input value mapped to white"},
+				{Name: "gamma", Type: ParamFloat, Min: 0.1, Max: 10, Default: 1.0, Description: "midtone gamma; above 1 brightens"},
+				channelParam,
+			},
+			New: func(p Params) (Filter, error) {
+				if p.Float("white") <= p.Float("black") {
+					return nil, fmt.Errorf("%w: white must be above black", ErrInvalidParam)
+				}
+				channel, err := toneChannel(p)
+				if err != nil {
+					return nil, err
+				}
+				return NewLevelsFilter(p.Float("black"), p.Float("white"), p.Float("gamma"), channel), nil
+			},
+		},
+		{
+			Name:        FilterCurves,
+			Description: "Tone curve through control points",
+			Params: []ParamSpec{
+				{Name: "points", Type: ParamString, Description: `"x,y" pairs in 0-255, e.g. "0,0 64,48 192,208 255,255"`},
+				channelParam,
+			},
+			New: func(p Params) (Filter, error) {
+				points, err := ParseCurvePoints(p.String("points"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				channel, err := toneChannel(p)
+				if err != nil {
+					return nil, err
+				}
+				f, err := NewCurvesFilter(points, channel)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				return f, nil
+			},
+		},
+		{
+			Name:        FilterWhiteBalance,
+			Description: "Correct a color cast by temperature and tint, a neutral pixel, or automatically",
+			Params: []ParamSpec{
+				{Name: "temperature", Type: ParamFloat, Min: 1667, Max: 25000, Default: neutralTemperature, Description: "scene light in Kelvin"},
+				{Name: "tint", Type: ParamFloat, Min: -100, Max: 100, Default: 0.0, Description: "magenta (positive) or green (negative) shift"},
+				{Name: "x", Type: ParamInt, Min: -1, Max: maxDimension, Default: -1, Description: "column of a neutral pixel; replaces temperature"},
+				{Name: "y", Type: ParamInt, Min: -1, Max: maxDimension, Default: -1, Description: "row of a neutral pixel"},
+				{Name: "auto", Type: ParamString, Default: "", Description: `"grayworld" or "whitepatch"; replaces everything else`},
+			},
+			New: func(p Params) (Filter, error) {
+				if s := p.String("auto"); s != "" {
+					method, err := ParseAutoWhiteBalance(s)
+					if err != nil {
+						return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+					}
+					return NewAutoWhiteBalanceFilter(method), nil
+				}
+				x, y := p.Int("x"), p.Int("y")
+				if (x < 0) != (y < 0) {
+					return nil, fmt.Errorf("%w: x and y must be given together", ErrInvalidParam)
+				}
+				if x >= 0 {
+					return NewNeutralPointFilter(x, y), nil
+				}
+				return NewTemperatureFilter(p.Float("temperature"), p.Float("tint")), nil
+			},
+		},
+		{
+			Name:        FilterLUT,
+			Description: "Color grade through a .cube 3D LUT",
+			Params: []ParamSpec{
+				{Name: "path", Type: ParamString, Description: ".cube file to load"},
+				{Name: "interpolation", Type: ParamString, Default: LUTTetrahedral.String(), Description: "tetrahedral or trilinear"},
+				{Name: "strength", Type: ParamFloat, Min: 0, Max: 1, Default: 1.0, Description: "blend with the original; 1 is the full look"},
+				{Name: "sha256", Type: ParamString, Default: "", Description: "expected file hash prefix; recorded automatically"},
+			},
+			New: func(p Params) (Filter, error) {
+				interp, err := ParseLUTInterpolation(p.String("interpolation"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				lut, err := LoadCube(p.String("path"))
+				if err != nil {
+					return nil, err
+				}
+				if err := verifyLUTHash(lut, p.String("sha256")); err != nil {
+					return nil, err
+				}
+				p["sha256"] = lut.Hash[:lutHashLen]
+				return NewLUTFilter(lut, interp, p.Float("strength")), nil
+			},
+		},
+		{
+			Name:        FilterQuantize,
+			Description: "Reduce to a small palette with optional dithering",
+			Params: []ParamSpec{
+				{Name: "colors", Type: ParamInt, Min: 2, Max: 256, Default: 16, Description: "palette size"},
+				{Name: "method", Type: ParamString, Default: QuantizeMedianCut.String(), Description: "mediancut or octree"},
+				{Name: "dither", Type: ParamString, Default: DitherFloydSteinberg.String(), Description: "floyd-steinberg, atkinson, bayer or none"},
+				{Name: "palette", Type: ParamString, Default: "", Description: `fixed hex colors, e.g. "#000 #fff"; overrides colors and method`},
+			},
+			New: func(p Params) (Filter, error) {
+				dither, err := ParseDither(p.String("dither"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				if s := p.String("palette"); s != "" {
+					palette, err := ParsePalette(s)
+					if err != nil {
+						return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+					}
+					return NewFixedPaletteFilter(palette, dither), nil
+				}
+				quantizer, err := ParseQuantizer(p.String("method"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				return NewQuantizeFilter(p.Int("colors"), quantizer, dither), nil
+			},
+		},
+		{
+			Name:        FilterWatermark,
+			Description: "Stamp a logo image, once or tiled",
+			Params: append([]ParamSpec{
+				{Name: "path", Type: ParamString, Description: "PNG, JPEG or GIF logo file"},
+				{Name: "scale", Type: ParamFloat, Min: 0.01, Max: 1, Default: 0.2, Description: "logo width as a fraction of image width"},
+			}, append(placementParams(0.5),
+				ParamSpec{Name: "sha256", Type: ParamString, Default: "", Description: "expected file hash prefix; recorded automatically"})...),
+			New: func(p Params) (Filter, error) {
+				place, err := placement(p)
+				if err != nil {
+					return nil, err
+				}
+				logo, hash, err := LoadLogo(p.String("path"))
+				if err != nil {
+					return nil, err
+				}
+				if err := verifyLogoHash(hash, p.String("sha256")); err != nil {
+					return nil, err
+				}
+				p["sha256"] = hash[:logoHashLen]
+				return NewWatermarkFilter(logo, p.Float("scale"), place), nil
+			},
+		},
+		{
+			Name:        FilterText,
+			Description: "Stamp a text caption in the bundled bitmap font",
+			Params: append([]ParamSpec{
+				{Name: "text", Type: ParamString, Description: "caption to draw"},
+				{Name: "size", Type: ParamFloat, Min: 0.005, Max: 1, Default: 0.04, Description: "capital height as a fraction of image height"},
+				{Name: "color", Type: ParamString, Default: "#fff", Description: "hex text color"},
+				{Name: "background", Type: ParamString, Default: "", Description: `hex box color behind the text, e.g. "#0008"; none if empty`},
+				{Name: "shadow", Type: ParamBool, Default: true, Description: "drop shadow for legibility"},
+			}, placementParams(1)...),
+			New: func(p Params) (Filter, error) {
+				place, err := placement(p)
+				if err != nil {
+					return nil, err
+				}
+				style := TextStyle{Shadow: p.Bool("shadow")}
+				if style.Color, err = ParseColor(p.String("color")); err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				if bg := p.String("background"); bg != "" {
+					if style.Background, err = ParseColor(bg); err != nil {
+						return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+					}
+				}
+				return NewTextFilter(p.String("text"), p.Float("size"), style, place), nil
+			},
+		},
+		{
+			Name:        FilterResize,
+			Description: "Scale to a width and height; 0 keeps the aspect ratio",
+			Params: []ParamSpec{
+				{Name: "width", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "target width in pixels"},
+				{Name: "height", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "target height in pixels"},
+				{Name: "method", Type: ParamString, Default: ResampleLanczos.String(), Description: "lanczos, bilinear or nearest"},
+			},
+			New: func(p Params) (Filter, error) {
+				if p.Int("width") == 0 && p.Int("height") == 0 {
+					return nil, fmt.Errorf("%w: width or height is required", ErrInvalidParam)
+				}
+				if p.Int("width")*p.Int("height") > maxPixels {
+					return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrInvalidParam, p.Int("width"), p.Int("height"), maxPixels)
+				}
+				method, err := ParseResampling(p.String("method"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+				}
+				return NewResizeFilter(p.Int("width"), p.Int("height"), method), nil
+			},
+		},
+		{
+			Name:        FilterCrop,
+			Description: "Cut out a rectangle, or the largest centered region with an aspect ratio",
+			Params: []ParamSpec{
+				{Name: "x", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "left edge"},
+				{Name: "y", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "top edge"},
+				{Name: "width", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "width in pixels"},
+				{Name: "height", Type: ParamInt, Min: 0, Max: maxDimension, Default: 0, Description: "height in pixels"},
+				{Name: "aspect", Type: ParamString, Default: "", Description: `aspect ratio such as "16:9"; replaces the rectangle`},
+			},
+			New: func(p Params) (Filter, error) {
+				if s := p.String("aspect"); s != "" {
+					aspect, err := ParseAspect(s)
+					if err != nil {
+						return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+					}
+					return NewAspectCropFilter(aspect), nil
+				}
+				if p.Int("width") == 0 || p.Int("height") == 0 {
+					return nil, fmt.Errorf("%w: width and height are required without aspect", ErrInvalidParam)
+				}
+				x, y := p.Int("x"), p.Int("y")
+				return NewCropFilter(stdimage.Rect(x, y, x+p.Int("width"), y+p.Int("height"))), nil
+			},
+		},
+		{
+			Name:        FilterRotate,
+			Description: "Rotate clockwise; multiples of 90 are lossless",
+			Params: []ParamSpec{
+				{Name: "degrees", Type: ParamFloat, Min: -360, Max: 360, Default: 90.0, Description: "clockwise angle"},
+			},
+			New: func(p Params) (Filter, error) {
+				return NewRotateFilter(p.Float("degrees")), nil
+			},
+		},
+		{
+			Name:        FilterFlip,
+			Description: "Mirror left to right, or top to bottom",
+			Params: []ParamSpec{
+				{Name: "vertical", Type: ParamBool, Default: false, Description: "flip top to bottom instead"},
+			},
+			New: func(p Params) (Filter, error) {
+				return NewFlipFilter(p.Bool("vertical")), nil
+			},
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package image
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistryRejectsNonFiniteFloats(t *testing.T) {
+	r := DefaultRegistry()
+	checked := 0
+	for _, name := range r.Names() {
+		spec, _ := r.Lookup(name)
+		for _, ps := range spec.Params {
+			if ps.Type != ParamFloat {
+				continue
+			}
+			for _, v := range []string{"nan", "NaN", "inf", "+Inf", "-inf"} {
+				_, err := r.New(name, Arg{Name: ps.Name, Value: v})
+				if !errors.Is(err, ErrInvalidParam) || !strings.Contains(err.Error(), "finite") {
+					t.Errorf("%s(%s=%s): %v", name, ps.Name, v, err)
+				}
+			}
+			checked++
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no float parameters registered")
+	}
+}
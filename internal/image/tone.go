@@ -0,0 +1,271 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FilterExposure   = "exposure"
+	FilterBrightness = "brightness"
+	FilterContrast   = "contrast"
+	FilterLevels     = "levels"
+	FilterCurves     = "curves"
+)
+
+// ToneChannel selects what a tone filter adjusts.
+type ToneChannel int
+
+const (
+	ToneRGB       ToneChannel = iota // red, green and blue independently
+	ToneLuminance                    // luma only, shifting all channels equally to keep hue
+	ToneRed
+	ToneGreen
+	ToneBlue
+)
+
+func (c ToneChannel) String() string {
+	switch c {
+	case ToneLuminance:
+		return "luminance"
+	case ToneRed:
+		return "red"
+	case ToneGreen:
+		return "green"
+	case ToneBlue:
+		return "blue"
+	default:
+		return "rgb"
+	}
+}
+
+// ParseToneChannel parses a channel name as accepted by the tone filters.
+func ParseToneChannel(s string) (ToneChannel, error) {
+	switch strings.ToLower(s) {
+	case "", "rgb":
+		return ToneRGB, nil
+	case "luminance", "luma", "l":
+		return ToneLuminance, nil
+	case "red", "r":
+		return ToneRed, nil
+	case "green", "g":
+		return ToneGreen, nil
+	case "blue", "b":
+		return ToneBlue, nil
+	}
+	return 0, fmt.Errorf("unknown channel %q", s)
+}
+
+// ToneFilter remaps channel values through a tone curve. The exposure,
+// brightness, contrast, levels and curves filters are all tone filters
+// that differ only in how the curve is built.
+type ToneFilter struct {
+	name    string
+	channel ToneChannel
+	curve   [256]float64 // output value for each input value, unclamped
+}
+
+func newToneFilter(name string, channel ToneChannel, fn func(v float64) float64) *ToneFilter {
+	f := &ToneFilter{name: name, channel: channel}
+	for v := range f.curve {
+		f.curve[v] = fn(float64(v))
+	}
+	return f
+}
+
+// NewExposureFilter creates a filter that scales linear light by 2^stops,
+// as changing a camera's exposure would.
+func NewExposureFilter(stops float64, channel ToneChannel) *ToneFilter {
+	gain := math.Exp2(stops)
+	return newToneFilter(FilterExposure, channel, func(v float64) float64 {
+		return encodeSRGB(decodeSRGB(v/255)*gain) * 255
+	})
+}
+
+// NewBrightnessFilter creates a filter that adds amount (-1 to 1) of full
+// scale to every value.
+func NewBrightnessFilter(amount float64, channel ToneChannel) *ToneFilter {
+	return newToneFilter(FilterBrightness, channel, func(v float64) float64 {
+		return v + amount*255
+	})
+}
+
+// NewContrastFilter creates a filter that steepens (amount > 0) or
+// flattens (amount < 0) values around mid-gray. -1 collapses the image to
+// gray and 1 to a threshold.
+func NewContrastFilter(amount float64, channel ToneChannel) *ToneFilter {
+	slope := math.Tan((amount + 1) * math.Pi / 4)
+	return newToneFilter(FilterContrast, channel, func(v float64) float64 {
+		return (v-127.5)*slope + 127.5
+	})
+}
+
+// NewLevelsFilter creates a filter that maps black to 0 and white to 255,
+// clipping values outside, then applies gamma to the midtones (above 1
+// brightens).
+func NewLevelsFilter(black, white, gamma float64, channel ToneChannel) *ToneFilter {
+	return newToneFilter(FilterLevels, channel, func(v float64) float64 {
+		t := (v - black) / math.Max(white-black, 1)
+		return math.Pow(math.Max(0, math.Min(1, t)), 1/gamma) * 255
+	})
+}
+
+// CurvePoint is a control point of a tone curve, in the 0-255 range.
+type CurvePoint struct {
+	X, Y float64
+}
+
+// ParseCurvePoints parses control points written as "x,y" pairs separated
+// by spaces or semicolons, e.g. "0,0 64,48 192,208 255,255".
+func ParseCurvePoints(s string) ([]CurvePoint, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ';' })
+	points := make([]CurvePoint, 0, len(fields))
+	for _, field := range fields {
+		xs, ys, ok := strings.Cut(field, ",")
+		x, err1 := strconv.ParseFloat(xs, 64)
+		y, err2 := strconv.ParseFloat(ys, 64)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid curve point %q", field)
+		}
+		points = append(points, CurvePoint{X: x, Y: y})
+	}
+	return points, nil
+}
+
+// NewCurvesFilter creates a filter following a smooth curve through the
+// control points. The curve is a monotone cubic spline, so it never
+// overshoots between points, and is flat beyond the first and last point.
+// At least two points with distinct X values are required.
+func NewCurvesFilter(points []CurvePoint, channel ToneChannel) (*ToneFilter, error) {
+	spline, err := newMonotoneSpline(points)
+	if err != nil {
+		return nil, err
+	}
+	return newToneFilter(FilterCurves, channel, spline), nil
+}
+
+func (f *ToneFilter) Name() string {
+	return f.name
+}
+
+func (f *ToneFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	switch f.channel {
+	case ToneLuminance:
+		return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+			y := luma(r, g, b)
+			d := f.at(y) - y
+			return r + d, g + d, b + d
+		})
+	case ToneRed:
+		return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+			return f.at(r), g, b
+		})
+	case ToneGreen:
+		return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+			return r, f.at(g), b
+		})
+	case ToneBlue:
+		return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+			return r, g, f.at(b)
+		})
+	default:
+		return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+			return f.at(r), f.at(g), f.at(b)
+		})
+	}
+}
+
+// at evaluates the curve at v in [0, 255], interpolating between entries
+// for the fractional values luminance produces.
+func (f *ToneFilter) at(v float64) float64 {
+	i := int(v)
+	if i >= 255 {
+		return f.curve[255]
+	}
+	if i < 0 {
+		return f.curve[0]
+	}
+	t := v - float64(i)
+	return f.curve[i] + (f.curve[i+1]-f.curve[i])*t
+}
+
+// newMonotoneSpline returns the Fritsch-Carlson monotone cubic interpolant
+// of points.
+func newMonotoneSpline(points []CurvePoint) (func(x float64) float64, error) {
+	pts := append([]CurvePoint(nil), points...)
+	sort.Slice(pts, func(i, j int) bool { return pts[i].X < pts[j].X })
+	if len(pts) < 2 {
+		return nil, fmt.Errorf("a curve needs at least 2 points, got %d", len(pts))
+	}
+	n := len(pts)
+	secants := make([]float64, n-1)
+	for i := range secants {
+		dx := pts[i+1].X - pts[i].X
+		if dx == 0 {
+			return nil, fmt.Errorf("curve has two points at x=%v", pts[i].X)
+		}
+		secants[i] = (pts[i+1].Y - pts[i].Y) / dx
+	}
+
+	// Start from averaged secants, then limit the tangents wherever they
+	// would make the curve overshoot.
+	tangents := make([]float64, n)
+	tangents[0], tangents[n-1] = secants[0], secants[n-2]
+	for i := 1; i < n-1; i++ {
+		if secants[i-1]*secants[i] <= 0 {
+			continue
+		}
+		tangents[i] = (secants[i-1] + secants[i]) / 2
+	}
+	for i, s := range secants {
+		if s == 0 {
+			tangents[i], tangents[i+1] = 0, 0
+			continue
+		}
+		a, b := tangents[i]/s, tangents[i+1]/s
+		if h := math.Hypot(a, b); h > 3 {
+			tangents[i], tangents[i+1] = 3*a/h*s, 3*b/h*s
+		}
+	}
+
+	return func(x float64) float64 {
+		if x <= pts[0].X {
+			return pts[0].Y
+		}
+		if x >= pts[n-1].X {
+			return pts[n-1].Y
+		}
+		i := sort.Search(n-1, func(i int) bool { return pts[i+1].X >= x })
+		dx := pts[i+1].X - pts[i].X
+		t := (x - pts[i].X) / dx
+		t2, t3 := t*t, t*t*t
+		return (2*t3-3*t2+1)*pts[i].Y + (t3-2*t2+t)*dx*tangents[i] +
+			(-2*t3+3*t2)*pts[i+1].Y + (t3-t2)*dx*tangents[i+1]
+	}, nil
+}
+
+// decodeSRGB converts an sRGB-encoded value in [0, 1] to linear light.
+func decodeSRGB(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// encodeSRGB converts linear light to an sRGB-encoded value, clamping to
+// [0, 1].
+func encodeSRGB(v float64) float64 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 1:
+		return 1
+	case v <= 0.0031308:
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -0,0 +1,201 @@
+package image
+
+import (
+	stdimage "image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// grayRamp returns a 256x1 image whose pixel x has every channel equal to x.
+func grayRamp() *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		pix.SetNRGBA(x, 0, color.NRGBA{R: uint8(x), G: uint8(x), B: uint8(x), A: 0xFF})
+	}
+	return pix
+}
+
+// checkRamp applies f to grayRamp and compares each output value with
+// want(input) to within tol levels.
+func checkRamp(t *testing.T, name string, f Filter, tol float64, want func(v float64) float64) {
+	t.Helper()
+	dst := f.Apply(grayRamp())
+	for x := 0; x < 256; x++ {
+		got := float64(dst.Pix[x*4])
+		w := math.Max(0, math.Min(255, want(float64(x))))
+		if math.Abs(got-w) > tol {
+			t.Errorf("%s: %d maps to %v, want %.1f", name, x, got, w)
+			return
+		}
+	}
+}
+
+func TestCurvesMonotone(t *testing.T) {
+	tests := []string{
+		"0,0 64,48 192,208 255,255",   // gentle S
+		"0,0 20,200 40,210 255,255",   // steep start then almost flat
+		"0,40 100,40 120,220 255,230", // flat segment followed by a jump
+		"0,255 128,60 255,0",          // decreasing
+	}
+	for _, s := range tests {
+		points, err := ParseCurvePoints(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewCurvesFilter(points, ToneRGB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range points {
+			if got := f.curve[int(p.X)]; got != p.Y {
+				t.Errorf("%s: curve(%v) = %v, want %v", s, p.X, got, p.Y)
+			}
+		}
+		// Between each pair of control points the curve moves one way
+		// only and stays within their values.
+		for i := 0; i+1 < len(points); i++ {
+			a, b := points[i], points[i+1]
+			lo, hi := min(a.Y, b.Y), max(a.Y, b.Y)
+			for x := int(a.X); x < int(b.X); x++ {
+				v, next := f.curve[x], f.curve[x+1]
+				if v < lo-1e-9 || v > hi+1e-9 {
+					t.Errorf("%s: curve(%d) = %v outside [%v, %v]", s, x, v, lo, hi)
+				}
+				if (b.Y >= a.Y && next < v-1e-9) || (b.Y <= a.Y && next > v+1e-9) {
+					t.Errorf("%s: curve turns between %d and %d (%v, %v)", s, x, x+1, v, next)
+				}
+			}
+		}
+	}
+
+	for _, s := range []string{"0,0", "10,0 10,255"} {
+		points, _ := ParseCurvePoints(s)
+		if _, err := NewCurvesFilter(points, ToneRGB); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
+
+func TestLevelsDefaultIsIdentity(t *testing.T) {
+	src := fixture()
+	f, err := DefaultRegistry().New(FilterLevels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := changed(src, f.Apply(src)); !diff.Empty() {
+		t.Errorf("default levels changed %v", diff)
+	}
+	for _, channel := range []ToneChannel{ToneRGB, ToneLuminance, ToneRed, ToneGreen, ToneBlue} {
+		if diff := changed(src, NewLevelsFilter(0, 255, 1, channel).Apply(src)); !diff.Empty() {
+			t.Errorf("%s: identity levels changed %v", channel, diff)
+		}
+	}
+}
+
+func TestExposure(t *testing.T) {
+	// Each stop doubles or halves linear light; the sRGB rounding of the
+	// result is within half a level, so compare within one.
+	for _, stops := range []float64{1, -1, 2.5} {
+		gain := math.Exp2(stops)
+		checkRamp(t, "exposure", NewExposureFilter(stops, ToneRGB), 1, func(v float64) float64 {
+			return encodeSRGB(decodeSRGB(v/255)*gain) * 255
+		})
+	}
+	// Mid gray, 18% reflectance, comes out at 36% after +1 stop.
+	out := NewExposureFilter(1, ToneRGB).Apply(solid(1, 1, color.NRGBA{R: 118, G: 118, B: 118, A: 0xFF})).Pix[0]
+	if lin := decodeSRGB(float64(out) / 255); math.Abs(lin-2*decodeSRGB(118.0/255)) > 0.005 {
+		t.Errorf("+1 stop turned 18%% gray into %.3f", lin)
+	}
+}
+
+func TestBrightness(t *testing.T) {
+	checkRamp(t, "brightness 0.2", NewBrightnessFilter(0.2, ToneRGB), 0, func(v float64) float64 { return math.Round(v + 51) })
+	checkRamp(t, "brightness -0.2", NewBrightnessFilter(-0.2, ToneRGB), 0, func(v float64) float64 { return math.Round(v - 51) })
+	checkRamp(t, "brightness 0", NewBrightnessFilter(0, ToneRGB), 0, func(v float64) float64 { return v })
+}
+
+func TestContrast(t *testing.T) {
+	checkRamp(t, "contrast 0", NewContrastFilter(0, ToneRGB), 0, func(v float64) float64 { return v })
+	checkRamp(t, "contrast -1", NewContrastFilter(-1, ToneRGB), 0, func(float64) float64 { return 128 })
+	// Halfway to a threshold: the slope is tan(3/8 pi) around mid-gray.
+	slope := math.Tan(3 * math.Pi / 8)
+	checkRamp(t, "contrast 0.5", NewContrastFilter(0.5, ToneRGB), 1, func(v float64) float64 { return (v-127.5)*slope + 127.5 })
+	checkRamp(t, "contrast 1", NewContrastFilter(1, ToneRGB), 0, func(v float64) float64 {
+		if v < 128 {
+			return 0
+		}
+		return 255
+	})
+}
+
+func TestLevels(t *testing.T) {
+	checkRamp(t, "levels 50-200", NewLevelsFilter(50, 200, 1, ToneRGB), 1, func(v float64) float64 { return (v - 50) * 255 / 150 })
+	dst := NewLevelsFilter(50, 200, 2, ToneRGB).Apply(grayRamp())
+	tests := []struct{ in, want uint8 }{
+		{0, 0}, {50, 0}, {125, 180}, // the midpoint rises to 0.5^(1/2)
+		{200, 255}, {230, 255},
+	}
+	for _, tt := range tests {
+		if got := dst.Pix[int(tt.in)*4]; got != tt.want {
+			t.Errorf("levels 50-200 gamma 2: %d maps to %d, want %d", tt.in, got, tt.want)
+		}
+	}
+	if got := NewLevelsFilter(0, 255, 0.5, ToneRGB).Apply(grayRamp()).Pix[128*4]; got >= 128 {
+		t.Errorf("gamma 0.5 brightened mid-gray to %d", got)
+	}
+}
+
+func TestToneChannels(t *testing.T) {
+	src := solid(1, 1, color.NRGBA{R: 200, G: 100, B: 50, A: 0x80})
+	tests := []struct {
+		channel ToneChannel
+		want    color.NRGBA
+	}{
+		{ToneRGB, color.NRGBA{R: 230, G: 130, B: 80, A: 0x80}},
+		{ToneRed, color.NRGBA{R: 230, G: 100, B: 50, A: 0x80}},
+		{ToneGreen, color.NRGBA{R: 200, G: 130, B: 50, A: 0x80}},
+		{ToneBlue, color.NRGBA{R: 200, G: 100, B: 80, A: 0x80}},
+		// Luma moves by 30 and every channel with it.
+		{ToneLuminance, color.NRGBA{R: 230, G: 130, B: 80, A: 0x80}},
+	}
+	for _, tt := range tests {
+		if got := NewBrightnessFilter(30.0/255, tt.channel).Apply(src).NRGBAAt(0, 0); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.channel, got, tt.want)
+		}
+	}
+}
+
+func TestToneLuminanceKeepsHue(t *testing.T) {
+	hue := func(c color.NRGBA) float64 {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return math.Atan2(math.Sqrt(3)*(g-b), 2*r-g-b)
+	}
+	src := fixture()
+	for _, f := range []*ToneFilter{
+		NewContrastFilter(0.4, ToneLuminance),
+		NewLevelsFilter(30, 220, 1.4, ToneLuminance),
+		NewExposureFilter(-0.5, ToneLuminance),
+	} {
+		dst := f.Apply(src)
+		for y := 0; y < src.Rect.Dy(); y++ {
+			for x := 0; x < src.Rect.Dx(); x++ {
+				a, b := src.NRGBAAt(x, y), dst.NRGBAAt(x, y)
+				if b.R == 0 || b.R == 255 || b.G == 0 || b.G == 255 || b.B == 0 || b.B == 255 {
+					continue // clipping may shift hue
+				}
+				// Every channel moves by the same amount, so the channel
+				// differences, and with them the hue, are kept.
+				if d := int(b.R) - int(b.G) - (int(a.R) - int(a.G)); d < -1 || d > 1 {
+					t.Fatalf("%s at (%d, %d): %v became %v", f.Name(), x, y, a, b)
+				}
+				if a.R == a.G && a.G == a.B {
+					continue
+				}
+				if d := math.Abs(hue(a) - hue(b)); d > 0.05 && d < 2*math.Pi-0.05 {
+					t.Fatalf("%s at (%d, %d): hue of %v moved %.3f in %v", f.Name(), x, y, a, d, b)
+				}
+			}
+		}
+	}
+}
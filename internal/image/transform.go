@@ -0,0 +1,436 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+	"strconv"
+	"strings"
+
+	"photoapp/internal/exif"
+)
+
+const (
+	FilterResize = "resize"
+	FilterCrop   = "crop"
+	FilterRotate = "rotate"
+	FilterFlip   = "flip"
+)
+
+// Resampling selects the interpolation used when resizing.
+type Resampling int
+
+const (
+	ResampleLanczos  Resampling = iota // Lanczos with three lobes; sharpest, the default
+	ResampleBilinear                   // triangle filter
+	ResampleNearest                    // nearest neighbour; fastest, keeps hard edges
+)
+
+func (r Resampling) String() string {
+	switch r {
+	case ResampleBilinear:
+		return "bilinear"
+	case ResampleNearest:
+		return "nearest"
+	default:
+		return "lanczos"
+	}
+}
+
+// ParseResampling parses a resampling name as accepted by the resize filter.
+func ParseResampling(s string) (Resampling, error) {
+	switch strings.ToLower(s) {
+	case "", "lanczos":
+		return ResampleLanczos, nil
+	case "bilinear", "linear":
+		return ResampleBilinear, nil
+	case "nearest":
+		return ResampleNearest, nil
+	}
+	return 0, fmt.Errorf("unknown resampling %q", s)
+}
+
+// kernel returns the radius and weight function of r's filter kernel.
+func (r Resampling) kernel() (float64, func(x float64) float64) {
+	switch r {
+	case ResampleBilinear:
+		return 1, func(x float64) float64 { return 1 - math.Abs(x) }
+	default:
+		return 3, func(x float64) float64 {
+			if x == 0 {
+				return 1
+			}
+			px := math.Pi * x
+			return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+		}
+	}
+}
+
+// ResizeFilter scales an image to a target size. A zero width or height
+// is derived from the other to keep the aspect ratio.
+type ResizeFilter struct {
+	width, height int
+	resampling    Resampling
+}
+
+// NewResizeFilter creates a new resize filter.
+func NewResizeFilter(width, height int, resampling Resampling) *ResizeFilter {
+	return &ResizeFilter{width: width, height: height, resampling: resampling}
+}
+
+func (f *ResizeFilter) Name() string {
+	return FilterResize
+}
+
+func (f *ResizeFilter) OutputSize(width, height int) (int, int) {
+	dw, dh := f.width, f.height
+	switch {
+	case width == 0 || height == 0:
+		return width, height
+	case dw == 0:
+		dw = max(1, int(math.Round(float64(width)*float64(dh)/float64(height))))
+	case dh == 0:
+		dh = max(1, int(math.Round(float64(height)*float64(dw)/float64(width))))
+	}
+	// A size derived from a very narrow or wide image can be enormous;
+	// shrink it to the largest area allowed, keeping the aspect ratio.
+	if area := float64(dw) * float64(dh); area > maxPixels {
+		scale := math.Sqrt(maxPixels / area)
+		dw, dh = max(1, int(float64(dw)*scale)), max(1, int(float64(dh)*scale))
+	}
+	return dw, dh
+}
+
+func (f *ResizeFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw == 0 || sh == 0 {
+		return clonePixels(src)
+	}
+	dw, dh := f.OutputSize(sw, sh)
+	return Resize(src, dw, dh, f.resampling)
+}
+
+// Fit scales src down to fit within maxWidth x maxHeight, keeping its
+// aspect ratio. Images that already fit are copied unchanged.
+func Fit(src *stdimage.NRGBA, maxWidth, maxHeight int, resampling Resampling) *stdimage.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= maxWidth && sh <= maxHeight {
+		return clonePixels(src)
+	}
+	scale := math.Min(float64(maxWidth)/float64(sw), float64(maxHeight)/float64(sh))
+	dw := max(1, int(math.Round(float64(sw)*scale)))
+	dh := max(1, int(math.Round(float64(sh)*scale)))
+	return Resize(src, dw, dh, resampling)
+}
+
+func resizeNearest(src *stdimage.NRGBA, dw, dh int) *stdimage.NRGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy := (2*y + 1) * sh / (2 * dh)
+		row := src.Pix[sy*src.Stride:]
+		d := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			sx := (2*x + 1) * sw / (2 * dw)
+			copy(d[x*4:x*4+4], row[sx*4:sx*4+4])
+		}
+	}
+	return dst
+}
+
+// Resize scales src to exactly dw x dh. Lanczos and bilinear use a
+// separable filter with channels weighted by alpha, so transparent pixels
+// do not bleed color.
+func Resize(src *stdimage.NRGBA, dw, dh int, resampling Resampling) *stdimage.NRGBA {
+	if resampling == ResampleNearest {
+		return resizeNearest(src, dw, dh)
+	}
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	xw := resampleWeights(sw, dw, resampling)
+	yw := resampleWeights(sh, dh, resampling)
+
+	// Horizontal pass into a premultiplied float buffer, vertical pass back out.
+	tmp := make([]float64, dw*sh*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, c := range xw {
+			var acc [4]float64
+			for k, weight := range c.weights {
+				p := row[(c.first+k)*4:]
+				a := float64(p[3]) * weight
+				acc[0] += float64(p[0]) * a
+				acc[1] += float64(p[1]) * a
+				acc[2] += float64(p[2]) * a
+				acc[3] += a
+			}
+			copy(tmp[(y*dw+x)*4:], acc[:])
+		}
+	}
+
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, dw, dh))
+	for y, c := range yw {
+		for x := 0; x < dw; x++ {
+			var acc [4]float64
+			for k, weight := range c.weights {
+				p := tmp[((c.first+k)*dw+x)*4:]
+				acc[0] += p[0] * weight
+				acc[1] += p[1] * weight
+				acc[2] += p[2] * weight
+				acc[3] += p[3] * weight
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			if acc[3] > 0 {
+				d[0] = clamp8(acc[0] / acc[3])
+				d[1] = clamp8(acc[1] / acc[3])
+				d[2] = clamp8(acc[2] / acc[3])
+			}
+			d[3] = clamp8(acc[3])
+		}
+	}
+	return dst
+}
+
+// contribution lists the source samples that make up one destination
+// sample: weights[k] applies to source index first+k.
+type contribution struct {
+	first   int
+	weights []float64
+}
+
+// resampleWeights computes normalized filter weights mapping n source
+// samples onto m destination samples. When shrinking, the kernel is
+// stretched by the scale factor so that it averages the samples it covers.
+func resampleWeights(n, m int, resampling Resampling) []contribution {
+	radius, fn := resampling.kernel()
+	scale := float64(n) / float64(m)
+	stretch := math.Max(scale, 1)
+	support := radius * stretch
+
+	out := make([]contribution, m)
+	for i := range out {
+		center := (float64(i)+0.5)*scale - 0.5
+		first := max(0, int(math.Ceil(center-support)))
+		last := min(n-1, int(math.Floor(center+support)))
+		weights := make([]float64, 0, last-first+1)
+		var sum float64
+		for j := first; j <= last; j++ {
+			w := fn((float64(j) - center) / stretch)
+			if math.Abs(float64(j)-center) >= support {
+				w = 0
+			}
+			weights = append(weights, w)
+			sum += w
+		}
+		if sum == 0 {
+			// The kernel missed every sample; take the nearest one.
+			j := clampInt(int(math.Round(center)), 0, n-1)
+			first, weights, sum = j, []float64{1}, 1
+		}
+		for k := range weights {
+			weights[k] /= sum
+		}
+		out[i] = contribution{first: first, weights: weights}
+	}
+	return out
+}
+
+// CropFilter cuts out a rectangle of the image, either given directly or
+// as the largest centered region with a given aspect ratio. The rectangle
+// is clipped to the image.
+type CropFilter struct {
+	rect   stdimage.Rectangle
+	aspect float64 // width / height; used instead of rect when positive
+}
+
+// NewCropFilter creates a crop filter that keeps rect.
+func NewCropFilter(rect stdimage.Rectangle) *CropFilter {
+	return &CropFilter{rect: rect}
+}
+
+// NewAspectCropFilter creates a crop filter that keeps the largest centered
+// region whose width / height is aspect.
+func NewAspectCropFilter(aspect float64) *CropFilter {
+	return &CropFilter{aspect: aspect}
+}
+
+// ParseAspect parses an aspect ratio written as "16:9", "16/9" or "1.78".
+func ParseAspect(s string) (float64, error) {
+	if i := strings.IndexAny(s, ":/"); i >= 0 {
+		w, err1 := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+		h, err2 := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+			return 0, fmt.Errorf("invalid aspect ratio %q", s)
+		}
+		return w / h, nil
+	}
+	a, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || a <= 0 {
+		return 0, fmt.Errorf("invalid aspect ratio %q", s)
+	}
+	return a, nil
+}
+
+func (f *CropFilter) Name() string {
+	return FilterCrop
+}
+
+// region returns the rectangle kept from a width x height image.
+func (f *CropFilter) region(width, height int) stdimage.Rectangle {
+	r := f.rect
+	if f.aspect > 0 {
+		cw, ch := width, int(math.Round(float64(width)/f.aspect))
+		if ch > height {
+			cw, ch = int(math.Round(float64(height)*f.aspect)), height
+		}
+		r = stdimage.Rect(0, 0, cw, ch).Add(stdimage.Pt((width-cw)/2, (height-ch)/2))
+	}
+	return r.Intersect(stdimage.Rect(0, 0, width, height))
+}
+
+func (f *CropFilter) OutputSize(width, height int) (int, int) {
+	r := f.region(width, height)
+	return r.Dx(), r.Dy()
+}
+
+func (f *CropFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	r := f.region(src.Rect.Dx(), src.Rect.Dy())
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := 0; y < r.Dy(); y++ {
+		s := src.PixOffset(src.Rect.Min.X+r.Min.X, src.Rect.Min.Y+r.Min.Y+y)
+		copy(dst.Pix[y*dst.Stride:(y+1)*dst.Stride], src.Pix[s:])
+	}
+	return dst
+}
+
+// RotateFilter rotates an image clockwise by an angle in degrees.
+// Multiples of 90 are exact; other angles are resampled bilinearly onto a
+// canvas grown to fit the rotated image, with transparent corners.
+type RotateFilter struct {
+	degrees float64
+}
+
+// NewRotateFilter creates a new rotate filter.
+func NewRotateFilter(degrees float64) *RotateFilter {
+	return &RotateFilter{degrees: degrees}
+}
+
+func (f *RotateFilter) Name() string {
+	return FilterRotate
+}
+
+// angle returns the rotation normalized to [0, 360).
+func (f *RotateFilter) angle() float64 {
+	deg := math.Mod(f.degrees, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+func (f *RotateFilter) OutputSize(width, height int) (int, int) {
+	switch deg := f.angle(); deg {
+	case 0, 180:
+		return width, height
+	case 90, 270:
+		return height, width
+	default:
+		return rotatedSize(width, height, deg*math.Pi/180)
+	}
+}
+
+func (f *RotateFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	deg := f.angle()
+	switch deg {
+	case 0:
+		return clonePixels(src)
+	case 90:
+		return Orient(src, exif.OrientationRotate90)
+	case 180:
+		return Orient(src, exif.OrientationRotate180)
+	case 270:
+		return Orient(src, exif.OrientationRotate270)
+	}
+	return rotate(src, deg*math.Pi/180)
+}
+
+// rotate turns src clockwise by theta radians about its center.
+func rotate(src *stdimage.NRGBA, theta float64) *stdimage.NRGBA {
+	sw, sh := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+	sin, cos := math.Sincos(theta)
+	dw, dh := rotatedSize(src.Rect.Dx(), src.Rect.Dy(), theta)
+	dst := stdimage.NewNRGBA(stdimage.Rect(0, 0, dw, dh))
+
+	// Map each destination pixel center back into the source with the
+	// inverse rotation and sample there.
+	for y := 0; y < dh; y++ {
+		dy := float64(y) + 0.5 - float64(dh)/2
+		for x := 0; x < dw; x++ {
+			dx := float64(x) + 0.5 - float64(dw)/2
+			sx := dx*cos + dy*sin + sw/2 - 0.5
+			sy := -dx*sin + dy*cos + sh/2 - 0.5
+			copy(dst.Pix[y*dst.Stride+x*4:], bilinear(src, sx, sy))
+		}
+	}
+	return dst
+}
+
+// rotatedSize returns the canvas size that fits a width x height image
+// turned by theta radians.
+func rotatedSize(width, height int, theta float64) (int, int) {
+	w, h := float64(width), float64(height)
+	sin, cos := math.Sincos(theta)
+	// The epsilon keeps rounding error from adding a spare row or column.
+	return int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-9)),
+		int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-9))
+}
+
+// bilinear samples src at (x, y), relative to its origin, treating
+// everything outside the image as transparent. Channels are weighted by
+// alpha.
+func bilinear(src *stdimage.NRGBA, x, y float64) []uint8 {
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	var acc [4]float64
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 2; i++ {
+			px, py := x0+i, y0+j
+			if px < 0 || py < 0 || px >= w || py >= h {
+				continue
+			}
+			weight := (1 - math.Abs(float64(i)-fx)) * (1 - math.Abs(float64(j)-fy))
+			p := src.Pix[src.PixOffset(src.Rect.Min.X+px, src.Rect.Min.Y+py):]
+			a := float64(p[3]) * weight
+			acc[0] += float64(p[0]) * a
+			acc[1] += float64(p[1]) * a
+			acc[2] += float64(p[2]) * a
+			acc[3] += a
+		}
+	}
+	if acc[3] == 0 {
+		return []uint8{0, 0, 0, 0}
+	}
+	return []uint8{clamp8(acc[0] / acc[3]), clamp8(acc[1] / acc[3]), clamp8(acc[2] / acc[3]), clamp8(acc[3])}
+}
+
+// FlipFilter mirrors an image horizontally (left to right) or vertically.
+type FlipFilter struct {
+	vertical bool
+}
+
+// NewFlipFilter creates a new flip filter.
+func NewFlipFilter(vertical bool) *FlipFilter {
+	return &FlipFilter{vertical: vertical}
+}
+
+func (f *FlipFilter) Name() string {
+	return FilterFlip
+}
+
+func (f *FlipFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	if f.vertical {
+		return Orient(src, exif.OrientationFlipV)
+	}
+	return Orient(src, exif.OrientationFlipH)
+}
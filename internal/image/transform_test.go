@@ -0,0 +1,86 @@
+package image
+
+import (
+	"errors"
+	stdimage "image"
+	"testing"
+)
+
+func TestOutputSizeMatchesApply(t *testing.T) {
+	pipelines := []string{
+		"resize(width=10)",
+		"resize(height=7, method=nearest)",
+		"resize(13, 5)",
+		"crop(2, 3, 10, 6)",
+		"crop(20, 10, 50, 50)",
+		"crop(aspect='16:9')",
+		"crop(aspect=0.5)",
+		"rotate(90)",
+		"rotate(-90)",
+		"rotate(180)",
+		"rotate(30)",
+		"rotate(-137.5)",
+		"flip",
+		"sepia | resize(width=12) | rotate(45) | crop(aspect=1)",
+	}
+	for _, expr := range pipelines {
+		p, err := ParsePipeline(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		for _, size := range []stdimage.Point{{24, 16}, {16, 24}, {1, 1}} {
+			base := NewBasicImage("fixture", Resize(fixture(), size.X, size.Y, ResampleNearest), ImageMetadata{})
+			img := p.Apply(base)
+			meta, bounds := img.Metadata(), img.Bounds()
+			pix := img.Pixels()
+			if meta.Width != pix.Rect.Dx() || meta.Height != pix.Rect.Dy() || bounds != pix.Rect {
+				t.Errorf("%s on %v: reported %dx%d and %v, rendered %v", expr, size, meta.Width, meta.Height, bounds, pix.Rect)
+			}
+		}
+	}
+}
+
+func TestMetadataDoesNotRender(t *testing.T) {
+	counter := &countingFilter{Filter: NewGrayscaleFilter()}
+	var img Image = NewBasicImage("fixture", fixture(), ImageMetadata{})
+	img = NewFilterDecorator(img, counter)
+	p, err := ParsePipeline("resize(width=12) | rotate(90) | sepia")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = p.Apply(img)
+
+	meta := img.Metadata()
+	if meta.Width != 8 || meta.Height != 12 || img.Bounds() != stdimage.Rect(0, 0, 8, 12) {
+		t.Errorf("size %dx%d, bounds %v; want 8x12", meta.Width, meta.Height, img.Bounds())
+	}
+	if len(meta.Filters) != 4 {
+		t.Errorf("filters %v", meta.Filters)
+	}
+	if counter.calls != 0 {
+		t.Errorf("reading metadata rendered the chain %d times", counter.calls)
+	}
+	img.Pixels()
+	img.Metadata()
+	if counter.calls != 1 {
+		t.Errorf("chain rendered %d times, want 1", counter.calls)
+	}
+}
+
+func TestResizeBoundsArea(t *testing.T) {
+	for _, expr := range []string{"resize(65536, 65536)", "resize(20000, 20000)"} {
+		if _, err := ParsePipeline(expr); !errors.Is(err, ErrInvalidParam) {
+			t.Errorf("%s: %v, want ErrInvalidParam", expr, err)
+		}
+	}
+	if _, err := ParsePipeline("resize(16384, 16384)"); err != nil {
+		t.Errorf("largest allowed size rejected: %v", err)
+	}
+
+	// A single-pixel-high image widened to the maximum width derives an
+	// enormous height, which is shrunk to fit the area bound.
+	w, h := NewResizeFilter(0, maxDimension, ResampleNearest).OutputSize(1, 10)
+	if w*h > maxPixels || w < 1 || h < 1 {
+		t.Errorf("derived size %dx%d exceeds %d pixels", w, h, maxPixels)
+	}
+}
@@ -0,0 +1,245 @@
+package image
+
+import (
+	"fmt"
+	stdimage "image"
+	"math"
+	"strings"
+)
+
+const FilterWhiteBalance = "whitebalance"
+
+const (
+	// neutralTemperature is the color temperature treated as already white;
+	// a temperature correction of this many Kelvin changes nothing.
+	neutralTemperature = 6500.0
+
+	// neutralRadius is the half-width of the window averaged around a
+	// clicked neutral pixel, to keep sensor noise out of the estimate.
+	neutralRadius = 2
+
+	// whitePatchFraction is the share of brightest pixels averaged by the
+	// white-patch estimator.
+	whitePatchFraction = 0.01
+)
+
+// WhiteBalanceMethod selects how a WhiteBalanceFilter finds the color of
+// the scene illuminant.
+type WhiteBalanceMethod int
+
+const (
+	WhiteBalanceTemperature WhiteBalanceMethod = iota // from a Kelvin temperature and tint
+	WhiteBalanceNeutral                               // from a pixel known to be neutral gray
+	WhiteBalanceGrayWorld                             // assume the scene averages to gray
+	WhiteBalanceWhitePatch                            // assume the brightest pixels are white
+)
+
+func (m WhiteBalanceMethod) String() string {
+	switch m {
+	case WhiteBalanceNeutral:
+		return "neutral"
+	case WhiteBalanceGrayWorld:
+		return "grayworld"
+	case WhiteBalanceWhitePatch:
+		return "whitepatch"
+	default:
+		return "temperature"
+	}
+}
+
+// ParseAutoWhiteBalance parses the name of an automatic estimator.
+func ParseAutoWhiteBalance(s string) (WhiteBalanceMethod, error) {
+	switch strings.ToLower(s) {
+	case "grayworld", "gray-world":
+		return WhiteBalanceGrayWorld, nil
+	case "whitepatch", "white-patch":
+		return WhiteBalanceWhitePatch, nil
+	}
+	return 0, fmt.Errorf("unknown white balance estimator %q", s)
+}
+
+// WhiteBalanceFilter corrects a color cast by scaling the red, green and
+// blue channels in linear light. Green is left unchanged, apart from tint,
+// so overall brightness stays roughly the same.
+type WhiteBalanceFilter struct {
+	method      WhiteBalanceMethod
+	temperature float64
+	tint        float64
+	point       stdimage.Point
+}
+
+// NewTemperatureFilter creates a filter for a scene lit at temperature
+// Kelvin: lower values cool the image, correcting warm tungsten light, and
+// higher values warm it. Tint (-100 to 100) shifts colors toward magenta
+// (positive) or green (negative).
+func NewTemperatureFilter(temperature, tint float64) *WhiteBalanceFilter {
+	return &WhiteBalanceFilter{method: WhiteBalanceTemperature, temperature: temperature, tint: tint}
+}
+
+// NewNeutralPointFilter creates a filter that makes the area around pixel
+// (x, y) neutral gray, as a white balance eyedropper would.
+func NewNeutralPointFilter(x, y int) *WhiteBalanceFilter {
+	return &WhiteBalanceFilter{method: WhiteBalanceNeutral, point: stdimage.Pt(x, y)}
+}
+
+// NewAutoWhiteBalanceFilter creates a filter that estimates the illuminant
+// from the image itself with WhiteBalanceGrayWorld or WhiteBalanceWhitePatch.
+func NewAutoWhiteBalanceFilter(method WhiteBalanceMethod) *WhiteBalanceFilter {
+	return &WhiteBalanceFilter{method: method}
+}
+
+func (f *WhiteBalanceFilter) Name() string {
+	return FilterWhiteBalance
+}
+
+func (f *WhiteBalanceFilter) Apply(src *stdimage.NRGBA) *stdimage.NRGBA {
+	var white [3]float64
+	switch f.method {
+	case WhiteBalanceNeutral:
+		white = neutralWhite(src, f.point)
+	case WhiteBalanceGrayWorld:
+		white = grayWorldWhite(src)
+	case WhiteBalanceWhitePatch:
+		white = whitePatchWhite(src)
+	default:
+		white = temperatureWhite(f.temperature)
+		white[1] *= 1 + f.tint/200
+	}
+
+	// Scale so that the illuminant maps to gray, normalized on green.
+	var lut [3][256]float64
+	for c := range lut {
+		gain := 1.0
+		if white[c] > 0 && white[1] > 0 {
+			gain = white[1] / white[c]
+		}
+		for v := range lut[c] {
+			lut[c][v] = encodeSRGB(decodeSRGB(float64(v)/255)*gain) * 255
+		}
+	}
+	return mapPixels(src, func(r, g, b float64) (float64, float64, float64) {
+		return lut[0][int(r)], lut[1][int(g)], lut[2][int(b)]
+	})
+}
+
+// temperatureWhite returns the linear sRGB color of a blackbody at the
+// given temperature relative to one at neutralTemperature.
+func temperatureWhite(kelvin float64) [3]float64 {
+	c := blackbody(kelvin)
+	ref := blackbody(neutralTemperature)
+	return [3]float64{c[0] / ref[0], c[1] / ref[1], c[2] / ref[2]}
+}
+
+// blackbody approximates the linear sRGB color of Planckian light, using
+// the cubic fit of the CIE 1931 locus by Kim et al., valid from 1667 K to
+// 25000 K.
+func blackbody(kelvin float64) [3]float64 {
+	t := math.Max(1667, math.Min(25000, kelvin))
+	t2, t3 := t*t, t*t*t
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/t3 - 0.2343589e6/t2 + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/t3 + 2.1070379e6/t2 + 0.2226347e3/t + 0.240390
+	}
+	x2, x3 := x*x, x*x*x
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x3 - 1.34811020*x2 + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x3 - 1.37418593*x2 + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x3 - 5.87338670*x2 + 3.75112997*x - 0.37001483
+	}
+
+	// xyY with Y = 1 to XYZ, then to linear sRGB.
+	X, Y, Z := x/y, 1.0, (1-x-y)/y
+	return [3]float64{
+		3.2404542*X - 1.5371385*Y - 0.4985314*Z,
+		-0.9692660*X + 1.8760108*Y + 0.0415560*Z,
+		0.0556434*X - 0.2040259*Y + 1.0572252*Z,
+	}
+}
+
+// neutralWhite averages the linear color of the window around p. Points
+// outside the image leave the colors unchanged.
+func neutralWhite(src *stdimage.NRGBA, p stdimage.Point) [3]float64 {
+	b := stdimage.Rect(0, 0, src.Rect.Dx(), src.Rect.Dy())
+	if !p.In(b) {
+		return [3]float64{1, 1, 1}
+	}
+	window := stdimage.Rect(p.X-neutralRadius, p.Y-neutralRadius, p.X+neutralRadius+1, p.Y+neutralRadius+1).Intersect(b)
+	var sum [3]float64
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		for x := window.Min.X; x < window.Max.X; x++ {
+			s := src.Pix[y*src.Stride+x*4:]
+			for c := range sum {
+				sum[c] += decodeSRGB(float64(s[c]) / 255)
+			}
+		}
+	}
+	return sum
+}
+
+// grayWorldWhite averages the linear color of all visible pixels.
+func grayWorldWhite(src *stdimage.NRGBA) [3]float64 {
+	var sum [3]float64
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for i := 0; i < len(row); i += 4 {
+			if row[i+3] == 0 {
+				continue
+			}
+			for c := range sum {
+				sum[c] += decodeSRGB(float64(row[i+c]) / 255)
+			}
+		}
+	}
+	return sum
+}
+
+// whitePatchWhite averages the linear color of the brightest visible
+// pixels, skipping clipped ones whose true color is unknown. Pixels are
+// binned by luma as they are summed, so the brightest share is found
+// without sorting; the bin it ends in contributes pro rata.
+func whitePatchWhite(src *stdimage.NRGBA) [3]float64 {
+	var (
+		counts [256]int
+		sums   [256][3]float64
+		total  int
+	)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < h; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+w*4]
+		for i := 0; i < len(row); i += 4 {
+			r, g, b := row[i], row[i+1], row[i+2]
+			if row[i+3] == 0 || r == 255 || g == 255 || b == 255 {
+				continue
+			}
+			bin := int(luma(float64(r), float64(g), float64(b)))
+			counts[bin]++
+			for c := range sums[bin] {
+				sums[bin][c] += decodeSRGB(float64(row[i+c]) / 255)
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return [3]float64{1, 1, 1}
+	}
+	need := max(1, int(float64(total)*whitePatchFraction))
+	var sum [3]float64
+	for bin := len(counts) - 1; bin >= 0 && need > 0; bin-- {
+		if counts[bin] == 0 {
+			continue
+		}
+		share := min(1, float64(need)/float64(counts[bin]))
+		for c := range sum {
+			sum[c] += sums[bin][c] * share
+		}
+		need -= counts[bin]
+	}
+	return sum
+}
@@ -0,0 +1,150 @@
+package image
+
+import (
+	"errors"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+// linearMean returns the average linear-light color of the pixels of pix
+// inside r.
+func linearMean(pix *stdimage.NRGBA, r stdimage.Rectangle) [3]float64 {
+	var sum [3]float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := pix.NRGBAAt(x, y)
+			for i, v := range []uint8{c.R, c.G, c.B} {
+				sum[i] += decodeSRGB(float64(v) / 255)
+			}
+		}
+	}
+	n := float64(r.Dx() * r.Dy())
+	return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+}
+
+// castImage returns a scene of varied colors seen under warm light.
+func castImage() *stdimage.NRGBA {
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			pix.SetNRGBA(x, y, color.NRGBA{R: uint8(90 + x*3), G: uint8(60 + y*3 + x), B: uint8(30 + (x+y)%40), A: 0xFF})
+		}
+	}
+	return pix
+}
+
+func TestWhitePatchWhite(t *testing.T) {
+	// 1000 dim pixels, 10 bright bluish ones that make up the brightest
+	// 1%, and a clipped highlight that must be ignored.
+	pix := stdimage.NewNRGBA(stdimage.Rect(0, 0, 1011, 1))
+	for x := 0; x < 1011; x++ {
+		c := [4]uint8{60, 50, 40, 0xFF}
+		switch {
+		case x < 10:
+			c = [4]uint8{200, 210, 240, 0xFF}
+		case x == 10:
+			c = [4]uint8{255, 255, 255, 0xFF}
+		}
+		copy(pix.Pix[x*4:], c[:])
+	}
+	got := whitePatchWhite(pix)
+	for c, v := range []uint8{200, 210, 240} {
+		want := 10 * decodeSRGB(float64(v)/255)
+		if math.Abs(got[c]-want) > 1e-9 {
+			t.Errorf("channel %d: %g, want %g", c, got[c], want)
+		}
+	}
+
+	clipped := stdimage.NewNRGBA(stdimage.Rect(0, 0, 2, 2))
+	for i := range clipped.Pix {
+		clipped.Pix[i] = 0xFF
+	}
+	if got := whitePatchWhite(clipped); got != [3]float64{1, 1, 1} {
+		t.Errorf("all clipped: %v, want neutral", got)
+	}
+}
+
+func TestTemperatureNeutralIsIdentity(t *testing.T) {
+	src := fixture()
+	if diff := changed(src, NewTemperatureFilter(neutralTemperature, 0).Apply(src)); !diff.Empty() {
+		t.Errorf("6500 K changed %v", diff)
+	}
+}
+
+func TestTemperatureAndTint(t *testing.T) {
+	gray := solid(4, 4, color.NRGBA{R: 128, G: 128, B: 128, A: 0xFF})
+	at := func(f *WhiteBalanceFilter) color.NRGBA { return f.Apply(gray).NRGBAAt(1, 1) }
+
+	// Correcting for tungsten light cools the image, and for shade warms it.
+	if c := at(NewTemperatureFilter(3200, 0)); !(c.R < c.G && c.G < c.B) {
+		t.Errorf("3200 K: %v, want red below blue", c)
+	}
+	if c := at(NewTemperatureFilter(10000, 0)); !(c.R > c.G && c.G > c.B) {
+		t.Errorf("10000 K: %v, want red above blue", c)
+	}
+	// Tint moves red and blue together against green.
+	if c := at(NewTemperatureFilter(neutralTemperature, 50)); !(c.R > c.G && c.B > c.G) {
+		t.Errorf("tint 50: %v, want magenta", c)
+	}
+	if c := at(NewTemperatureFilter(neutralTemperature, -50)); !(c.R < c.G && c.B < c.G) {
+		t.Errorf("tint -50: %v, want green", c)
+	}
+}
+
+func TestNeutralPoint(t *testing.T) {
+	src := castImage()
+	// Paint a warm-tinted gray card where the user clicks.
+	card := stdimage.Rect(10, 10, 16, 16)
+	draw.Draw(src, card, stdimage.NewUniform(color.NRGBA{R: 170, G: 140, B: 100, A: 0xFF}), stdimage.Point{}, draw.Src)
+
+	dst := NewNeutralPointFilter(13, 13).Apply(src)
+	c := dst.NRGBAAt(13, 13)
+	if max(c.R, c.G, c.B)-min(c.R, c.G, c.B) > 1 {
+		t.Errorf("card corrected to %v, want gray", c)
+	}
+	if c.G != 140 {
+		t.Errorf("green changed to %d", c.G)
+	}
+
+	// Outside the image nothing changes.
+	if diff := changed(src, NewNeutralPointFilter(100, 5).Apply(src)); !diff.Empty() {
+		t.Errorf("point outside the image changed %v", diff)
+	}
+}
+
+func TestGrayWorld(t *testing.T) {
+	src := castImage()
+	before := linearMean(src, src.Rect)
+	if before[0] < 1.5*before[2] {
+		t.Fatalf("fixture has no cast: %v", before)
+	}
+	got := linearMean(NewAutoWhiteBalanceFilter(WhiteBalanceGrayWorld).Apply(src), src.Rect)
+	for c := range got {
+		if math.Abs(got[c]-got[1]) > 0.01*got[1] {
+			t.Errorf("mean %v after gray world, want neutral", got)
+			break
+		}
+	}
+}
+
+func TestWhiteBalanceRegistry(t *testing.T) {
+	for _, args := range [][]Arg{
+		{{Name: "x", Value: "3"}},
+		{{Name: "y", Value: "3"}},
+		{{Name: "auto", Value: "retinex"}},
+	} {
+		if _, err := DefaultRegistry().New(FilterWhiteBalance, args...); !errors.Is(err, ErrInvalidParam) {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+	f, err := DefaultRegistry().New(FilterWhiteBalance, Arg{Name: "x", Value: "3"}, Arg{Name: "y", Value: "4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wb, ok := f.(*configuredFilter).Filter.(*WhiteBalanceFilter); !ok || wb.method != WhiteBalanceNeutral || wb.point != stdimage.Pt(3, 4) {
+		t.Errorf("x and y built %#v", f)
+	}
+}
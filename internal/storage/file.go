@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileAdapter adapts a directory on disk to the Storage interface.
+// Each id maps to one file; writes go to a temporary file that is renamed
+// into place on Close, so readers never observe a partial image.
+type FileAdapter struct {
+	dir string
+}
+
+// NewFileAdapter creates a file-based storage adapter rooted at dir,
+// creating the directory if needed.
+func NewFileAdapter(dir string) (*FileAdapter, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("dir cannot be empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create storage dir: %w", err)
+	}
+	return &FileAdapter{dir: dir}, nil
+}
+
+// Save writes data to the file for id.
+func (f *FileAdapter) Save(id string, data []byte) error {
+	if data == nil {
+		return fmt.Errorf("data cannot be nil")
+	}
+	w, err := f.Create(id)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// Load reads the file for id.
+func (f *FileAdapter) Load(id string) ([]byte, error) {
+	r, err := f.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Create returns a writer that replaces the file for id on Close.
+func (f *FileAdapter) Create(id string) (Writer, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", id, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", id, err)
+	}
+	return &fileWriter{File: tmp, path: path}, nil
+}
+
+// Open returns a reader over the file for id.
+func (f *FileAdapter) Open(id string) (io.ReadCloser, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", id, err)
+	}
+	return file, nil
+}
+
+// path maps an id to a file inside the storage directory. Ids may use "/"
+// to form subdirectories but may not escape the root.
+func (f *FileAdapter) path(id string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("id cannot be empty")
+	}
+	clean := filepath.Clean(filepath.FromSlash(id))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid id %q", id)
+	}
+	return filepath.Join(f.dir, clean), nil
+}
+
+// fileWriter writes to a temporary file and renames it into place on Close.
+type fileWriter struct {
+	*os.File
+	path string
+	done bool
+}
+
+func (w *fileWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	if err := w.File.Close(); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	if err := os.Rename(w.File.Name(), w.path); err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *fileWriter) Abort() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.File.Close()
+	os.Remove(w.File.Name())
+}
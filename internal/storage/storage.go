@@ -2,20 +2,37 @@
 package storage
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 )
 
 var ErrNotFound = errors.New("not found")
 
 // Storage defines persistence operations.
+// Save and Load move whole buffers; Create and Open stream, so large
+// images never need to be held in memory twice.
 type Storage interface {
 	Save(id string, data []byte) error
 	Load(id string) ([]byte, error)
+	Create(id string) (Writer, error)
+	Open(id string) (io.ReadCloser, error)
+}
+
+// Writer streams data into storage. Nothing written is visible until Close
+// commits it; Abort discards it instead, leaving any earlier data stored
+// under the id untouched. Once either has been called, further calls to
+// Close or Abort have no effect.
+type Writer interface {
+	io.WriteCloser
+	Abort()
 }
 
 // MapAdapter adapts a map to the Storage interface.
 type MapAdapter struct {
+	mu   sync.RWMutex
 	data map[string][]byte
 }
 
@@ -34,15 +51,71 @@ func (m *MapAdapter) Save(id string, data []byte) error {
 	if data == nil {
 		return fmt.Errorf("data cannot be nil")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[id] = data
 	return nil
 }
 
 // Load retrieves data from the map.
 func (m *MapAdapter) Load(id string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	data, ok := m.data[id]
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
 	}
 	return data, nil
 }
+
+// Create returns a writer whose contents are stored under id on Close.
+func (m *MapAdapter) Create(id string) (Writer, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty")
+	}
+	return &mapWriter{store: m, id: id}, nil
+}
+
+// Open returns a reader over the data stored under id.
+func (m *MapAdapter) Open(id string) (io.ReadCloser, error) {
+	data, err := m.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// mapWriter buffers a stream and commits it to the map when closed.
+type mapWriter struct {
+	store  *MapAdapter
+	id     string
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *mapWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("write to closed writer for %s", w.id)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *mapWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	data := w.buf.Bytes()
+	if data == nil {
+		data = []byte{} // an empty stream stores an empty entry
+	}
+	return w.store.Save(w.id, data)
+}
+
+func (w *mapWriter) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.buf.Reset()
+}
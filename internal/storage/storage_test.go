@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func adapters(t *testing.T) map[string]Storage {
+	files, err := NewFileAdapter(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]Storage{"map": NewMapAdapter(), "file": files}
+}
+
+func TestWriterCommitsOnClose(t *testing.T) {
+	for name, s := range adapters(t) {
+		w, err := s.Create("a/photo")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		w.Write([]byte("half"))
+		if _, err := s.Load("a/photo"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: data visible before Close (err %v)", name, err)
+		}
+		w.Write([]byte(" and whole"))
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		w.Abort() // no effect after Close
+		if got, err := s.Load("a/photo"); err != nil || string(got) != "half and whole" {
+			t.Errorf("%s: loaded %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestWriterAbortKeepsPreviousData(t *testing.T) {
+	for name, s := range adapters(t) {
+		if err := s.Save("photo", []byte("old")); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		w, err := s.Create("photo")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		w.Write([]byte("partial encode"))
+		w.Abort()
+		if err := w.Close(); err != nil {
+			t.Errorf("%s: Close after Abort: %v", name, err)
+		}
+		if got, err := s.Load("photo"); err != nil || !bytes.Equal(got, []byte("old")) {
+			t.Errorf("%s: loaded %q, %v after Abort", name, got, err)
+		}
+
+		w, _ = s.Create("never")
+		w.Abort()
+		if _, err := s.Load("never"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: aborted writer stored data (err %v)", name, err)
+		}
+	}
+}
+
+func TestWriterEmptyStream(t *testing.T) {
+	for name, s := range adapters(t) {
+		w, err := s.Create("empty")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: closing an unwritten writer: %v", name, err)
+		}
+		if got, err := s.Load("empty"); err != nil || len(got) != 0 {
+			t.Errorf("%s: loaded %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestFileAdapterLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileAdapter(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, _ := s.Create("aborted")
+	w.Write([]byte("x"))
+	w.Abort()
+	w, _ = s.Create("kept")
+	w.Close()
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "kept" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("storage dir holds %v, want [kept]", names)
+	}
+}
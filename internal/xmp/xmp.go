@@ -0,0 +1,316 @@
+// Package xmp reads and writes Adobe XMP metadata, either as .xmp sidecar
+// files or as packets embedded in image files. It understands the
+// properties the app manages (rating, description, keywords and the filter
+// chain) and carries every other property through unchanged, so that
+// rewriting a packet produced by another editor does not lose its data.
+package xmp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Namespace URIs.
+const (
+	NamespaceX        = "adobe:ns:meta/"
+	NamespaceRDF      = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NamespaceXMP      = "http://ns.adobe.com/xap/1.0/"
+	NamespaceDC       = "http://purl.org/dc/elements/1.1/"
+	NamespacePhotoApp = "http://ns.photoapp.dev/1.0/" // the app's own properties
+	namespaceXML      = "http://www.w3.org/XML/1998/namespace"
+)
+
+// SidecarExt is the file extension of XMP sidecar files.
+const SidecarExt = ".xmp"
+
+// packetPadding is the whitespace left in embedded packets so that other
+// tools can edit them in place.
+const packetPadding = 2048
+
+// prefixes maps the namespaces written by Marshal to their prefixes.
+var prefixes = map[string]string{
+	NamespaceX:        "x",
+	NamespaceRDF:      "rdf",
+	NamespaceXMP:      "xmp",
+	NamespaceDC:       "dc",
+	NamespacePhotoApp: "photoapp",
+}
+
+// Metadata holds the XMP properties the app manages.
+type Metadata struct {
+	Rating      int      // xmp:Rating: 1-5, 0 unrated, -1 rejected
+	Description string   // dc:description in the default language
+	Subject     []string // dc:subject keywords
+	Filters     []string // photoapp:Filters, the applied filter chain in order
+
+	namespaces map[string]string // prefix to URI for preserved properties
+	attrs      []string          // preserved simple properties, as prefix:name="value"
+	elements   [][]byte          // preserved property elements, verbatim
+}
+
+// IsZero reports whether m has no properties at all.
+func (m *Metadata) IsZero() bool {
+	return m.Rating == 0 && m.Description == "" && len(m.Subject) == 0 &&
+		len(m.Filters) == 0 && len(m.attrs) == 0 && len(m.elements) == 0
+}
+
+// Parse decodes an XMP sidecar file or packet. Properties of every
+// rdf:Description in the document are gathered into one Metadata.
+func Parse(data []byte) (*Metadata, error) {
+	m := &Metadata{namespaces: make(map[string]string)}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XMP data: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		m.declare(start)
+		if start.Name.Space == NamespaceRDF && start.Name.Local == "Description" {
+			if err := m.readDescription(dec, start, data); err != nil {
+				return nil, fmt.Errorf("invalid XMP data: %w", err)
+			}
+		}
+	}
+	return m, nil
+}
+
+// declare records the namespace prefixes declared on an element.
+func (m *Metadata) declare(start xml.StartElement) {
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" {
+			m.namespaces[a.Name.Local] = a.Value
+		}
+	}
+}
+
+func (m *Metadata) prefix(uri string) string {
+	for p, u := range m.namespaces {
+		if u == uri {
+			return p
+		}
+	}
+	return ""
+}
+
+func (m *Metadata) readDescription(dec *xml.Decoder, start xml.StartElement, data []byte) error {
+	for _, a := range start.Attr {
+		switch {
+		case a.Name.Space == "xmlns" || a.Name.Space == "" || a.Name.Space == NamespaceRDF:
+		case a.Name.Space == NamespaceXMP && a.Name.Local == "Rating":
+			m.Rating = parseRating(a.Value)
+		case a.Name.Space == NamespaceDC && a.Name.Local == "description":
+			m.Description = a.Value
+		default:
+			if p := m.prefix(a.Name.Space); p != "" {
+				m.attrs = append(m.attrs, fmt.Sprintf(`%s:%s="%s"`, p, a.Name.Local, escape(a.Value)))
+			}
+		}
+	}
+
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.EndElement:
+			return nil
+		case xml.StartElement:
+			if err := m.readProperty(dec, t, data, off); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (m *Metadata) readProperty(dec *xml.Decoder, start xml.StartElement, data []byte, off int64) error {
+	name := start.Name
+	switch {
+	case name.Space == NamespaceXMP && name.Local == "Rating":
+		var s string
+		if err := dec.DecodeElement(&s, &start); err != nil {
+			return err
+		}
+		m.Rating = parseRating(s)
+	case name.Space == NamespaceDC && name.Local == "description":
+		items, text, err := readItems(dec)
+		if err != nil {
+			return err
+		}
+		m.Description = strings.TrimSpace(text)
+		for i, item := range items {
+			if i == 0 || item.lang == "x-default" {
+				m.Description = item.text
+			}
+		}
+	case name.Space == NamespaceDC && name.Local == "subject",
+		name.Space == NamespacePhotoApp && name.Local == "Filters":
+		items, _, err := readItems(dec)
+		if err != nil {
+			return err
+		}
+		var values []string
+		for _, item := range items {
+			values = append(values, item.text)
+		}
+		if name.Local == "subject" {
+			m.Subject = values
+		} else {
+			m.Filters = values
+		}
+	default:
+		if err := dec.Skip(); err != nil {
+			return err
+		}
+		raw := bytes.TrimSpace(data[off:dec.InputOffset()])
+		m.elements = append(m.elements, append([]byte(nil), raw...))
+	}
+	return nil
+}
+
+type item struct {
+	lang, text string
+}
+
+// readItems reads the rest of a property element, returning the rdf:li
+// entries of its container and any text directly inside the property.
+func readItems(dec *xml.Decoder) ([]item, string, error) {
+	var items []item
+	var text strings.Builder
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == NamespaceRDF && t.Name.Local == "li" {
+				it := item{}
+				for _, a := range t.Attr {
+					if a.Name.Space == namespaceXML && a.Name.Local == "lang" {
+						it.lang = a.Value
+					}
+				}
+				if err := dec.DecodeElement(&it.text, &t); err != nil {
+					return nil, "", err
+				}
+				items = append(items, it)
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				return items, text.String(), nil
+			}
+			depth--
+		case xml.CharData:
+			if depth == 0 {
+				text.Write(t)
+			}
+		}
+	}
+}
+
+func parseRating(s string) int {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return max(-1, min(5, int(f)))
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Marshal encodes m as an XMP document, the form stored in sidecar files.
+func (m *Metadata) Marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<x:xmpmeta xmlns:x="` + NamespaceX + `">` + "\n")
+	b.WriteString(` <rdf:RDF xmlns:rdf="` + NamespaceRDF + `">` + "\n")
+	b.WriteString(`  <rdf:Description rdf:about=""`)
+	reserved := make(map[string]bool)
+	for _, p := range prefixes {
+		reserved[p] = true
+	}
+	for _, uri := range []string{NamespaceXMP, NamespaceDC, NamespacePhotoApp} {
+		fmt.Fprintf(&b, "\n    xmlns:%s=\"%s\"", prefixes[uri], uri)
+	}
+
+	// Re-declare the prefixes used by preserved properties, skipping any
+	// that would clash with the ones above.
+	var extra []string
+	for p, uri := range m.namespaces {
+		if !reserved[p] {
+			extra = append(extra, fmt.Sprintf(`xmlns:%s="%s"`, p, escape(uri)))
+		}
+	}
+	sort.Strings(extra)
+	for _, decl := range extra {
+		b.WriteString("\n    " + decl)
+	}
+	if m.Rating != 0 {
+		fmt.Fprintf(&b, "\n    xmp:Rating=\"%d\"", m.Rating)
+	}
+	for _, a := range m.attrs {
+		b.WriteString("\n    " + a)
+	}
+	b.WriteString(">\n")
+
+	if m.Description != "" {
+		b.WriteString("   <dc:description>\n    <rdf:Alt>\n")
+		b.WriteString(`     <rdf:li xml:lang="x-default">` + escape(m.Description) + "</rdf:li>\n")
+		b.WriteString("    </rdf:Alt>\n   </dc:description>\n")
+	}
+	writeList(&b, "dc:subject", "rdf:Bag", m.Subject)
+	writeList(&b, "photoapp:Filters", "rdf:Seq", m.Filters)
+	for _, e := range m.elements {
+		b.WriteString("   ")
+		b.Write(e)
+		b.WriteString("\n")
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	return b.Bytes()
+}
+
+func writeList(b *bytes.Buffer, property, container string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "   <%s>\n    <%s>\n", property, container)
+	for _, v := range values {
+		b.WriteString("     <rdf:li>" + escape(v) + "</rdf:li>\n")
+	}
+	fmt.Fprintf(b, "    </%s>\n   </%s>\n", container, property)
+}
+
+// MarshalPacket encodes m as a packet for embedding in an image file:
+// the document wrapped in xpacket processing instructions, with padding
+// so that it can be edited in place.
+func (m *Metadata) MarshalPacket() []byte {
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.Write(m.Marshal())
+	line := strings.Repeat(" ", 99) + "\n"
+	for i := 0; i < packetPadding/len(line); i++ {
+		b.WriteString(line)
+	}
+	b.WriteString(`<?xpacket end="w"?>`)
+	return b.Bytes()
+}
@@ -0,0 +1,89 @@
+package xmp
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalParseRoundTrip(t *testing.T) {
+	m := &Metadata{
+		Rating:      -1,
+		Description: `Sunset <over> "the" bay & co`,
+		Subject:     []string{"beach", "sunset", "r&d"},
+		Filters:     []string{"resize(width=800)", "sharpen(amount=0.5)"},
+	}
+	for name, data := range map[string][]byte{"document": m.Marshal(), "packet": m.MarshalPacket()} {
+		got, err := Parse(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.Rating != m.Rating || got.Description != m.Description ||
+			!reflect.DeepEqual(got.Subject, m.Subject) || !reflect.DeepEqual(got.Filters, m.Filters) {
+			t.Errorf("%s: parsed %+v, want %+v", name, got, m)
+		}
+	}
+	if empty, err := Parse((&Metadata{}).Marshal()); err != nil || !empty.IsZero() {
+		t.Errorf("empty metadata parsed as %+v, %v", empty, err)
+	}
+}
+
+func TestParsePreservesForeignProperties(t *testing.T) {
+	doc := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:lr="http://ns.adobe.com/lightroom/1.0/"
+    xmp:Rating="3.0"
+    lr:Label="Red">
+   <dc:description>
+    <rdf:Alt>
+     <rdf:li xml:lang="de">Strand</rdf:li>
+     <rdf:li xml:lang="x-default">Beach</rdf:li>
+    </rdf:Alt>
+   </dc:description>
+   <lr:hierarchicalSubject>
+    <rdf:Bag>
+     <rdf:li>Places|Coast</rdf:li>
+    </rdf:Bag>
+   </lr:hierarchicalSubject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+	m, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rating != 3 || m.Description != "Beach" {
+		t.Errorf("rating %d, description %q", m.Rating, m.Description)
+	}
+
+	// Editing a managed property keeps the other tool's data.
+	m.Rating = 5
+	out := m.Marshal()
+	for _, want := range []string{`xmlns:lr="http://ns.adobe.com/lightroom/1.0/"`, `lr:Label="Red"`, "<rdf:li>Places|Coast</rdf:li>"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("marshaled document lost %s", want)
+		}
+	}
+	again, err := Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Rating != 5 || again.Description != "Beach" || len(again.attrs) != 1 || len(again.elements) != 1 {
+		t.Errorf("reparsed %+v", again)
+	}
+}
+
+func TestParseRejectsMalformed(t *testing.T) {
+	for _, doc := range []string{
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF`,
+		`<rdf:Description xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><dc:subject></rdf:Description>`,
+	} {
+		if _, err := Parse([]byte(doc)); err == nil || !strings.HasPrefix(err.Error(), "invalid XMP data") {
+			t.Errorf("%q: %v", doc, err)
+		}
+	}
+}